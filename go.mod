@@ -6,9 +6,12 @@ require (
 	github.com/alecthomas/kong v0.8.1
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/pressly/goose/v3 v3.18.0
+	golang.org/x/crypto v0.17.0
 )
 
-require gopkg.in/yaml.v2 v2.4.0 // indirect
+require gopkg.in/yaml.v2 v2.4.0
+
+require github.com/BurntSushi/toml v1.3.2
 
 require (
 	github.com/fsnotify/fsnotify v1.7.0
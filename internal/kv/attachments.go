@@ -0,0 +1,157 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// validateEvents returns the events a hook is attached for, EventSet when
+// none are given.
+func validateEvents(events []Event) ([]Event, error) {
+	if len(events) == 0 {
+		return []Event{EventSet}, nil
+	}
+	for _, event := range events {
+		switch event {
+		case EventSet, EventCreate, EventUpdate, EventDelete, EventExpire:
+		default:
+			return nil, invalidf("unknown hook event '%s'", event)
+		}
+	}
+	return events, nil
+}
+
+func (s *kvService) DetachHook(ctx context.Context, key string, hook string) error {
+	if key == "" || hook == "" {
+		return invalidf("key or hook name may not be empty")
+	}
+	detached, err := s.r.DetachHook(ctx, key, hook)
+	if err != nil {
+		return fmt.Errorf("failed to detach the %s hook from the %s key: %w", hook, key, err)
+	}
+	if !detached {
+		return fmt.Errorf("%w: %s is not attached to the %s key", ErrHookNotFound, hook, key)
+	}
+	return nil
+}
+
+// DetachAllHooks detaches every hook from the key and returns how many were
+// attached.
+func (s *kvService) DetachAllHooks(ctx context.Context, key string) (int64, error) {
+	if err := s.requireKey(ctx, key); err != nil {
+		return 0, err
+	}
+	detached, err := s.r.DetachAllHooks(ctx, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detach the hooks of the %s key: %w", key, err)
+	}
+	return detached, nil
+}
+
+// GetHookKeys returns the keys the hook is attached to.
+func (s *kvService) GetHookKeys(ctx context.Context, hook string) ([]string, error) {
+	if hook == "" {
+		return nil, invalidf("hook name may not be empty")
+	}
+	hookExists, err := s.r.HookExists(ctx, hook)
+	if err != nil {
+		return nil, fmt.Errorf("could not check if hook exists: %w", err)
+	}
+	if !hookExists {
+		return nil, fmt.Errorf("%w: %s", ErrHookNotFound, hook)
+	}
+	keys, err := s.r.GetHookKeys(ctx, hook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the keys the %s hook is attached to: %w", hook, err)
+	}
+	return keys, nil
+}
+
+// matchingKeys returns every key matched by the filters of opts, the limit
+// is ignored.
+func matchingKeys(ctx context.Context, r KvRepository, opts ListOptions) ([]string, error) {
+	opts.Limit = 0
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	keys, err := r.ListKeysPage(ctx, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the matching keys: %w", err)
+	}
+	return keys, nil
+}
+
+// AttachHookMatching attaches the hook to every key matched by opts in a
+// single transaction. Keys the hook is already attached to are skipped, the
+// keys it was attached to are returned.
+func (s *kvService) AttachHookMatching(ctx context.Context, opts ListOptions, hook string, events ...Event) ([]string, error) {
+	if hook == "" {
+		return nil, invalidf("hook name may not be empty")
+	}
+	events, err := validateEvents(events)
+	if err != nil {
+		return nil, err
+	}
+	var attached []string
+	err = s.r.Transact(ctx, func(r KvRepository) error {
+		hookExists, err := r.HookExists(ctx, hook)
+		if err != nil {
+			return fmt.Errorf("could not check if hook exists: %w", err)
+		}
+		if !hookExists {
+			return fmt.Errorf("%w: %s", ErrHookNotFound, hook)
+		}
+		keys, err := matchingKeys(ctx, r, opts)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			err := r.AttachHook(ctx, key, hook, events)
+			if errors.Is(err, ErrAlreadyAttached) {
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to attach the %s hook to the %s key: %w", hook, key, err)
+			}
+			attached = append(attached, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range attached {
+		s.bus.publish(ctx, HookAttached{Namespace: s.Namespace(), Key: key, Hook: hook, Events: events})
+	}
+	return attached, nil
+}
+
+// DetachHookMatching detaches the hook from every key matched by opts in a
+// single transaction and returns the keys it was detached from.
+func (s *kvService) DetachHookMatching(ctx context.Context, opts ListOptions, hook string) ([]string, error) {
+	if hook == "" {
+		return nil, invalidf("hook name may not be empty")
+	}
+	var detached []string
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		keys, err := matchingKeys(ctx, r, opts)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			ok, err := r.DetachHook(ctx, key, hook)
+			if err != nil {
+				return fmt.Errorf("failed to detach the %s hook from the %s key: %w", hook, key, err)
+			}
+			if ok {
+				detached = append(detached, key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return detached, nil
+}
@@ -0,0 +1,629 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// AuditAction is the kind of change an audit entry records.
+type AuditAction string
+
+const (
+	AuditSet             AuditAction = "set"
+	AuditDelete          AuditAction = "delete"
+	AuditExpire          AuditAction = "expire"
+	AuditRename          AuditAction = "rename"
+	AuditCopy            AuditAction = "copy"
+	AuditSetType         AuditAction = "set-type"
+	AuditSetDescription  AuditAction = "set-description"
+	AuditSetOwner        AuditAction = "set-owner"
+	AuditAddTag          AuditAction = "add-tag"
+	AuditRemoveTag       AuditAction = "remove-tag"
+	AuditSetHook         AuditAction = "set-hook"
+	AuditSetHookTimeout  AuditAction = "set-hook-timeout"
+	AuditDeleteHook      AuditAction = "delete-hook"
+	AuditAttachHook      AuditAction = "attach-hook"
+	AuditDetachHook      AuditAction = "detach-hook"
+	AuditDeleteNamespace AuditAction = "delete-namespace"
+	AuditCreateSnapshot  AuditAction = "create-snapshot"
+	AuditRestoreSnapshot AuditAction = "restore-snapshot"
+	AuditDeleteSnapshot  AuditAction = "delete-snapshot"
+	AuditSetProfile      AuditAction = "set-profile"
+	AuditDeleteProfile   AuditAction = "delete-profile"
+	AuditSetSchema       AuditAction = "set-schema"
+	AuditDeleteSchema    AuditAction = "delete-schema"
+	AuditPrune           AuditAction = "prune"
+)
+
+// Actor is the process making the changes recorded in the audit log.
+type Actor struct {
+	User    string
+	Host    string
+	PID     int
+	Command string
+}
+
+// CurrentActor describes the running process. The fields that can not be
+// looked up are left empty.
+func CurrentActor() Actor {
+	actor := Actor{
+		PID:     os.Getpid(),
+		Command: strings.Join(os.Args, " "),
+	}
+	if u, err := user.Current(); err == nil {
+		actor.User = u.Username
+	} else {
+		actor.User = os.Getenv("USER")
+	}
+	if host, err := os.Hostname(); err == nil {
+		actor.Host = host
+	}
+	return actor
+}
+
+// WithActor sets the process recorded in the audit log, CurrentActor is
+// used by default.
+func WithActor(actor Actor) ServiceOption {
+	return func(s *kvService) {
+		s.actor = actor
+	}
+}
+
+// AuditEntry is a change recorded in the audit log. The values are nil when
+// there was none, e.g. the old value of a created key, and the values of
+// secrets are masked.
+type AuditEntry struct {
+	ID        int64       `json:"id"`
+	At        time.Time   `json:"at"`
+	Namespace string      `json:"namespace"`
+	Action    AuditAction `json:"action"`
+	// Target is the key, hook, namespace, snapshot or profile that was
+	// changed. It is empty for the schema of the namespace.
+	Target  string  `json:"target"`
+	OldVal  *string `json:"old_val,omitempty"`
+	NewVal  *string `json:"new_val,omitempty"`
+	User    string  `json:"user"`
+	Host    string  `json:"host"`
+	PID     int     `json:"pid"`
+	Command string  `json:"command"`
+}
+
+// AuditFilter selects audit entries, the fields that are not set match
+// every entry.
+type AuditFilter struct {
+	Namespace string
+	// Key matches the target of the entries.
+	Key   string
+	User  string
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of entries returned, the most recent
+	// ones are kept.
+	Limit int
+}
+
+// QueryAudit returns the audit entries of every namespace matching the
+// filter, in the order they were recorded.
+func (s *kvService) QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error) {
+	if filter.Limit < 0 {
+		return nil, invalidf("limit may not be negative")
+	}
+	if !filter.Until.IsZero() && filter.Until.Before(filter.Since) {
+		return nil, invalidf("the end of the time range is before its start")
+	}
+	entries, err := s.r.QueryAudit(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query the audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// WriteAuditJSONLines writes one JSON object per entry and line.
+func WriteAuditJSONLines(w io.Writer, entries []AuditEntry) error {
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// auditRepository records every change made through the repository it
+// wraps in the audit log, in the transaction making the change.
+type auditRepository struct {
+	KvRepository
+	actor Actor
+}
+
+func newAuditRepository(r KvRepository, actor Actor) *auditRepository {
+	return &auditRepository{KvRepository: r, actor: actor}
+}
+
+// auditRecord is what a change adds to the audit log. Nothing is recorded
+// when the action is empty.
+type auditRecord struct {
+	action AuditAction
+	target string
+	oldVal *string
+	newVal *string
+	// secret masks the values and the command line, which may hold them.
+	secret bool
+}
+
+// audit runs fn and appends the change it returns to the audit log in the
+// same transaction.
+func (a *auditRepository) audit(ctx context.Context, fn func(r KvRepository) (auditRecord, error)) error {
+	return a.KvRepository.Transact(ctx, func(r KvRepository) error {
+		record, err := fn(r)
+		if err != nil || record.action == "" {
+			return err
+		}
+		entry := AuditEntry{
+			Namespace: r.Namespace(),
+			Action:    record.action,
+			Target:    record.target,
+			OldVal:    record.oldVal,
+			NewVal:    record.newVal,
+			User:      a.actor.User,
+			Host:      a.actor.Host,
+			PID:       a.actor.PID,
+			Command:   a.actor.Command,
+		}
+		if record.secret {
+			entry.OldVal = masked(entry.OldVal)
+			entry.NewVal = masked(entry.NewVal)
+			program, _, _ := strings.Cut(entry.Command, " ")
+			entry.Command = program + " " + SecretMask
+		}
+		if err := r.AppendAudit(ctx, entry); err != nil {
+			return fmt.Errorf("failed to append to the audit log: %w", err)
+		}
+		return nil
+	})
+}
+
+func masked(val *string) *string {
+	if val == nil {
+		return nil
+	}
+	return ptr(SecretMask)
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+// storedVal returns the value of key, nil if it does not exist, and whether
+// it is a secret.
+func storedVal(ctx context.Context, r KvRepository, key string) (*string, bool, error) {
+	val, err := r.GetVal(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	secret, err := r.IsSecret(ctx, key)
+	if err != nil {
+		return nil, false, err
+	}
+	return &val, secret, nil
+}
+
+// storedInfo returns the metadata of key, the zero KeyInfo if it does not
+// exist.
+func storedInfo(ctx context.Context, r KvRepository, key string) (KeyInfo, error) {
+	info, err := r.GetKeyInfo(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return KeyInfo{}, nil
+	}
+	return info, err
+}
+
+func (a *auditRepository) WithNamespace(namespace string) KvRepository {
+	return newAuditRepository(a.KvRepository.WithNamespace(namespace), a.actor)
+}
+
+func (a *auditRepository) Transact(ctx context.Context, fn func(KvRepository) error) error {
+	return a.KvRepository.Transact(ctx, func(r KvRepository) error {
+		return fn(newAuditRepository(r, a.actor))
+	})
+}
+
+func (a *auditRepository) SetVal(ctx context.Context, key string, val string, expiresAt time.Time, secret bool) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, wasSecret, err := storedVal(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetVal(ctx, key, val, expiresAt, secret); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSet, target: key, oldVal: old, newVal: &val, secret: secret || wasSecret}, nil
+	})
+}
+
+func (a *auditRepository) SetValIfVersion(ctx context.Context, key string, val string, expiresAt time.Time, secret bool, version int64) (bool, error) {
+	var written bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, wasSecret, err := storedVal(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		written, err = r.SetValIfVersion(ctx, key, val, expiresAt, secret, version)
+		if err != nil || !written {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSet, target: key, oldVal: old, newVal: &val, secret: secret || wasSecret}, nil
+	})
+	return written, err
+}
+
+func (a *auditRepository) DeleteKey(ctx context.Context, key string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, secret, err := storedVal(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.DeleteKey(ctx, key); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDelete, target: key, oldVal: old, secret: secret}, nil
+	})
+}
+
+func (a *auditRepository) DeleteExpiredKey(ctx context.Context, key string) (bool, error) {
+	var deleted bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		// the key is expired, it can no longer be read
+		secret, err := r.IsSecret(ctx, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		deleted, err = r.DeleteExpiredKey(ctx, key)
+		if err != nil || !deleted {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditExpire, target: key, secret: secret}, nil
+	})
+	return deleted, err
+}
+
+func (a *auditRepository) RenameKey(ctx context.Context, key string, newKey string, val string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.RenameKey(ctx, key, newKey, val); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditRename, target: key, newVal: &newKey}, nil
+	})
+}
+
+func (a *auditRepository) CopyKey(ctx context.Context, key string, newKey string, val string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.CopyKey(ctx, key, newKey, val); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditCopy, target: key, newVal: &newKey}, nil
+	})
+}
+
+func (a *auditRepository) SetKeyType(ctx context.Context, key string, valueType ValueType) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, err := r.GetKeyType(ctx, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetKeyType(ctx, key, valueType); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetType, target: key, oldVal: ptr(string(old)), newVal: ptr(string(valueType))}, nil
+	})
+}
+
+func (a *auditRepository) SetDescription(ctx context.Context, key string, description string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		info, err := storedInfo(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetDescription(ctx, key, description); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetDescription, target: key, oldVal: &info.Description, newVal: &description}, nil
+	})
+}
+
+func (a *auditRepository) SetOwner(ctx context.Context, key string, owner string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		info, err := storedInfo(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetOwner(ctx, key, owner); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetOwner, target: key, oldVal: &info.Owner, newVal: &owner}, nil
+	})
+}
+
+func (a *auditRepository) AddTag(ctx context.Context, key string, tag string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.AddTag(ctx, key, tag); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditAddTag, target: key, newVal: &tag}, nil
+	})
+}
+
+func (a *auditRepository) RemoveTag(ctx context.Context, key string, tag string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.RemoveTag(ctx, key, tag); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditRemoveTag, target: key, oldVal: &tag}, nil
+	})
+}
+
+func (a *auditRepository) SetScriptHook(ctx context.Context, name string, script string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.SetScriptHook(ctx, name, script); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetHook, target: name, newVal: &script}, nil
+	})
+}
+
+func (a *auditRepository) SetHookTimeout(ctx context.Context, name string, timeout time.Duration) (bool, error) {
+	var updated bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		var err error
+		updated, err = r.SetHookTimeout(ctx, name, timeout)
+		if err != nil || !updated {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetHookTimeout, target: name, newVal: ptr(timeout.String())}, nil
+	})
+	return updated, err
+}
+
+func (a *auditRepository) SetFileHook(ctx context.Context, name string, content string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.SetFileHook(ctx, name, content); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetHook, target: name, newVal: &content}, nil
+	})
+}
+
+func (a *auditRepository) SetFilePathHook(ctx context.Context, name string, filepath string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.SetFilePathHook(ctx, name, filepath); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditSetHook, target: name, newVal: &filepath}, nil
+	})
+}
+
+func (a *auditRepository) DeleteHook(ctx context.Context, name string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.DeleteHook(ctx, name); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDeleteHook, target: name}, nil
+	})
+}
+
+// The attachments are recorded on the key, the value is the hook and its
+// events.
+func (a *auditRepository) AttachHook(ctx context.Context, key string, hook string, events []Event) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.AttachHook(ctx, key, hook, events); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditAttachHook, target: key, newVal: ptr(fmt.Sprintf("%s %v", hook, events))}, nil
+	})
+}
+
+func (a *auditRepository) DetachHook(ctx context.Context, key string, hook string) (bool, error) {
+	var detached bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		var err error
+		detached, err = r.DetachHook(ctx, key, hook)
+		if err != nil || !detached {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDetachHook, target: key, oldVal: &hook}, nil
+	})
+	return detached, err
+}
+
+func (a *auditRepository) DetachAllHooks(ctx context.Context, key string) (int64, error) {
+	var detached int64
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		hooks, err := r.GetAttachedHooks(ctx, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		detached, err = r.DetachAllHooks(ctx, key)
+		if err != nil || detached == 0 {
+			return auditRecord{}, err
+		}
+		names := make([]string, len(hooks))
+		for i, hook := range hooks {
+			names[i] = hook.Name
+		}
+		return auditRecord{action: AuditDetachHook, target: key, oldVal: ptr(strings.Join(names, ","))}, nil
+	})
+	return detached, err
+}
+
+func (a *auditRepository) DeleteNamespace(ctx context.Context, namespace string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.DeleteNamespace(ctx, namespace); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDeleteNamespace, target: namespace}, nil
+	})
+}
+
+// Prunes record the number of changes and revisions deleted.
+func (a *auditRepository) Prune(ctx context.Context, before time.Time, maxChanges int, maxRevisions int) (PruneResult, error) {
+	var result PruneResult
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		var err error
+		result, err = r.Prune(ctx, before, maxChanges, maxRevisions)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		pruned := fmt.Sprintf("%d changes, %d revisions", result.Changes, result.Revisions)
+		return auditRecord{action: AuditPrune, newVal: &pruned}, nil
+	})
+	return result, err
+}
+
+func (a *auditRepository) CreateSnapshot(ctx context.Context, name string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.CreateSnapshot(ctx, name); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditCreateSnapshot, target: name}, nil
+	})
+}
+
+func (a *auditRepository) RestoreSnapshot(ctx context.Context, name string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.RestoreSnapshot(ctx, name); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditRestoreSnapshot, target: name}, nil
+	})
+}
+
+// The restores of a single key are recorded on the key, the value is the
+// snapshot.
+func (a *auditRepository) RestoreSnapshotKey(ctx context.Context, name string, key string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, secret, err := storedVal(ctx, r, key)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.RestoreSnapshotKey(ctx, name, key); err != nil {
+			return auditRecord{}, err
+		}
+		if secret {
+			old = masked(old)
+		}
+		return auditRecord{action: AuditRestoreSnapshot, target: key, oldVal: old, newVal: &name}, nil
+	})
+}
+
+func (a *auditRepository) DeleteSnapshot(ctx context.Context, name string) (bool, error) {
+	var deleted bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		var err error
+		deleted, err = r.DeleteSnapshot(ctx, name)
+		if err != nil || !deleted {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDeleteSnapshot, target: name}, nil
+	})
+	return deleted, err
+}
+
+func (a *auditRepository) SetProfile(ctx context.Context, name string, layers []string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, err := r.GetProfile(ctx, name)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetProfile(ctx, name, layers); err != nil {
+			return auditRecord{}, err
+		}
+		record := auditRecord{action: AuditSetProfile, target: name, newVal: ptr(strings.Join(layers, ","))}
+		if len(old) > 0 {
+			record.oldVal = ptr(strings.Join(old, ","))
+		}
+		return record, nil
+	})
+}
+
+func (a *auditRepository) DeleteProfile(ctx context.Context, name string) (bool, error) {
+	var deleted bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, err := r.GetProfile(ctx, name)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		deleted, err = r.DeleteProfile(ctx, name)
+		if err != nil || !deleted {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDeleteProfile, target: name, oldVal: ptr(strings.Join(old, ","))}, nil
+	})
+	return deleted, err
+}
+
+// The attachments to the keys of a profile are recorded on the profile, the
+// value is the key, the hook and its events.
+func (a *auditRepository) AttachProfileHook(ctx context.Context, profile string, key string, hook string, events []Event) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		if err := r.AttachProfileHook(ctx, profile, key, hook, events); err != nil {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditAttachHook, target: profile, newVal: ptr(fmt.Sprintf("%s %s %v", key, hook, events))}, nil
+	})
+}
+
+func (a *auditRepository) DetachProfileHook(ctx context.Context, profile string, key string, hook string) (bool, error) {
+	var detached bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		var err error
+		detached, err = r.DetachProfileHook(ctx, profile, key, hook)
+		if err != nil || !detached {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDetachHook, target: profile, oldVal: ptr(key + " " + hook)}, nil
+	})
+	return detached, err
+}
+
+func (a *auditRepository) SetSchema(ctx context.Context, document string) error {
+	return a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, err := r.GetSchema(ctx)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		if err := r.SetSchema(ctx, document); err != nil {
+			return auditRecord{}, err
+		}
+		record := auditRecord{action: AuditSetSchema, newVal: &document}
+		if old != "" {
+			record.oldVal = &old
+		}
+		return record, nil
+	})
+}
+
+func (a *auditRepository) DeleteSchema(ctx context.Context) (bool, error) {
+	var deleted bool
+	err := a.audit(ctx, func(r KvRepository) (auditRecord, error) {
+		old, err := r.GetSchema(ctx)
+		if err != nil {
+			return auditRecord{}, err
+		}
+		deleted, err = r.DeleteSchema(ctx)
+		if err != nil || !deleted {
+			return auditRecord{}, err
+		}
+		return auditRecord{action: AuditDeleteSchema, oldVal: &old}, nil
+	})
+	return deleted, err
+}
@@ -0,0 +1,79 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+)
+
+type OpType string
+
+const (
+	OpSet    OpType = "set"
+	OpDelete OpType = "delete"
+)
+
+// Op is a single change applied by Apply.
+type Op struct {
+	Type OpType `json:"op"`
+	Key  string `json:"key"`
+	Val  string `json:"val,omitempty"`
+}
+
+// Apply runs every operation in a single transaction, either all of them are
+// stored or none are. Once the transaction is committed the hooks of every
+// changed key are run once, comparing its value before the batch with its
+// final value.
+func (s *kvService) Apply(ctx context.Context, ops []Op) ([]CmdOutput, error) {
+	if len(ops) == 0 {
+		return nil, invalidf("no operations were provided")
+	}
+	var changes []change
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		tx := s.withRepository(r)
+		// the hooks run once the whole batch is committed
+		opCtx := deferDispatch(ctx)
+		var changed []string
+		before := make(map[string]keyState)
+		finalVals := make(map[string]*string)
+		for i, op := range ops {
+			if _, seen := before[op.Key]; !seen && op.Key != "" {
+				state, err := s.snapshot(ctx, r, op.Key, true)
+				if err != nil {
+					return err
+				}
+				before[op.Key] = state
+				changed = append(changed, op.Key)
+			}
+			var err error
+			switch op.Type {
+			case OpSet:
+				err = tx.Set(opCtx, op.Key, op.Val)
+			case OpDelete:
+				err = tx.Delete(opCtx, op.Key)
+			default:
+				err = invalidf("unknown operation type '%s'", op.Type)
+			}
+			if err != nil {
+				return fmt.Errorf("operation %d (%s %s) failed: %w", i+1, op.Type, op.Key, err)
+			}
+			if op.Type == OpSet {
+				val := op.Val
+				finalVals[op.Key] = &val
+			} else {
+				finalVals[op.Key] = nil
+			}
+		}
+		for _, key := range changed {
+			c, err := s.changeOf(ctx, r, key, before[key], finalVals[key])
+			if err != nil {
+				return err
+			}
+			changes = append(changes, c)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("the batch was rolled back: %w", err)
+	}
+	return s.dispatch(ctx, changes...)
+}
@@ -0,0 +1,340 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// BusEvent is an event published in-process to the subscribers of the
+// service once the change it describes is committed: KeySet, KeyDeleted,
+// HookAttached, HookExecuted or TemplateRendered.
+type BusEvent interface {
+	busEvent()
+}
+
+// KeySet is published when a write changed the value of a key. The values
+// of secrets are decrypted.
+type KeySet struct {
+	Namespace string
+	Key       string
+	OldVal    string
+	NewVal    string
+	// Created is set when the key was not stored before the write.
+	Created bool
+}
+
+// KeyDeleted is published when a key was deleted.
+type KeyDeleted struct {
+	Namespace string
+	Key       string
+	OldVal    string
+	// Expired is set when the key was deleted by PurgeExpired.
+	Expired bool
+}
+
+// HookAttached is published when a hook was attached to a key.
+type HookAttached struct {
+	Namespace string
+	Key       string
+	Hook      string
+	Events    []Event
+	// Profile is set when the hook was attached to a key of a profile.
+	Profile string
+}
+
+// HookExecuted is published for every hook the service ran on its own, e.g.
+// after Set or Delete.
+type HookExecuted struct {
+	Namespace string
+	Key       string
+	Event     Event
+	// Profile is set for the hooks run when the effective value of the key
+	// changed in a profile.
+	Profile string
+	Output  CmdOutput
+}
+
+// TemplateRendered is published by the templating service when a template
+// was rendered with the values of the service.
+type TemplateRendered struct {
+	Namespace      string
+	Profile        string
+	RenderLocation string
+	Keys           []string
+}
+
+func (KeySet) busEvent()           {}
+func (KeyDeleted) busEvent()       {}
+func (HookAttached) busEvent()     {}
+func (HookExecuted) busEvent()     {}
+func (TemplateRendered) busEvent() {}
+
+// Backpressure is what happens to an event published while the buffer of a
+// subscriber is full.
+type Backpressure string
+
+const (
+	// DropNewest discards the event.
+	DropNewest Backpressure = "drop-newest"
+	// DropOldest discards the oldest buffered event to make room for it.
+	DropOldest Backpressure = "drop-oldest"
+	// Block makes the publisher, e.g. a Set, wait until the subscriber reads
+	// an event or its context is done.
+	Block Backpressure = "block"
+)
+
+// DefaultBufferSize is the number of events buffered for a subscriber.
+const DefaultBufferSize = 64
+
+type subscribeOptions struct {
+	size   int
+	policy Backpressure
+}
+
+type SubscribeOption func(*subscribeOptions)
+
+// BufferSize sets the number of events buffered for the subscriber.
+func BufferSize(size int) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.size = size
+	}
+}
+
+// OnFull sets what happens to the events published while the buffer of the
+// subscriber is full, DropNewest by default.
+func OnFull(policy Backpressure) SubscribeOption {
+	return func(o *subscribeOptions) {
+		o.policy = policy
+	}
+}
+
+// Subscription receives the events published by the service, and by the
+// services derived from it, e.g. with WithNamespace or WithProfile, in the
+// order they were published.
+type Subscription struct {
+	bus       *eventBus
+	events    chan BusEvent
+	policy    Backpressure
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Uint64
+}
+
+// Events returns the channel the events are sent on, it is closed by Close.
+func (sub *Subscription) Events() <-chan BusEvent {
+	return sub.events
+}
+
+// Dropped returns the number of events discarded because the buffer was
+// full.
+func (sub *Subscription) Dropped() uint64 {
+	return sub.dropped.Load()
+}
+
+// Close stops the subscription. The buffered events can still be read.
+func (sub *Subscription) Close() {
+	sub.closeOnce.Do(func() {
+		// releases the publishers blocked on this subscriber
+		close(sub.done)
+		sub.bus.mu.Lock()
+		delete(sub.bus.subs, sub)
+		sub.bus.mu.Unlock()
+		close(sub.events)
+	})
+}
+
+func (sub *Subscription) send(ctx context.Context, event BusEvent) {
+	select {
+	case sub.events <- event:
+		return
+	default:
+	}
+	switch sub.policy {
+	case Block:
+		select {
+		case sub.events <- event:
+		case <-sub.done:
+		case <-ctx.Done():
+			sub.dropped.Add(1)
+		}
+	case DropOldest:
+		for {
+			select {
+			case <-sub.events:
+				sub.dropped.Add(1)
+			default:
+			}
+			select {
+			case sub.events <- event:
+				return
+			default:
+			}
+		}
+	default:
+		sub.dropped.Add(1)
+	}
+}
+
+// eventBus is shared by a service and the services derived from it.
+type eventBus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{subs: make(map[*Subscription]struct{})}
+}
+
+func (b *eventBus) subscribe(opts []SubscribeOption) (*Subscription, error) {
+	options := subscribeOptions{size: DefaultBufferSize, policy: DropNewest}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.size <= 0 {
+		return nil, invalidf("the buffer size must be positive")
+	}
+	switch options.policy {
+	case DropNewest, DropOldest, Block:
+	default:
+		return nil, invalidf("unknown backpressure policy '%s'", options.policy)
+	}
+	sub := &Subscription{
+		bus:    b,
+		events: make(chan BusEvent, options.size),
+		policy: options.policy,
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	b.subs[sub] = struct{}{}
+	b.mu.Unlock()
+	return sub, nil
+}
+
+func (b *eventBus) publish(ctx context.Context, events ...BusEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, event := range events {
+		for sub := range b.subs {
+			sub.send(ctx, event)
+		}
+	}
+}
+
+// Subscribe returns a subscription receiving the events published from now
+// on. Close it once done.
+func (s *kvService) Subscribe(opts ...SubscribeOption) (*Subscription, error) {
+	return s.bus.subscribe(opts)
+}
+
+// SubscribeFunc calls fn with every event published from now on, from a
+// goroutine of its own so a slow callback only fills its buffer. With Block,
+// fn must not write through the service while the buffer is full.
+func (s *kvService) SubscribeFunc(fn func(BusEvent), opts ...SubscribeOption) (*Subscription, error) {
+	sub, err := s.bus.subscribe(opts)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		for event := range sub.events {
+			fn(event)
+		}
+	}()
+	return sub, nil
+}
+
+// PublishTemplateRendered sends the event of a template rendered by the
+// templating service to the subscribers. The other events are only
+// published by the service itself.
+func (s *kvService) PublishTemplateRendered(ctx context.Context, event TemplateRendered) {
+	s.bus.publish(ctx, event)
+}
+
+// publishChanges publishes the committed writes of keys.
+func (s *kvService) publishChanges(ctx context.Context, changes []change) {
+	s.bus.publish(ctx, changeEvents(s.Namespace(), changes)...)
+}
+
+// changeEvents returns the events of the writes of keys of the namespace.
+func changeEvents(namespace string, changes []change) []BusEvent {
+	var events []BusEvent
+	for _, c := range changes {
+		switch c.event {
+		case EventCreate, EventUpdate:
+			events = append(events, KeySet{Namespace: namespace, Key: c.key, OldVal: c.oldVal, NewVal: c.newVal, Created: c.event == EventCreate})
+		case EventDelete, EventExpire:
+			events = append(events, KeyDeleted{Namespace: namespace, Key: c.key, OldVal: c.oldVal, Expired: c.event == EventExpire})
+		}
+	}
+	return events
+}
+
+// keyRef is a key of a namespace.
+type keyRef struct {
+	namespace string
+	key       string
+}
+
+// refs returns the refs of keys of the namespace of the service.
+func (s *kvService) refs(keys ...string) []keyRef {
+	refs := make([]keyRef, len(keys))
+	for i, key := range keys {
+		refs[i] = keyRef{namespace: s.Namespace(), key: key}
+	}
+	return refs
+}
+
+// trackWrite runs write through r and returns the events of the changes it
+// made to the values of keys, to publish once it is committed. The hooks of
+// the keys are not looked up.
+func (s *kvService) trackWrite(ctx context.Context, r KvRepository, keys []keyRef, write func() error) ([]BusEvent, error) {
+	before := make([]keyState, len(keys))
+	for i, ref := range keys {
+		state, err := s.liveState(ctx, r.WithNamespace(ref.namespace), ref.key)
+		if err != nil {
+			return nil, err
+		}
+		before[i] = state
+	}
+	if err := write(); err != nil {
+		return nil, err
+	}
+	var events []BusEvent
+	for i, ref := range keys {
+		scoped := r.WithNamespace(ref.namespace)
+		after, err := s.liveState(ctx, scoped, ref.key)
+		if err != nil {
+			return nil, err
+		}
+		var newVal *string
+		if after.existed {
+			newVal = &after.val
+		}
+		c, err := s.keyChange(SkipHooks(ctx), scoped, ref.key, before[i], newVal)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, changeEvents(ref.namespace, []change{c})...)
+	}
+	return events, nil
+}
+
+// liveState reads the state of key for the events of a write. The value of
+// a secret that can not be decrypted is masked, it does not keep the write
+// from being made.
+func (s *kvService) liveState(ctx context.Context, r KvRepository, key string) (keyState, error) {
+	val, err := r.GetVal(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return keyState{}, nil
+	}
+	if err != nil {
+		return keyState{}, fmt.Errorf("could not get the current value of the %s key: %w", key, err)
+	}
+	plaintext, err := s.decrypt(r.Namespace(), key, val)
+	if err != nil {
+		plaintext = SecretMask
+	}
+	return keyState{val: plaintext, existed: true}, nil
+}
@@ -0,0 +1,136 @@
+package kv
+
+import (
+	"errors"
+	"fmt"
+)
+
+// The errors returned by the service and translated into by the
+// repositories. Match them with errors.Is.
+var (
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrHookNotFound     = errors.New("hook not found")
+	ErrAlreadyAttached  = errors.New("hook already attached")
+	ErrValidation       = errors.New("invalid input")
+	ErrConflict         = errors.New("conflict")
+	ErrInUse            = errors.New("still in use")
+	ErrKeyExists        = errors.New("key already exists")
+	ErrSnapshotNotFound = errors.New("snapshot not found")
+	ErrSnapshotExists   = errors.New("snapshot already exists")
+	ErrProfileNotFound  = errors.New("profile not found")
+	ErrHookTimeout      = errors.New("hook timed out")
+	// ErrSearchUnavailable is returned by Search when sqlite was built
+	// without FTS5.
+	ErrSearchUnavailable = errors.New("search is not available")
+)
+
+// ValidationError is returned when an argument is rejected before anything
+// is stored. It matches ErrValidation.
+type ValidationError struct {
+	Msg string
+	Err error
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// invalidf formats a ValidationError, a %w verb is unwrapped like with
+// fmt.Errorf.
+func invalidf(format string, a ...any) error {
+	err := fmt.Errorf(format, a...)
+	return &ValidationError{Msg: err.Error(), Err: errors.Unwrap(err)}
+}
+
+// ConflictError is returned by conditional writes when the stored version of
+// the key is not the one the caller expected. Actual is 0 when the key does
+// not exist. It matches ErrConflict.
+type ConflictError struct {
+	Key      string
+	Expected int64
+	Actual   int64
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("version conflict on the %s key: expected version %d, found %d", e.Key, e.Expected, e.Actual)
+}
+
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// HookError is returned by a write whose hooks could not be run, e.g. when
+// the context was canceled before they started. The write was committed,
+// only the hooks failed. The failures are also reported to the hook
+// reporter.
+type HookError struct {
+	Err error
+}
+
+func (e *HookError) Error() string {
+	return fmt.Sprintf("the write was committed but its hooks failed: %s", e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+// Exit codes of the command line, one per kind of error.
+const (
+	ExitOK                = 0
+	ExitFailure           = 1
+	ExitValidation        = 2
+	ExitKeyNotFound       = 3
+	ExitHookNotFound      = 4
+	ExitAlreadyAttached   = 5
+	ExitConflict          = 6
+	ExitInUse             = 7
+	ExitKeyExists         = 8
+	ExitSnapshotNotFound  = 9
+	ExitSnapshotExists    = 10
+	ExitProfileNotFound   = 11
+	ExitHookTimeout       = 12
+	ExitSearchUnavailable = 13
+)
+
+// ExitCode returns the exit code the command line should use for err.
+func ExitCode(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrValidation):
+		return ExitValidation
+	case errors.Is(err, ErrKeyNotFound):
+		return ExitKeyNotFound
+	case errors.Is(err, ErrHookNotFound):
+		return ExitHookNotFound
+	case errors.Is(err, ErrAlreadyAttached):
+		return ExitAlreadyAttached
+	case errors.Is(err, ErrConflict):
+		return ExitConflict
+	case errors.Is(err, ErrInUse):
+		return ExitInUse
+	case errors.Is(err, ErrKeyExists):
+		return ExitKeyExists
+	case errors.Is(err, ErrSnapshotNotFound):
+		return ExitSnapshotNotFound
+	case errors.Is(err, ErrSnapshotExists):
+		return ExitSnapshotExists
+	case errors.Is(err, ErrProfileNotFound):
+		return ExitProfileNotFound
+	case errors.Is(err, ErrHookTimeout):
+		return ExitHookTimeout
+	case errors.Is(err, ErrSearchUnavailable):
+		return ExitSearchUnavailable
+	default:
+		return ExitFailure
+	}
+}
@@ -0,0 +1,227 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// HookReport is the result of the hooks run for a change made by the
+// service. Err is set when the hooks could not be looked up or started, the
+// error of every hook is in its CmdOutput.
+type HookReport struct {
+	Key   string
+	Event Event
+	// Profile is set for the hooks run when the effective value of the key
+	// changed in a profile.
+	Profile string
+	Outputs []CmdOutput
+	Err     error
+}
+
+// WithHookReporter sets the function called with the result of the hooks
+// the service runs on its own, e.g. after Set or Delete.
+func WithHookReporter(report func(HookReport)) ServiceOption {
+	return func(s *kvService) {
+		s.report = report
+	}
+}
+
+type skipHooksKey struct{}
+
+// SkipHooks returns a context under which the service stores changes
+// without running the hooks attached to the changed keys. The changes are
+// still published to the subscribers.
+func SkipHooks(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipHooksKey{}, true)
+}
+
+func hooksSkipped(ctx context.Context) bool {
+	skip, _ := ctx.Value(skipHooksKey{}).(bool)
+	return skip || dispatchDeferred(ctx)
+}
+
+type deferDispatchKey struct{}
+
+// deferDispatch returns a context for the writes made inside a transaction
+// whose changes are dispatched by the caller once it is committed, they
+// neither run hooks nor publish events.
+func deferDispatch(ctx context.Context) context.Context {
+	return context.WithValue(ctx, deferDispatchKey{}, true)
+}
+
+func dispatchDeferred(ctx context.Context) bool {
+	deferred, _ := ctx.Value(deferDispatchKey{}).(bool)
+	return deferred
+}
+
+// keyState is the live value of a key before it is changed.
+type keyState struct {
+	val     string
+	existed bool
+	// stored is the value as stored, encrypted for a secret.
+	stored string
+	// deleteHooks are looked up before the key is changed, the attachments
+	// are deleted along with the key.
+	deleteHooks []Hook
+}
+
+// change is a stored write whose hooks run once it is committed.
+type change struct {
+	key    string
+	event  Event
+	oldVal string
+	newVal string
+	hooks  []Hook
+	// profile is set for a change of the effective value in a profile.
+	profile string
+	// effective are the changes the write made to the effective value of
+	// the key in the profiles using its namespace.
+	effective []change
+}
+
+// snapshot reads the state of key before a write made through r.
+func (s *kvService) snapshot(ctx context.Context, r KvRepository, key string, deleting bool) (keyState, error) {
+	val, err := r.GetVal(ctx, key)
+	if errors.Is(err, ErrKeyNotFound) {
+		return keyState{}, nil
+	}
+	if err != nil {
+		return keyState{}, fmt.Errorf("could not get the current value of the %s key: %w", key, err)
+	}
+	state := keyState{existed: true, stored: val}
+	state.val, err = s.decrypt(r.Namespace(), key, val)
+	if err != nil {
+		return keyState{}, err
+	}
+	if deleting && !hooksSkipped(ctx) {
+		state.deleteHooks, err = r.GetHooksForEvent(ctx, key, EventDelete)
+		if err != nil {
+			return keyState{}, fmt.Errorf("failed to get the hooks attached to the %s key: %w", key, err)
+		}
+	}
+	return state, nil
+}
+
+// changeOf compares the state of key before a write with its new value, nil
+// when it was deleted, and looks up the hooks to run, including the hooks of
+// the profiles whose effective value changed. Writes that leave the value as
+// it was run no hooks.
+func (s *kvService) changeOf(ctx context.Context, r KvRepository, key string, before keyState, newVal *string) (change, error) {
+	c, err := s.keyChange(ctx, r, key, before, newVal)
+	if err != nil || hooksSkipped(ctx) {
+		return c, err
+	}
+	c.effective, err = s.effectiveChanges(ctx, r, key, before, newVal)
+	return c, err
+}
+
+func (s *kvService) keyChange(ctx context.Context, r KvRepository, key string, before keyState, newVal *string) (change, error) {
+	c := change{key: key, oldVal: before.val}
+	switch {
+	case newVal == nil && !before.existed:
+		return c, nil
+	case newVal == nil:
+		c.event = EventDelete
+		c.hooks = before.deleteHooks
+		return c, nil
+	case !before.existed:
+		c.event = EventCreate
+	case before.val == *newVal:
+		return c, nil
+	default:
+		c.event = EventUpdate
+	}
+	c.newVal = *newVal
+	if hooksSkipped(ctx) {
+		return c, nil
+	}
+	hooks, err := s.hooksFor(ctx, r, key, c.event)
+	if err != nil {
+		return c, err
+	}
+	c.hooks = hooks
+	return c, nil
+}
+
+// hooksFor returns the hooks attached to key for the event. Hooks attached
+// for EventSet run on both creates and updates.
+func (s *kvService) hooksFor(ctx context.Context, r KvRepository, key string, event Event) ([]Hook, error) {
+	hooks, err := collectHooks(event, func(event Event) ([]Hook, error) {
+		return r.GetHooksForEvent(ctx, key, event)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the hooks attached to the %s key: %w", key, err)
+	}
+	return hooks, nil
+}
+
+// collectHooks returns the hooks attached for the event, without
+// duplicates, using lookup to get the hooks attached for every event.
+func collectHooks(event Event, lookup func(Event) ([]Hook, error)) ([]Hook, error) {
+	events := []Event{event}
+	if event == EventCreate || event == EventUpdate {
+		events = append(events, EventSet)
+	}
+	var hooks []Hook
+	seen := make(map[string]bool)
+	for _, event := range events {
+		attached, err := lookup(event)
+		if err != nil {
+			return nil, err
+		}
+		for _, hook := range attached {
+			if !seen[hook.Name] {
+				seen[hook.Name] = true
+				hooks = append(hooks, hook)
+			}
+		}
+	}
+	return hooks, nil
+}
+
+// dispatch publishes committed changes, runs their hooks and reports their
+// results. The new value is passed as the argument and in NEW_VAL, the previous one
+// in OLD_VAL, the key in KVZ_KEY and, for the changes of an effective value,
+// the profile in KVZ_PROFILE. The returned error is a HookError joining the
+// errors of the changes whose hooks could not be started.
+func (s *kvService) dispatch(ctx context.Context, changes ...change) ([]CmdOutput, error) {
+	if dispatchDeferred(ctx) {
+		return nil, nil
+	}
+	s.publishChanges(ctx, changes)
+	if hooksSkipped(ctx) {
+		return nil, nil
+	}
+	var all []change
+	for _, c := range changes {
+		all = append(all, c)
+		all = append(all, c.effective...)
+	}
+	var cmdOutputs []CmdOutput
+	var errs []error
+	for _, c := range all {
+		if c.event == "" || len(c.hooks) == 0 {
+			continue
+		}
+		env := []string{fmt.Sprintf("OLD_VAL=%s", c.oldVal), fmt.Sprintf("KVZ_KEY=%s", c.key)}
+		if c.profile != "" {
+			env = append(env, fmt.Sprintf("KVZ_PROFILE=%s", c.profile))
+		}
+		outputs, err := s.runHooks(ctx, c.hooks, c.newVal, c.event, env...)
+		cmdOutputs = append(cmdOutputs, outputs...)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to run the %s hooks of the %s key: %w", c.event, c.key, err))
+		}
+		for _, output := range outputs {
+			s.bus.publish(ctx, HookExecuted{Namespace: s.Namespace(), Key: c.key, Event: c.event, Profile: c.profile, Output: output})
+		}
+		if s.report != nil {
+			s.report(HookReport{Key: c.key, Event: c.event, Profile: c.profile, Outputs: outputs, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return cmdOutputs, &HookError{Err: errors.Join(errs...)}
+	}
+	return cmdOutputs, nil
+}
@@ -0,0 +1,212 @@
+package kv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Format is a serialization of the data moved by Export and Import.
+type Format string
+
+const (
+	FormatJSON Format = "json"
+	FormatYAML Format = "yaml"
+	FormatTOML Format = "toml"
+	// FormatDotenv only holds keys and values, one KEY=value per line.
+	FormatDotenv Format = "dotenv"
+)
+
+var formats = []Format{FormatJSON, FormatYAML, FormatTOML, FormatDotenv}
+
+func ParseFormat(name string) (Format, error) {
+	for _, f := range formats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+	return "", invalidf("unknown format '%s', expected one of %v", name, formats)
+}
+
+// Dump is the content of a namespace written by Export and read by Import.
+type Dump struct {
+	Keys  []DumpKey  `json:"keys" yaml:"keys" toml:"keys"`
+	Hooks []DumpHook `json:"hooks,omitempty" yaml:"hooks,omitempty" toml:"hooks,omitempty"`
+}
+
+// DumpKey is a key with its metadata and, when hooks are exported, the
+// hooks attached to it.
+type DumpKey struct {
+	Key         string           `json:"key" yaml:"key" toml:"key"`
+	Val         string           `json:"val" yaml:"val" toml:"val"`
+	Secret      bool             `json:"secret,omitempty" yaml:"secret,omitempty" toml:"secret,omitempty"`
+	Type        ValueType        `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Description string           `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	Owner       string           `json:"owner,omitempty" yaml:"owner,omitempty" toml:"owner,omitempty"`
+	Tags        []string         `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`
+	ExpiresAt   *time.Time       `json:"expires_at,omitempty" yaml:"expires_at,omitempty" toml:"expires_at,omitempty"`
+	Hooks       []DumpAttachment `json:"hooks,omitempty" yaml:"hooks,omitempty" toml:"hooks,omitempty"`
+}
+
+type DumpAttachment struct {
+	Hook   string  `json:"hook" yaml:"hook" toml:"hook"`
+	Events []Event `json:"events" yaml:"events" toml:"events"`
+}
+
+// DumpHook is a hook definition. Filepath is set for hooks running a local
+// file, Script holds the script or the content of the file otherwise.
+type DumpHook struct {
+	Name     string `json:"name" yaml:"name" toml:"name"`
+	Script   string `json:"script,omitempty" yaml:"script,omitempty" toml:"script,omitempty"`
+	IsFile   bool   `json:"is_file,omitempty" yaml:"is_file,omitempty" toml:"is_file,omitempty"`
+	Filepath string `json:"filepath,omitempty" yaml:"filepath,omitempty" toml:"filepath,omitempty"`
+	// Timeout is a duration such as 30s, empty when the hook has none.
+	Timeout string `json:"timeout,omitempty" yaml:"timeout,omitempty" toml:"timeout,omitempty"`
+}
+
+// timeout parses the timeout of the hook, 0 when it has none.
+func (h DumpHook) timeout() (time.Duration, error) {
+	if h.Timeout == "" {
+		return 0, nil
+	}
+	timeout, err := time.ParseDuration(h.Timeout)
+	if err != nil || timeout < time.Millisecond {
+		return 0, invalidf("invalid timeout '%s' for the %s hook", h.Timeout, h.Name)
+	}
+	return timeout, nil
+}
+
+func encodeDump(w io.Writer, format Format, dump Dump) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(dump)
+	case FormatYAML:
+		return yaml.NewEncoder(w).Encode(dump)
+	case FormatTOML:
+		return toml.NewEncoder(w).Encode(dump)
+	case FormatDotenv:
+		return encodeDotenv(w, dump)
+	default:
+		_, err := ParseFormat(string(format))
+		return err
+	}
+}
+
+func decodeDump(r io.Reader, format Format) (Dump, error) {
+	var dump Dump
+	var err error
+	switch format {
+	case FormatJSON:
+		decoder := json.NewDecoder(r)
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&dump)
+	case FormatYAML:
+		decoder := yaml.NewDecoder(r)
+		decoder.SetStrict(true)
+		err = decoder.Decode(&dump)
+		if err == io.EOF {
+			err = nil
+		}
+	case FormatTOML:
+		var meta toml.MetaData
+		meta, err = toml.NewDecoder(r).Decode(&dump)
+		if err == nil && len(meta.Undecoded()) > 0 {
+			err = fmt.Errorf("unknown fields %v", meta.Undecoded())
+		}
+	case FormatDotenv:
+		dump, err = decodeDotenv(r)
+	default:
+		_, err = ParseFormat(string(format))
+		return Dump{}, err
+	}
+	if err != nil {
+		return Dump{}, invalidf("invalid %s: %w", format, err)
+	}
+	return dump, nil
+}
+
+// dotenvKeyPattern matches the keys that can be written to a dotenv file.
+var dotenvKeyPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+var dotenvEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`, "$", `\$`)
+
+// encodeDotenv writes every value double quoted so it reads back unchanged.
+func encodeDotenv(w io.Writer, dump Dump) error {
+	for _, key := range dump.Keys {
+		if !dotenvKeyPattern.MatchString(key.Key) {
+			return invalidf("the %s key can not be written to a dotenv file", key.Key)
+		}
+		if _, err := fmt.Fprintf(w, "%s=\"%s\"\n", key.Key, dotenvEscaper.Replace(key.Val)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var dotenvUnescaper = map[byte]string{'\\': `\`, '"': `"`, 'n': "\n", 'r': "\r", 't': "\t", '$': "$"}
+
+// decodeDotenv reads KEY=value lines. Values may be double quoted with
+// backslash escapes, single quoted taken literally, or bare with an
+// optional trailing comment. Blank lines, comments and a leading "export"
+// are ignored.
+func decodeDotenv(r io.Reader) (Dump, error) {
+	var dump Dump
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, val, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || !dotenvKeyPattern.MatchString(key) {
+			return Dump{}, fmt.Errorf("line %d: expected KEY=value", n)
+		}
+		val = strings.TrimSpace(val)
+		switch {
+		case strings.HasPrefix(val, `"`):
+			var b strings.Builder
+			closed := false
+			for i := 1; i < len(val); i++ {
+				if val[i] == '"' {
+					closed = i == len(val)-1 || strings.HasPrefix(strings.TrimSpace(val[i+1:]), "#")
+					break
+				}
+				if val[i] == '\\' && i+1 < len(val) {
+					if unescaped, ok := dotenvUnescaper[val[i+1]]; ok {
+						b.WriteString(unescaped)
+						i++
+						continue
+					}
+				}
+				b.WriteByte(val[i])
+			}
+			if !closed {
+				return Dump{}, fmt.Errorf("line %d: invalid double quoted value", n)
+			}
+			val = b.String()
+		case strings.HasPrefix(val, "'"):
+			end := strings.Index(val[1:], "'")
+			if end < 0 {
+				return Dump{}, fmt.Errorf("line %d: unterminated single quoted value", n)
+			}
+			val = val[1 : end+1]
+		default:
+			if i := strings.Index(val, " #"); i >= 0 {
+				val = strings.TrimSpace(val[:i])
+			}
+		}
+		dump.Keys = append(dump.Keys, DumpKey{Key: key, Val: val})
+	}
+	return dump, scanner.Err()
+}
@@ -0,0 +1,75 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Revision is a single recorded write of a key. Deleted revisions mark the
+// point where the key was removed and carry no value. History masks the
+// values of secret keys.
+type Revision struct {
+	Revision  int64
+	Key       string
+	Val       string
+	Deleted   bool
+	ChangedAt time.Time
+}
+
+func (s *kvService) History(ctx context.Context, key string) ([]Revision, error) {
+	if key == "" {
+		return nil, invalidf("key may not be empty")
+	}
+	revisions, err := s.r.ListRevisions(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the history of the %s key: %w", key, err)
+	}
+	if len(revisions) == 0 {
+		return nil, fmt.Errorf("%w: the key %s has no recorded history", ErrKeyNotFound, key)
+	}
+	for i := range revisions {
+		if isEncrypted(revisions[i].Val) {
+			revisions[i].Val = SecretMask
+		}
+	}
+	return revisions, nil
+}
+
+func (s *kvService) GetAtRevision(ctx context.Context, key string, revision int64) (string, error) {
+	if key == "" {
+		return "", invalidf("key may not be empty")
+	}
+	rev, err := s.r.GetRevision(ctx, key, revision)
+	if err != nil {
+		return "", fmt.Errorf("failed to get revision %d of the %s key: %w", revision, key, err)
+	}
+	if rev.Deleted {
+		return "", fmt.Errorf("%w: the key %s was deleted at revision %d", ErrKeyNotFound, key, revision)
+	}
+	return s.decrypt(s.Namespace(), key, rev.Val)
+}
+
+func (s *kvService) GetAt(ctx context.Context, key string, at time.Time) (string, error) {
+	if key == "" {
+		return "", invalidf("key may not be empty")
+	}
+	rev, err := s.r.GetRevisionAt(ctx, key, at)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the value of the %s key at %s: %w", key, at.Format(time.RFC3339), err)
+	}
+	if rev.Deleted {
+		return "", fmt.Errorf("%w: the key %s did not exist at %s", ErrKeyNotFound, key, at.Format(time.RFC3339))
+	}
+	return s.decrypt(s.Namespace(), key, rev.Val)
+}
+
+// Rollback restores the value a key had at the given revision. The restored
+// value is written with Set so it is recorded as a new revision.
+func (s *kvService) Rollback(ctx context.Context, key string, revision int64) error {
+	val, err := s.GetAtRevision(ctx, key, revision)
+	if err != nil {
+		return fmt.Errorf("unable to roll back the %s key: %w", key, err)
+	}
+	return s.Set(ctx, key, val)
+}
@@ -0,0 +1,101 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// HookKillGrace is how long a hook has to exit once it was sent SIGTERM,
+// the processes of its group still running afterwards get SIGKILL.
+const HookKillGrace = 5 * time.Second
+
+// DefaultPerHookTimeout sets the global timeout, used by every hook that has
+// no timeout of its own. Like the timeout of a hook, it bounds each hook on
+// its own: the hooks run after a single call may take longer in total.
+// There is no timeout by default.
+func DefaultPerHookTimeout(timeout time.Duration) ServiceOption {
+	return func(s *kvService) {
+		s.hookTimeout = timeout
+	}
+}
+
+// WithHookTimeout sets the timeout of every hook run after the write,
+// whatever the timeout of the hook. A zero timeout lets the hooks run until
+// they exit. The other calls running hooks take it through
+// OverrideHookTimeout.
+func WithHookTimeout(timeout time.Duration) SetOption {
+	return func(o *setOptions) {
+		o.hookTimeout = &timeout
+	}
+}
+
+// WithDeleteHookTimeout is WithHookTimeout for the hooks run after Delete.
+func WithDeleteHookTimeout(timeout time.Duration) DeleteOption {
+	return func(o *deleteOptions) {
+		o.hookTimeout = &timeout
+	}
+}
+
+type hookTimeoutKey struct{}
+
+// OverrideHookTimeout returns a context under which every hook the service
+// runs, e.g. from ExecHooks, Apply, Import or PurgeExpired, gets timeout
+// instead of the timeout of the hook or the global one. A zero timeout lets
+// the hooks run until they exit, a negative one is ignored.
+func OverrideHookTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	if timeout < 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, hookTimeoutKey{}, timeout)
+}
+
+// overrideHookTimeout is OverrideHookTimeout for the timeout of an option,
+// ctx when it is nil.
+func overrideHookTimeout(ctx context.Context, timeout *time.Duration) context.Context {
+	if timeout == nil {
+		return ctx
+	}
+	return OverrideHookTimeout(ctx, *timeout)
+}
+
+func validateHookTimeout(timeout *time.Duration) error {
+	if timeout != nil && *timeout < 0 {
+		return invalidf("the timeout of the hooks may not be negative")
+	}
+	return nil
+}
+
+// timeoutOf returns the timeout of the hook when run under ctx, 0 when it
+// has none.
+func (s *kvService) timeoutOf(ctx context.Context, hook Hook) time.Duration {
+	if timeout, ok := ctx.Value(hookTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	if hook.Timeout > 0 {
+		return hook.Timeout
+	}
+	return s.hookTimeout
+}
+
+// SetHookTimeout stores the timeout of the hook, 0 removes it. The timeout
+// is rounded down to the millisecond.
+func (s *kvService) SetHookTimeout(ctx context.Context, name string, timeout time.Duration) error {
+	if name == "" {
+		return invalidf("hook name may not be empty")
+	}
+	if timeout < 0 {
+		return invalidf("the timeout of a hook may not be negative")
+	}
+	if timeout > 0 && timeout < time.Millisecond {
+		return invalidf("the timeout of a hook must be at least 1ms")
+	}
+	updated, err := s.r.SetHookTimeout(ctx, name, timeout)
+	if err != nil {
+		return fmt.Errorf("failed to set the timeout of the %s hook: %w", name, err)
+	}
+	if !updated {
+		return fmt.Errorf("%w: %s", ErrHookNotFound, name)
+	}
+	return nil
+}
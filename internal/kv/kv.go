@@ -5,38 +5,193 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"time"
 )
 
 type KvService interface {
-	Set(key string, val string) (err error)
-	Get(key string) (val string, err error)
-	Delete(key string) error
-	AttachHook(key string, hook string) error
-	ListKeys() ([]string, error)
-	ListHooks() ([]string, error)
-	GetAttachedHooks(key string) ([]Hook, error)
-	SetFilePathHook(name string, filepath string) error
-	SetFileHook(name string, content string) error
-	SetScriptHook(key string, hook string) error
-	ExecHooks(hooks []Hook, newVal string) ([]CmdOutput, error)
-	DeleteHook(name string) error
+	Set(ctx context.Context, key string, val string, opts ...SetOption) (err error)
+	Get(ctx context.Context, key string) (val string, err error)
+	Delete(ctx context.Context, key string, opts ...DeleteOption) error
+	AttachHook(ctx context.Context, key string, hook string, events ...Event) error
+	ListKeys(ctx context.Context) ([]string, error)
+	ListHooks(ctx context.Context) ([]string, error)
+	GetAttachedHooks(ctx context.Context, key string) ([]Hook, error)
+	SetFilePathHook(ctx context.Context, name string, filepath string) error
+	SetFileHook(ctx context.Context, name string, content string) error
+	SetScriptHook(ctx context.Context, key string, hook string) error
+	SetHookTimeout(ctx context.Context, name string, timeout time.Duration) error
+	ExecHooks(ctx context.Context, hooks []Hook, newVal string) ([]CmdOutput, error)
+	DeleteHook(ctx context.Context, name string, opts ...DeleteOption) error
+	History(ctx context.Context, key string) ([]Revision, error)
+	GetAtRevision(ctx context.Context, key string, revision int64) (string, error)
+	GetAt(ctx context.Context, key string, at time.Time) (string, error)
+	Rollback(ctx context.Context, key string, revision int64) error
+	Namespace() string
+	WithNamespace(namespace string) (KvService, error)
+	ListNamespaces(ctx context.Context) ([]string, error)
+	ExportNamespace(ctx context.Context, namespace string) ([]Entry, error)
+	DeleteNamespace(ctx context.Context, namespace string) error
+	DeclareType(ctx context.Context, key string, valueType ValueType) error
+	GetType(ctx context.Context, key string) (ValueType, error)
+	GetTyped(ctx context.Context, key string) (any, error)
+	PurgeExpired(ctx context.Context) ([]CmdOutput, error)
+	GetWithVersion(ctx context.Context, key string) (val string, version int64, err error)
+	SetIfVersion(ctx context.Context, key string, val string, version int64, opts ...SetOption) error
+	Apply(ctx context.Context, ops []Op) ([]CmdOutput, error)
+	ListKeysPage(ctx context.Context, opts ListOptions) (Page, error)
+	ListHooksPage(ctx context.Context, opts ListOptions) (Page, error)
+	Info(ctx context.Context, key string) (KeyInfo, error)
+	SetDescription(ctx context.Context, key string, description string) error
+	SetOwner(ctx context.Context, key string, owner string) error
+	AddTags(ctx context.Context, key string, tags ...string) error
+	RemoveTags(ctx context.Context, key string, tags ...string) error
+	DetachHook(ctx context.Context, key string, hook string) error
+	DetachAllHooks(ctx context.Context, key string) (int64, error)
+	GetHookKeys(ctx context.Context, hook string) ([]string, error)
+	AttachHookMatching(ctx context.Context, opts ListOptions, hook string, events ...Event) ([]string, error)
+	DetachHookMatching(ctx context.Context, opts ListOptions, hook string) ([]string, error)
+	Rename(ctx context.Context, key string, newKey string) error
+	Copy(ctx context.Context, key string, newKey string) error
+	RenameMatching(ctx context.Context, pattern string, replacement string, opts ...RenameOption) ([]KeyRename, error)
+	Incr(ctx context.Context, key string, delta int64) (int64, error)
+	Decr(ctx context.Context, key string, delta int64) (int64, error)
+	Append(ctx context.Context, key string, suffix string) (string, error)
+	ListPush(ctx context.Context, key string, vals ...string) ([]string, error)
+	ListPop(ctx context.Context, key string) (string, error)
+	ListRemove(ctx context.Context, key string, val string) (int, error)
+	Search(ctx context.Context, query string, limit int) ([]SearchResult, error)
+	Export(ctx context.Context, w io.Writer, format Format, opts ...ExportOption) error
+	Import(ctx context.Context, r io.Reader, format Format, opts ...ImportOption) (ImportResult, error)
+	CreateSnapshot(ctx context.Context, name string) error
+	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	DiffSnapshot(ctx context.Context, name string) ([]SnapshotDiff, error)
+	RestoreSnapshot(ctx context.Context, name string, keys ...string) error
+	DeleteSnapshot(ctx context.Context, name string) error
+	QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	SetProfile(ctx context.Context, name string, layers ...string) error
+	GetProfile(ctx context.Context, name string) (Profile, error)
+	ListProfiles(ctx context.Context) ([]Profile, error)
+	DeleteProfile(ctx context.Context, name string) error
+	WithProfile(ctx context.Context, name string) (KvService, error)
+	Profile() Profile
+	Resolve(ctx context.Context, key string) (Resolved, error)
+	AttachProfileHook(ctx context.Context, profile string, key string, hook string, events ...Event) error
+	DetachProfileHook(ctx context.Context, profile string, key string, hook string) error
+	GetSchema(ctx context.Context) (Schema, error)
+	SetSchema(ctx context.Context, schema Schema) error
+	DeleteSchema(ctx context.Context) error
+	Validate(ctx context.Context) ([]SchemaViolation, error)
+	Watch(ctx context.Context, prefix string, opts ...WatchOption) (<-chan ChangeEvent, error)
+	Prune(ctx context.Context, retention Retention) (PruneResult, error)
+	Subscribe(opts ...SubscribeOption) (*Subscription, error)
+	SubscribeFunc(fn func(BusEvent), opts ...SubscribeOption) (*Subscription, error)
+	PublishTemplateRendered(ctx context.Context, event TemplateRendered)
 }
 type KvRepository interface {
 	GetVal(ctx context.Context, key string) (val string, err error)
-	SetVal(ctx context.Context, key string, val string) error
+	SetVal(ctx context.Context, key string, val string, expiresAt time.Time, secret bool) error
 	DeleteKey(ctx context.Context, key string) error
 	SetScriptHook(ctx context.Context, name string, script string) error
+	SetHookTimeout(ctx context.Context, name string, timeout time.Duration) (bool, error)
 	SetFilePathHook(ctx context.Context, name string, filepath string) error
 	SetFileHook(ctx context.Context, name string, content string) error
-	AttachHook(ctx context.Context, key string, hook string) error
+	AttachHook(ctx context.Context, key string, hook string, events []Event) error
 	ListKeys(ctx context.Context) ([]string, error)
 	ListHooks(ctx context.Context) ([]string, error)
 	GetAttachedHooks(ctx context.Context, key string) ([]Hook, error)
 	KeyExists(ctx context.Context, key string) (bool, error)
 	HookExists(ctx context.Context, name string) (bool, error)
+	GetHookKeys(ctx context.Context, hook string) ([]string, error)
+	DetachHook(ctx context.Context, key string, hook string) (bool, error)
+	DetachAllHooks(ctx context.Context, key string) (int64, error)
+	// RenameKey and CopyKey store val as the value of newKey, the value of a
+	// secret is encrypted for the key it is stored in. A type declared for
+	// newKey is kept.
+	RenameKey(ctx context.Context, key string, newKey string, val string) error
+	CopyKey(ctx context.Context, key string, newKey string, val string) error
+	// Search runs an FTS5 query, a limit of 0 returns every match.
+	Search(ctx context.Context, match string, limit int) ([]SearchResult, error)
+	ExportHooks(ctx context.Context) ([]Hook, error)
+	ExportAttachments(ctx context.Context) ([]Attachment, error)
+	// The snapshots cover every namespace, RestoreSnapshotKey restores a
+	// key of the namespace of the repository.
+	CreateSnapshot(ctx context.Context, name string) error
+	ListSnapshots(ctx context.Context) ([]Snapshot, error)
+	SnapshotExists(ctx context.Context, name string) (bool, error)
+	SnapshotKeyExists(ctx context.Context, name string, key string) (bool, error)
+	// DiffSnapshot leaves out the values of secrets, their ciphertexts
+	// differ on every encryption. DiffSnapshotSecrets returns the secrets
+	// whose ciphertexts differ, to compare once decrypted.
+	DiffSnapshot(ctx context.Context, name string) ([]SnapshotDiff, error)
+	DiffSnapshotSecrets(ctx context.Context, name string) ([]SecretDiff, error)
+	RestoreSnapshot(ctx context.Context, name string) error
+	RestoreSnapshotKey(ctx context.Context, name string, key string) error
+	DeleteSnapshot(ctx context.Context, name string) (bool, error)
 	DeleteHook(ctx context.Context, name string) error
+	ListRevisions(ctx context.Context, key string) ([]Revision, error)
+	GetRevision(ctx context.Context, key string, revision int64) (Revision, error)
+	GetRevisionAt(ctx context.Context, key string, at time.Time) (Revision, error)
+	// ListPlainVals returns the distinct values of key kept in plain text in
+	// its history, its changes and the snapshots, SealVal replaces one of
+	// them with its encrypted form.
+	ListPlainVals(ctx context.Context, key string) ([]string, error)
+	SealVal(ctx context.Context, key string, val string, encrypted string) error
+	Namespace() string
+	WithNamespace(namespace string) KvRepository
+	ListNamespaces(ctx context.Context) ([]string, error)
+	ExportNamespace(ctx context.Context, namespace string) ([]Entry, error)
+	DeleteNamespace(ctx context.Context, namespace string) error
+	GetKeyType(ctx context.Context, key string) (ValueType, error)
+	SetKeyType(ctx context.Context, key string, valueType ValueType) error
+	GetHooksForEvent(ctx context.Context, key string, event Event) ([]Hook, error)
+	ListExpired(ctx context.Context) ([]Entry, error)
+	DeleteExpiredKey(ctx context.Context, key string) (bool, error)
+	GetValWithVersion(ctx context.Context, key string) (val string, version int64, err error)
+	SetValIfVersion(ctx context.Context, key string, val string, expiresAt time.Time, secret bool, version int64) (bool, error)
+	Transact(ctx context.Context, fn func(KvRepository) error) error
+	ListKeysPage(ctx context.Context, opts ListOptions) ([]string, error)
+	ListHooksPage(ctx context.Context, opts ListOptions) ([]string, error)
+	GetKeyInfo(ctx context.Context, key string) (KeyInfo, error)
+	SetDescription(ctx context.Context, key string, description string) error
+	SetOwner(ctx context.Context, key string, owner string) error
+	AddTag(ctx context.Context, key string, tag string) error
+	RemoveTag(ctx context.Context, key string, tag string) error
+	IsSecret(ctx context.Context, key string) (bool, error)
+	AppendAudit(ctx context.Context, entry AuditEntry) error
+	QueryAudit(ctx context.Context, filter AuditFilter) ([]AuditEntry, error)
+	// Profiles are shared by every namespace. GetProfile returns no layers
+	// when the profile does not exist, ProfilesWithLayer the profiles using
+	// the namespace as a layer, AttachProfileHook attaches a hook of the
+	// namespace of the repository and GetHookProfileKeys returns the keys of
+	// profiles such a hook is attached to.
+	SetProfile(ctx context.Context, name string, layers []string) error
+	GetProfile(ctx context.Context, name string) ([]string, error)
+	ListProfiles(ctx context.Context) ([]Profile, error)
+	ProfilesWithLayer(ctx context.Context, namespace string) ([]Profile, error)
+	DeleteProfile(ctx context.Context, name string) (bool, error)
+	AttachProfileHook(ctx context.Context, profile string, key string, hook string, events []Event) error
+	DetachProfileHook(ctx context.Context, profile string, key string, hook string) (bool, error)
+	GetProfileHooksForEvent(ctx context.Context, profile string, key string, event Event) ([]Hook, error)
+	GetHookProfileKeys(ctx context.Context, hook string) ([]ProfileKey, error)
+	// The schema of the namespace of the repository is stored as a JSON
+	// document, GetSchema returns "" when there is none and ListSchemas the
+	// documents of every namespace.
+	GetSchema(ctx context.Context) (string, error)
+	SetSchema(ctx context.Context, document string) error
+	DeleteSchema(ctx context.Context) (bool, error)
+	ListSchemas(ctx context.Context) (map[string]string, error)
+	// LastChange returns the revision of the last change recorded in the
+	// feed of every namespace, 0 when it is empty.
+	LastChange(ctx context.Context) (int64, error)
+	ListChanges(ctx context.Context, prefix string, after int64, limit int) ([]ChangeEvent, error)
+	// Prune deletes the changes and the revisions recorded before the time,
+	// unless it is zero, and beyond the latest maxChanges changes and
+	// maxRevisions revisions of every key, unless they are 0. The latest
+	// revision of every key is kept.
+	Prune(ctx context.Context, before time.Time, maxChanges int, maxRevisions int) (PruneResult, error)
 }
 
 type Hook struct {
@@ -45,61 +200,248 @@ type Hook struct {
 	IsFile      bool
 	IsLocalFile bool
 	Filepath    string
+	// Timeout is how long the hook may run, 0 when it has no timeout of its
+	// own.
+	Timeout time.Duration
 }
 
+// Attachment is a hook attached to a key for some events.
+type Attachment struct {
+	Key    string
+	Hook   string
+	Events []Event
+}
+
+// Event identifies what happened to a key when its hooks are run. Hooks are
+// attached for one or more events.
+type Event string
+
+const (
+	// EventSet is any write of a value, hooks attached for it run on both
+	// creates and updates.
+	EventSet    Event = "set"
+	EventCreate Event = "create"
+	EventUpdate Event = "update"
+	EventDelete Event = "delete"
+	EventExpire Event = "expire"
+)
+
 type kvService struct {
-	r KvRepository
+	r      KvRepository
+	cipher Cipher
+	report func(HookReport)
+	actor  Actor
+	// profile is set when Get reads through the layers of a profile.
+	profile Profile
+	// schema replaces the stored schemas when it is set.
+	schema *Schema
+	bus    *eventBus
+	// hookTimeout applies to the hooks without a timeout of their own.
+	hookTimeout time.Duration
+}
+
+// withRepository returns a copy of the service that uses r, e.g. a
+// repository bound to a transaction or to another namespace.
+func (s *kvService) withRepository(r KvRepository) *kvService {
+	scoped := *s
+	scoped.r = r
+	return &scoped
+}
+
+type setOptions struct {
+	ttl       time.Duration
+	expiresAt time.Time
+	secret    bool
+	// seal is set by AsSecret, the values the key kept in plain text before
+	// it was made secret are encrypted along with the write.
+	seal bool
+	// hookTimeout overrides the timeout of the hooks run after the write.
+	hookTimeout *time.Duration
+	// stored is the value written to the repository, encrypted for secrets.
+	stored string
+}
+
+type SetOption func(*setOptions)
+
+// WithTTL makes the key expire once ttl has elapsed.
+func WithTTL(ttl time.Duration) SetOption {
+	return func(o *setOptions) {
+		o.ttl = ttl
+	}
+}
+
+// prepareSet validates a write of val to key and resolves the options it
+// was given.
+// reuseCiphertext keeps the stored ciphertext of a secret written again with
+// the same value. A new encryption would differ and be recorded as a change
+// in the history and the change feed.
+func (o *setOptions) reuseCiphertext(before keyState, val string) {
+	if o.secret && before.existed && before.val == val && isEncrypted(before.stored) {
+		o.stored = before.stored
+	}
+}
+
+// purgeExpiredKey deletes key if it expired but was not purged yet, so a
+// write creates it afresh instead of reusing its metadata and attachments.
+func purgeExpiredKey(ctx context.Context, r KvRepository, key string) error {
+	if _, err := r.DeleteExpiredKey(ctx, key); err != nil {
+		return fmt.Errorf("failed to purge the expired %s key: %w", key, err)
+	}
+	return nil
 }
 
-func (s *kvService) Set(key string, val string) error {
+func (s *kvService) prepareSet(ctx context.Context, key string, val string, opts []SetOption) (setOptions, error) {
+	var options setOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	if key == "" {
-		return fmt.Errorf("key should not be empty")
+		return options, invalidf("key should not be empty")
 	}
 	if val == "" {
-		return fmt.Errorf("value should not be empty for key: %s", key)
+		return options, invalidf("value should not be empty for key: %s", key)
 	}
-	ctx := context.Background()
-	err := s.r.SetVal(ctx, key, val)
-	if err != nil {
-		return fmt.Errorf("failed to set a value to the %s key: %w", key, err)
+	if options.ttl < 0 {
+		return options, invalidf("ttl may not be negative for key: %s", key)
 	}
-	return nil
+	if err := validateHookTimeout(options.hookTimeout); err != nil {
+		return options, err
+	}
+	if err := s.checkType(ctx, key, val); err != nil {
+		return options, err
+	}
+	if err := s.checkSchema(ctx, key, val); err != nil {
+		return options, err
+	}
+	if options.ttl > 0 {
+		options.expiresAt = time.Now().Add(options.ttl)
+	}
+	if !options.secret {
+		secret, err := s.isSecret(ctx, key)
+		if err != nil {
+			return options, err
+		}
+		options.secret = secret
+	}
+	options.stored = val
+	if !options.secret && isEncrypted(val) {
+		return options, invalidf("only secret values may start with %s", encryptedPrefix)
+	}
+	if options.secret {
+		encrypted, err := s.encrypt(s.Namespace(), key, val)
+		if err != nil {
+			return options, err
+		}
+		options.stored = encrypted
+	}
+	return options, nil
 }
 
-func (s *kvService) Get(key string) (val string, err error) {
-	ctx := context.Background()
-	val, err = s.r.GetVal(ctx, key)
+// Set stores the value of key and runs the hooks attached to it once the
+// write is committed. A *HookError is returned when the value was stored but
+// the hooks could not be run.
+func (s *kvService) Set(ctx context.Context, key string, val string, opts ...SetOption) error {
+	var options setOptions
+	var c change
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := purgeExpiredKey(ctx, r, key); err != nil {
+			return err
+		}
+		var err error
+		options, err = s.withRepository(r).prepareSet(ctx, key, val, opts)
+		if err != nil {
+			return err
+		}
+		before, err := s.snapshot(ctx, r, key, false)
+		if err != nil {
+			return err
+		}
+		options.reuseCiphertext(before, val)
+		err = r.SetVal(ctx, key, options.stored, options.expiresAt, options.secret)
+		if err != nil {
+			return fmt.Errorf("failed to set a value to the %s key: %w", key, err)
+		}
+		if options.seal {
+			if err := s.sealPlainVals(ctx, r, key); err != nil {
+				return err
+			}
+		}
+		c, err = s.changeOf(ctx, r, key, before, &val)
+		return err
+	})
 	if err != nil {
-		return "", fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+		return err
 	}
-	return val, nil
+	_, err = s.dispatch(overrideHookTimeout(ctx, options.hookTimeout), c)
+	return err
 }
 
-func (s *kvService) Delete(key string) error {
-	if key == "" {
-		return errors.New("must specify key")
+// Get returns the value of key, or the default declared by the schema when
+// it is not stored.
+func (s *kvService) Get(ctx context.Context, key string) (val string, err error) {
+	resolved, err := s.Resolve(ctx, key)
+	return resolved.Val, err
+}
+
+type deleteOptions struct {
+	force       bool
+	hookTimeout *time.Duration
+}
+
+type DeleteOption func(*deleteOptions)
+
+// Force deletes a hook that is still attached to keys, the attachments are
+// deleted with it.
+func Force() DeleteOption {
+	return func(o *deleteOptions) {
+		o.force = true
 	}
-	ctx := context.Background()
-	keyExists, err := s.r.KeyExists(ctx, key)
-	if err != nil {
-		return fmt.Errorf("could not check if key exists: %w", err)
+}
+
+// Delete deletes key along with its hook attachments and runs the hooks
+// attached to it for EventDelete once the deletion is committed. As with
+// Set, a *HookError means the key was deleted.
+func (s *kvService) Delete(ctx context.Context, key string, opts ...DeleteOption) error {
+	var options deleteOptions
+	for _, opt := range opts {
+		opt(&options)
 	}
-	if !keyExists {
-		return fmt.Errorf("specified key: '%s' does not exist", key)
+	if key == "" {
+		return invalidf("must specify key")
+	}
+	if err := validateHookTimeout(options.hookTimeout); err != nil {
+		return err
 	}
-	ctx = context.Background()
-	err = s.r.DeleteKey(ctx, key)
+	var c change
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		keyExists, err := r.KeyExists(ctx, key)
+		if err != nil {
+			return fmt.Errorf("could not check if key exists: %w", err)
+		}
+		if !keyExists {
+			return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		before, err := s.snapshot(ctx, r, key, true)
+		if err != nil {
+			return err
+		}
+		if err := r.DeleteKey(ctx, key); err != nil {
+			return fmt.Errorf("failed to delete key: %w", err)
+		}
+		c, err = s.changeOf(ctx, r, key, before, nil)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to delete key: %w", err)
+		return err
 	}
-	return nil
+	_, err = s.dispatch(overrideHookTimeout(ctx, options.hookTimeout), c)
+	return err
 }
 
-func (s *kvService) SetScriptHook(name string, script string) error {
+func (s *kvService) SetScriptHook(ctx context.Context, name string, script string) error {
 	if name == "" || script == "" {
-		return fmt.Errorf("key or hook name may not be empty")
+		return invalidf("key or hook name may not be empty")
 	}
-	ctx := context.Background()
 	err := s.r.SetScriptHook(ctx, name, script)
 	if err != nil {
 		return fmt.Errorf("failed to create the hook: %w", err)
@@ -107,11 +449,10 @@ func (s *kvService) SetScriptHook(name string, script string) error {
 	return nil
 }
 
-func (s *kvService) SetFileHook(name string, content string) error {
+func (s *kvService) SetFileHook(ctx context.Context, name string, content string) error {
 	if name == "" || content == "" {
-		return fmt.Errorf("name or content may not be empty")
+		return invalidf("name or content may not be empty")
 	}
-	ctx := context.Background()
 	err := s.r.SetFileHook(ctx, name, content)
 	if err != nil {
 		return fmt.Errorf("unable to save the content of the file: %w", err)
@@ -119,11 +460,10 @@ func (s *kvService) SetFileHook(name string, content string) error {
 	return nil
 }
 
-func (s *kvService) SetFilePathHook(name string, filepath string) error {
+func (s *kvService) SetFilePathHook(ctx context.Context, name string, filepath string) error {
 	if name == "" || filepath == "" {
-		return fmt.Errorf("name or filepath may not be empty")
+		return invalidf("name or filepath may not be empty")
 	}
-	ctx := context.Background()
 	err := s.r.SetFilePathHook(ctx, name, filepath)
 	if err != nil {
 		return fmt.Errorf("unable to create the hook: %w", err)
@@ -131,55 +471,89 @@ func (s *kvService) SetFilePathHook(name string, filepath string) error {
 	return nil
 }
 
-func (s *kvService) AttachHook(key string, hook string) error {
+func (s *kvService) AttachHook(ctx context.Context, key string, hook string, events ...Event) error {
 	if key == "" || hook == "" {
-		return fmt.Errorf("key or hook name may not be empty")
+		return invalidf("key or hook name may not be empty")
+	}
+	events, err := validateEvents(events)
+	if err != nil {
+		return err
 	}
-	ctx := context.Background()
 	keyExists, err := s.r.KeyExists(ctx, key)
 	if err != nil {
 		return fmt.Errorf("could not check if key exists: %w", err)
 	}
 	if !keyExists {
-		return fmt.Errorf("specified key does not exist")
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 	}
-	ctx = context.Background()
 	hookExists, err := s.r.HookExists(ctx, hook)
 	if err != nil {
 		return fmt.Errorf("could not check if hook exists: %w", err)
 	}
 	if !hookExists {
-		return fmt.Errorf("specified hook does not exist")
+		return fmt.Errorf("%w: %s", ErrHookNotFound, hook)
 	}
-	err = s.r.AttachHook(ctx, key, hook)
+	err = s.r.AttachHook(ctx, key, hook, events)
 	if err != nil {
 		return fmt.Errorf("failed to attach the %s hook to the %s key: %w", hook, key, err)
 	}
+	if !dispatchDeferred(ctx) {
+		s.bus.publish(ctx, HookAttached{Namespace: s.Namespace(), Key: key, Hook: hook, Events: events})
+	}
 	return nil
 }
 
-func (s *kvService) DeleteHook(name string) error {
+func (s *kvService) DeleteHook(ctx context.Context, name string, opts ...DeleteOption) error {
+	var options deleteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
 	if name == "" {
-		return errors.New("must specify hook name")
+		return invalidf("must specify hook name")
 	}
-	ctx := context.Background()
-	hookExists, err := s.r.HookExists(ctx, name)
+	// the hook can not be attached between the check and the delete
+	return s.r.Transact(ctx, func(r KvRepository) error {
+		hookExists, err := r.HookExists(ctx, name)
+		if err != nil {
+			return fmt.Errorf("could not check if hook exists: %w", err)
+		}
+		if !hookExists {
+			return fmt.Errorf("%w: %s", ErrHookNotFound, name)
+		}
+		if !options.force {
+			references, err := hookReferences(ctx, r, name)
+			if err != nil {
+				return err
+			}
+			if len(references) > 0 {
+				return fmt.Errorf("%w: the %s hook is attached to the keys %v", ErrInUse, name, references)
+			}
+		}
+		if err := r.DeleteHook(ctx, name); err != nil {
+			return fmt.Errorf("failed to delete hook: %w", err)
+		}
+		return nil
+	})
+}
+
+// hookReferences returns the keys the hook is attached to, the keys of
+// profiles given as profile/key.
+func hookReferences(ctx context.Context, r KvRepository, name string) ([]string, error) {
+	references, err := r.GetHookKeys(ctx, name)
 	if err != nil {
-		return fmt.Errorf("could not check if hook exists: %w", err)
-	}
-	if !hookExists {
-		return fmt.Errorf("specified hook: '%s' does not exist", name)
+		return nil, fmt.Errorf("could not get the keys the %s hook is attached to: %w", name, err)
 	}
-	ctx = context.Background()
-	err = s.r.DeleteHook(ctx, name)
+	profileKeys, err := r.GetHookProfileKeys(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to delete hook: %w", err)
+		return nil, fmt.Errorf("could not get the keys of profiles the %s hook is attached to: %w", name, err)
 	}
-	return nil
+	for _, key := range profileKeys {
+		references = append(references, key.Profile+"/"+key.Key)
+	}
+	return references, nil
 }
 
-func (s *kvService) ListHooks() (hookNames []string, err error) {
-	ctx := context.Background()
+func (s *kvService) ListHooks(ctx context.Context) (hookNames []string, err error) {
 	hookNames, err = s.r.ListHooks(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get the list of hooks: %w", err)
@@ -187,8 +561,7 @@ func (s *kvService) ListHooks() (hookNames []string, err error) {
 	return hookNames, nil
 }
 
-func (s *kvService) ListKeys() (keys []string, err error) {
-	ctx := context.Background()
+func (s *kvService) ListKeys(ctx context.Context) (keys []string, err error) {
 	keys, err = s.r.ListKeys(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get the list of keys: %w", err)
@@ -196,22 +569,20 @@ func (s *kvService) ListKeys() (keys []string, err error) {
 	return keys, nil
 }
 
-func (s *kvService) GetAttachedHooks(key string) ([]Hook, error) {
+func (s *kvService) GetAttachedHooks(ctx context.Context, key string) ([]Hook, error) {
 	if key == "" {
-		return nil, fmt.Errorf("key may not be empty")
+		return nil, invalidf("key may not be empty")
 	}
-	ctx := context.Background()
 	keyExists, err := s.r.KeyExists(ctx, key)
 	if err != nil {
 		return nil, fmt.Errorf("could not determine if the %s key is stored: %w", key, err)
 	}
 	if !keyExists {
-		return nil, fmt.Errorf("the key %s is not stored: %w", key, err)
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 	}
-	ctx = context.Background()
 	hooks, err := s.r.GetAttachedHooks(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get the hooks attached to the %s key", err)
+		return nil, fmt.Errorf("failed to get the hooks attached to the %s key: %w", key, err)
 	}
 	return hooks, nil
 }
@@ -221,60 +592,107 @@ type CmdOutput struct {
 	Stderr string
 	Error  error
 	Caller string
+	Event  Event
+	// TimedOut is set when the hook was stopped by its timeout, Error then
+	// matches ErrHookTimeout.
+	TimedOut bool
 }
 
-func (s *kvService) ExecHooks(hooks []Hook, newVal string) ([]CmdOutput, error) {
+func (s *kvService) ExecHooks(ctx context.Context, hooks []Hook, newVal string) ([]CmdOutput, error) {
 	if len(hooks) == 0 {
-		return nil, fmt.Errorf("no hooks were provided")
+		return nil, invalidf("no hooks were provided")
 	}
+	return s.runHooks(ctx, hooks, newVal, EventSet)
+}
+
+// runHooks runs the hooks with the new value and the event that triggered
+// them, env is added to the environment of every hook. Every hook runs in a
+// process group of its own, stopped along with the processes it spawned
+// once its timeout is over.
+func (s *kvService) runHooks(ctx context.Context, hooks []Hook, newVal string, event Event, env ...string) ([]CmdOutput, error) {
 	shell := os.Getenv("SHELL")
 	if shell == "" {
 		shell = "/bin/sh"
 	}
 	cmdOutputs := make([]CmdOutput, len(hooks))
 	for i, hook := range hooks {
+		if err := ctx.Err(); err != nil {
+			return cmdOutputs[:i], fmt.Errorf("hooks were interrupted before running %s: %w", hook.Name, err)
+		}
+		timeout := s.timeoutOf(ctx, hook)
+		hookCtx, cancel := ctx, context.CancelFunc(func() {})
+		if timeout > 0 {
+			hookCtx, cancel = context.WithTimeout(ctx, timeout)
+		}
 		var cmd *exec.Cmd
 		var stdout, stderr bytes.Buffer
 		if hook.IsFile {
 			if hook.IsLocalFile {
-				cmd = exec.Command(hook.Filepath, newVal)
+				cmd = exec.CommandContext(hookCtx, hook.Filepath, newVal)
 			} else {
 				file, err := os.CreateTemp(os.TempDir(), "kvz-hook")
 				if err != nil {
+					cancel()
 					return nil, fmt.Errorf("unable to create temporary hook script: %w", err)
 				}
 				filePath := file.Name()
 				defer os.Remove(filePath)
 				err = os.Chmod(filePath, 0700)
 				if err != nil {
+					cancel()
 					return nil, fmt.Errorf("could not set permissions on temporary hook script: %w", err)
 				}
 				file.WriteString(hook.Script)
 				err = file.Close()
 				if err != nil {
+					cancel()
 					return nil, fmt.Errorf("could not close the temporary hook script file after writing to it: %w", err)
 				}
-				cmd = exec.Command(file.Name(), newVal)
+				cmd = exec.CommandContext(hookCtx, file.Name(), newVal)
 			}
 
 		} else {
-			cmd = exec.Command(shell, "-c", hook.Script)
+			cmd = exec.CommandContext(hookCtx, shell, "-c", hook.Script)
 		}
 
 		cmd.Stdout = &stdout
 		cmd.Stderr = &stderr
-		cmd.Env = append(cmd.Env, fmt.Sprintf("NEW_VAL=%s", newVal))
-		err := cmd.Run()
+		cmd.Env = append(cmd.Env, fmt.Sprintf("NEW_VAL=%s", newVal), fmt.Sprintf("KVZ_EVENT=%s", event))
+		cmd.Env = append(cmd.Env, env...)
+		terminated, err := runInProcessGroup(cmd, HookKillGrace)
+		timedOut := terminated && errors.Is(hookCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+		if timedOut {
+			err = fmt.Errorf("%w: %s was stopped after %s", ErrHookTimeout, hook.Name, timeout)
+		}
 		cmdOutputs[i] = CmdOutput{
-			Stdout: stdout.String(),
-			Stderr: stderr.String(),
-			Error:  err,
-			Caller: hook.Name,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			Error:    err,
+			Caller:   hook.Name,
+			Event:    event,
+			TimedOut: timedOut,
 		}
 	}
 	return cmdOutputs, nil
 }
 
-func NewServcice(r KvRepository) KvService {
-	return &kvService{r: r}
+type ServiceOption func(*kvService)
+
+// WithCipher sets the cipher used to encrypt and decrypt secret keys.
+func WithCipher(c Cipher) ServiceOption {
+	return func(s *kvService) {
+		s.cipher = c
+	}
+}
+
+// NewServcice returns a service storing its data in r. Every change is
+// recorded in the audit log.
+func NewServcice(r KvRepository, opts ...ServiceOption) KvService {
+	s := &kvService{r: r, actor: CurrentActor(), bus: newEventBus()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	s.r = newAuditRepository(s.r, s.actor)
+	return s
 }
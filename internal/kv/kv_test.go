@@ -1,8 +1,22 @@
 package kv_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/inner-daydream/kvz/internal/kv"
 	"github.com/inner-daydream/kvz/internal/sqlite"
@@ -10,6 +24,7 @@ import (
 )
 
 func Test_kvService_Set(t *testing.T) {
+	ctx := context.Background()
 
 	type args struct {
 		key string
@@ -68,7 +83,7 @@ func Test_kvService_Set(t *testing.T) {
 	service := kv.NewServcice(repo)
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := service.Set(tt.args.key, tt.args.val); (err != nil) != tt.wantErr {
+			if err := service.Set(ctx, tt.args.key, tt.args.val); (err != nil) != tt.wantErr {
 				t.Errorf("kvService.Set() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
@@ -76,6 +91,7 @@ func Test_kvService_Set(t *testing.T) {
 }
 
 func Test_kvService_Get(t *testing.T) {
+	ctx := context.Background()
 	db, err := sqlite.OpenDB(":memory:")
 	if err != nil {
 		t.Fatal(err)
@@ -94,7 +110,7 @@ func Test_kvService_Get(t *testing.T) {
 	service := kv.NewServcice(repo)
 	key := "testKey1"
 	val := "testValue1"
-	service.Set("testKey1", "testValue1")
+	service.Set(ctx, "testKey1", "testValue1")
 
 	type args struct {
 		key string
@@ -134,7 +150,7 @@ func Test_kvService_Get(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			gotVal, err := service.Get(tt.args.key)
+			gotVal, err := service.Get(ctx, tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("kvService.Get() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -147,6 +163,7 @@ func Test_kvService_Get(t *testing.T) {
 }
 
 func Test_kvService_ListKeys(t *testing.T) {
+	ctx := context.Background()
 	db, err := sqlite.OpenDB(":memory:")
 	if err != nil {
 		t.Fatal(err)
@@ -165,7 +182,7 @@ func Test_kvService_ListKeys(t *testing.T) {
 	service := kv.NewServcice(repo)
 	keys := []string{"k1", "k2", "k3"}
 	for _, key := range keys {
-		err := service.Set(key, "testValue")
+		err := service.Set(ctx, key, "testValue")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -184,7 +201,7 @@ func Test_kvService_ListKeys(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			gotKeys, err := service.ListKeys()
+			gotKeys, err := service.ListKeys(ctx)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("kvService.ListKeys() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -197,6 +214,7 @@ func Test_kvService_ListKeys(t *testing.T) {
 }
 
 func Test_kvService_ListHooks(t *testing.T) {
+	ctx := context.Background()
 	db, err := sqlite.OpenDB(":memory:")
 	if err != nil {
 		t.Fatal(err)
@@ -215,7 +233,7 @@ func Test_kvService_ListHooks(t *testing.T) {
 	service := kv.NewServcice(repo)
 	hookNames := []string{"h1", "h2", "h3"}
 	for _, hookName := range hookNames {
-		err := service.SetScriptHook(hookName, "echo hello")
+		err := service.SetScriptHook(ctx, hookName, "echo hello")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -234,7 +252,7 @@ func Test_kvService_ListHooks(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			gotHookNames, err := service.ListHooks()
+			gotHookNames, err := service.ListHooks(ctx)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("kvService.ListHooks() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -247,6 +265,7 @@ func Test_kvService_ListHooks(t *testing.T) {
 }
 
 func Test_kvService_AttachHook(t *testing.T) {
+	ctx := context.Background()
 	db, err := sqlite.OpenDB(":memory:")
 	if err != nil {
 		t.Fatal(err)
@@ -264,12 +283,12 @@ func Test_kvService_AttachHook(t *testing.T) {
 	repo := sqlite.NewRepository(queries)
 	service := kv.NewServcice(repo)
 	testKey := "test1"
-	err = service.Set(testKey, "val1")
+	err = service.Set(ctx, testKey, "val1")
 	if err != nil {
 		t.Fatal(err)
 	}
 	testHook := "h1"
-	err = service.SetScriptHook(testHook, "echo test")
+	err = service.SetScriptHook(ctx, testHook, "echo test")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -310,7 +329,7 @@ func Test_kvService_AttachHook(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 
-			if err := service.AttachHook(tt.args.key, tt.args.hook); (err != nil) != tt.wantErr {
+			if err := service.AttachHook(ctx, tt.args.key, tt.args.hook); (err != nil) != tt.wantErr {
 				t.Errorf("kvService.AttachHook() - %s -  error = %v, wantErr %v", tt.name, err, tt.wantErr)
 			}
 		})
@@ -318,6 +337,7 @@ func Test_kvService_AttachHook(t *testing.T) {
 }
 
 func Test_kvService_GetAttachedHooks(t *testing.T) {
+	ctx := context.Background()
 	db, err := sqlite.OpenDB(":memory:")
 	if err != nil {
 		t.Fatal(err)
@@ -336,7 +356,7 @@ func Test_kvService_GetAttachedHooks(t *testing.T) {
 	service := kv.NewServcice(repo)
 	keys := []string{"k1", "k2", "k3"}
 	for _, key := range keys {
-		err := service.Set(key, "testValue")
+		err := service.Set(ctx, key, "testValue")
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -346,11 +366,11 @@ func Test_kvService_GetAttachedHooks(t *testing.T) {
 	testkey := keys[0]
 	wantedHooks := make([]kv.Hook, 3)
 	for i, hookName := range hookNames {
-		err := service.SetScriptHook(hookName, hookContent)
+		err := service.SetScriptHook(ctx, hookName, hookContent)
 		if err != nil {
 			t.Fatal(err)
 		}
-		err = service.AttachHook(testkey, hookName)
+		err = service.AttachHook(ctx, testkey, hookName)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -406,7 +426,7 @@ func Test_kvService_GetAttachedHooks(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := service.GetAttachedHooks(tt.args.key)
+			got, err := service.GetAttachedHooks(ctx, tt.args.key)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("kvService.GetAttachedHooks() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -417,3 +437,2821 @@ func Test_kvService_GetAttachedHooks(t *testing.T) {
 		})
 	}
 }
+
+// setupDB returns a migrated in-memory database closed with the test.
+func setupDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sqlite.OpenDB(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator := sqlite.NewSqliteMigrator(db)
+	err = migrator.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func setupService(t *testing.T, opts ...kv.ServiceOption) kv.KvService {
+	t.Helper()
+	queries := sqlite.New(setupDB(t))
+	repo := sqlite.NewRepository(queries)
+	return kv.NewServcice(repo, opts...)
+}
+
+func Test_kvService_History(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	vals := []string{"v1", "v2", "v3"}
+	for _, val := range vals {
+		err := service.Set(ctx, "k1", val)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := service.Delete(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revisions, err := service.History(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != len(vals)+1 {
+		t.Fatalf("kvService.History() returned %d revisions, want %d", len(revisions), len(vals)+1)
+	}
+	for i, val := range vals {
+		if revisions[i].Val != val || revisions[i].Deleted {
+			t.Errorf("kvService.History()[%d] = %+v, want value %s", i, revisions[i], val)
+		}
+	}
+	if !revisions[len(vals)].Deleted {
+		t.Errorf("kvService.History() last revision should be a deletion, got %+v", revisions[len(vals)])
+	}
+	if _, err := service.History(ctx, "none"); err == nil {
+		t.Errorf("kvService.History() on a key without history should fail")
+	}
+}
+
+func Test_kvService_GetAtRevision(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	before := time.Now().Add(-time.Hour)
+	for _, val := range []string{"v1", "v2"} {
+		err := service.Set(ctx, "k1", val)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	revisions, err := service.History(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type args struct {
+		key      string
+		revision int64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantVal string
+		wantErr bool
+	}{
+		{
+			name:    "First revision",
+			args:    args{key: "k1", revision: revisions[0].Revision},
+			wantVal: "v1",
+			wantErr: false,
+		},
+		{
+			name:    "Latest revision",
+			args:    args{key: "k1", revision: revisions[1].Revision},
+			wantVal: "v2",
+			wantErr: false,
+		},
+		{
+			name:    "Unknown revision",
+			args:    args{key: "k1", revision: revisions[1].Revision + 100},
+			wantVal: "",
+			wantErr: true,
+		},
+		{
+			name:    "Empty key",
+			args:    args{key: "", revision: revisions[0].Revision},
+			wantVal: "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotVal, err := service.GetAtRevision(ctx, tt.args.key, tt.args.revision)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kvService.GetAtRevision() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if gotVal != tt.wantVal {
+				t.Errorf("kvService.GetAtRevision() = %v, want %v", gotVal, tt.wantVal)
+			}
+		})
+	}
+	gotVal, err := service.GetAt(ctx, "k1", time.Now())
+	if err != nil || gotVal != "v2" {
+		t.Errorf("kvService.GetAt() = %v, %v, want v2", gotVal, err)
+	}
+	if _, err := service.GetAt(ctx, "k1", before); err == nil {
+		t.Errorf("kvService.GetAt() before the key was written should fail")
+	}
+}
+
+func Test_kvService_Rollback(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	for _, val := range []string{"good", "bad"} {
+		err := service.Set(ctx, "k1", val)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	revisions, err := service.History(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = service.Rollback(ctx, "k1", revisions[0].Revision)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotVal, err := service.Get(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotVal != "good" {
+		t.Errorf("kvService.Rollback() left value %v, want good", gotVal)
+	}
+	revisions, err = service.History(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 {
+		t.Errorf("kvService.Rollback() should record a new revision, got %d revisions", len(revisions))
+	}
+}
+
+func Test_kvService_WithNamespace(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	tests := []struct {
+		name      string
+		namespace string
+		wantErr   bool
+	}{
+		{name: "Flat namespace", namespace: "team", wantErr: false},
+		{name: "Nested namespace", namespace: "team/project", wantErr: false},
+		{name: "Empty namespace", namespace: "", wantErr: true},
+		{name: "Empty level", namespace: "team//project", wantErr: true},
+		{name: "Trailing separator", namespace: "team/", wantErr: true},
+		{name: "Glob characters", namespace: "team*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := service.WithNamespace(tt.namespace)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kvService.WithNamespace() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if service.Namespace() != kv.DefaultNamespace {
+		t.Errorf("kvService.Namespace() = %v, want %v", service.Namespace(), kv.DefaultNamespace)
+	}
+	scoped, err := service.WithNamespace("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "k1", "default value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scoped.Set(ctx, "k1", "team value"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scoped.SetScriptHook(ctx, "h1", "echo team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := scoped.AttachHook(ctx, "k1", "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k1", "h1"); err == nil {
+		t.Errorf("kvService.AttachHook() should not see hooks from another namespace")
+	}
+	gotVal, err := service.Get(ctx, "k1")
+	if err != nil || gotVal != "default value" {
+		t.Errorf("kvService.Get() = %v, %v, want default value", gotVal, err)
+	}
+	gotVal, err = scoped.Get(ctx, "k1")
+	if err != nil || gotVal != "team value" {
+		t.Errorf("kvService.Get() in namespace = %v, %v, want team value", gotVal, err)
+	}
+}
+
+func Test_NamespaceFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    string
+		wantErr bool
+	}{
+		{name: "Unset", env: "", want: kv.DefaultNamespace},
+		{name: "Nested namespace", env: "team/project", want: "team/project"},
+		{name: "Empty level", env: "team//project", wantErr: true},
+		{name: "Glob characters", env: "team*", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(kv.NamespaceEnvVar, tt.env)
+			got, err := kv.NamespaceFromEnv()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kv.NamespaceFromEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, kv.ErrValidation) {
+				t.Errorf("kv.NamespaceFromEnv() error = %v, want %v", err, kv.ErrValidation)
+			}
+			if got != tt.want {
+				t.Errorf("kv.NamespaceFromEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_kvService_DeleteNamespace(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	for _, namespace := range []string{"team", "team/project", "teammate"} {
+		scoped, err := service.WithNamespace(namespace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := scoped.Set(ctx, "k1", namespace); err != nil {
+			t.Fatal(err)
+		}
+	}
+	entries, err := service.ExportNamespace(ctx, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantEntries := []kv.Entry{
+		{Namespace: "team", Key: "k1", Val: "team"},
+		{Namespace: "team/project", Key: "k1", Val: "team/project"},
+	}
+	if !reflect.DeepEqual(entries, wantEntries) {
+		t.Errorf("kvService.ExportNamespace() = %v, want %v", entries, wantEntries)
+	}
+	team, err := service.WithNamespace("team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := team.DeclareType(ctx, "port", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := team.SetSchema(ctx, kv.Schema{Keys: []kv.SchemaKey{{Key: "k1", Required: true}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := team.SetScriptHook(ctx, "print", `echo "$KVZ_EVENT $KVZ_KEY $OLD_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := team.AttachHook(ctx, "k1", "print", kv.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetProfile(ctx, "mixed", kv.DefaultNamespace, "team/project"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetProfile(ctx, "team", "team"); err != nil {
+		t.Fatal(err)
+	}
+	sub, err := service.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if err := service.DeleteNamespace(ctx, "team"); err != nil {
+		t.Fatal(err)
+	}
+	namespaces, err := service.ListNamespaces(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(namespaces, []string{"teammate"}) {
+		t.Errorf("kvService.ListNamespaces() = %v, want [teammate]", namespaces)
+	}
+	var got []string
+	for len(sub.Events()) > 0 {
+		switch event := (<-sub.Events()).(type) {
+		case kv.KeyDeleted:
+			got = append(got, "deleted "+event.Namespace+" "+event.Key)
+		case kv.HookExecuted:
+			got = append(got, "hook "+event.Output.Stdout)
+		}
+	}
+	want := []string{"deleted team k1", "hook delete k1 team\n", "deleted team/project k1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.DeleteNamespace() published %q, want %q", got, want)
+	}
+
+	// a namespace created again with the same name starts empty
+	if valueType, err := team.GetType(ctx, "port"); err != nil || valueType != kv.TypeString {
+		t.Errorf("kvService.GetType() after DeleteNamespace = %v, %v, want string", valueType, err)
+	}
+	if schema, err := team.GetSchema(ctx); err != nil || len(schema.Keys) != 0 {
+		t.Errorf("kvService.GetSchema() after DeleteNamespace = %+v, %v, want none", schema, err)
+	}
+	profiles, err := service.ListProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantProfiles := []kv.Profile{{Name: "mixed", Layers: []string{kv.DefaultNamespace}}}
+	if !reflect.DeepEqual(profiles, wantProfiles) {
+		t.Errorf("kvService.ListProfiles() after DeleteNamespace = %+v, want %+v", profiles, wantProfiles)
+	}
+}
+
+func Test_kvService_DeclareType(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	if err := service.Set(ctx, "existing", "not a number"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeclareType(ctx, "existing", kv.TypeInt); err == nil || strings.Contains(err.Error(), "not a number") {
+		t.Errorf("kvService.DeclareType() should reject a type the current value does not match without quoting it, got %v", err)
+	}
+	declared := map[string]kv.ValueType{
+		"port":    kv.TypeInt,
+		"ratio":   kv.TypeFloat,
+		"enabled": kv.TypeBool,
+		"timeout": kv.TypeDuration,
+		"config":  kv.TypeJSON,
+		"hosts":   kv.TypeList,
+	}
+	for key, valueType := range declared {
+		if err := service.DeclareType(ctx, key, valueType); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name      string
+		key       string
+		val       string
+		wantTyped any
+		wantErr   bool
+	}{
+		{name: "Valid int", key: "port", val: "8080", wantTyped: int64(8080), wantErr: false},
+		{name: "Invalid int", key: "port", val: "eighty", wantErr: true},
+		{name: "Valid float", key: "ratio", val: "0.5", wantTyped: 0.5, wantErr: false},
+		{name: "Valid bool", key: "enabled", val: "true", wantTyped: true, wantErr: false},
+		{name: "Invalid bool", key: "enabled", val: "maybe", wantErr: true},
+		{name: "Valid duration", key: "timeout", val: "1m30s", wantTyped: 90 * time.Second, wantErr: false},
+		{name: "Valid JSON", key: "config", val: `{"a":1}`, wantTyped: map[string]any{"a": float64(1)}, wantErr: false},
+		{name: "Invalid JSON", key: "config", val: `{"a":`, wantErr: true},
+		{name: "Valid list", key: "hosts", val: `["a","b"]`, wantTyped: []string{"a", "b"}, wantErr: false},
+		{name: "List of numbers", key: "hosts", val: `[1,2]`, wantErr: true},
+		{name: "Undeclared key", key: "free", val: "anything", wantTyped: "anything", wantErr: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Set(ctx, tt.key, tt.val)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kvService.Set() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				// the value may be a secret
+				if strings.Contains(err.Error(), tt.val) {
+					t.Errorf("kvService.Set() error = %v, should not quote the value", err)
+				}
+				return
+			}
+			gotTyped, err := service.GetTyped(ctx, tt.key)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(gotTyped, tt.wantTyped) {
+				t.Errorf("kvService.GetTyped() = %#v, want %#v", gotTyped, tt.wantTyped)
+			}
+		})
+	}
+	if err := service.DeclareType(ctx, "port", "number"); err == nil {
+		t.Errorf("kvService.DeclareType() should reject unknown types")
+	}
+}
+
+func Test_kvService_SetExpired(t *testing.T) {
+	ctx := context.Background()
+	var reports []kv.HookReport
+	service := setupService(t, kv.WithHookReporter(func(report kv.HookReport) {
+		reports = append(reports, report)
+	}))
+	if err := service.Set(ctx, "session", "old", kv.WithTTL(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetOwner(ctx, "session", "platform-team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "session", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", `echo "$KVZ_EVENT"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "session", "print"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	sub, err := service.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	// the expired key is purged, the write creates it afresh
+	if err := service.Set(ctx, "session", "new"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := service.Info(ctx, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Version != 1 || info.Owner != "" || len(info.Tags) != 0 || !info.ExpiresAt.IsZero() {
+		t.Errorf("kvService.Info() of a key set after expiring = %+v, want a new key", info)
+	}
+	if hooks, err := service.GetAttachedHooks(ctx, "session"); err != nil || len(hooks) != 0 {
+		t.Errorf("kvService.GetAttachedHooks() = %v, %v, want the attachments purged with the key", hooks, err)
+	}
+	if len(reports) != 0 {
+		t.Errorf("kvService.Set() ran %d hooks of the expired key", len(reports))
+	}
+	if event, ok := (<-sub.Events()).(kv.KeySet); !ok || !event.Created {
+		t.Errorf("kvService.Set() published %+v, want the creation of the key", event)
+	}
+	revisions, err := service.History(ctx, "session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 3 || !revisions[1].Deleted || revisions[2].Val != "new" {
+		t.Errorf("kvService.History() = %+v, want the purge between the two values", revisions)
+	}
+}
+
+func Test_kvService_SetWithTTL(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	if err := service.Set(ctx, "permanent", "val"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "temporary", "secret-token", kv.WithTTL(50*time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "negative", "val", kv.WithTTL(-time.Second)); err == nil {
+		t.Errorf("kvService.Set() should reject a negative ttl")
+	}
+	if err := service.SetScriptHook(ctx, "cleanup", `echo "$KVZ_EVENT $KVZ_KEY $OLD_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "on-set", "echo set"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "temporary", "cleanup", kv.EventExpire); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "temporary", "on-set"); err != nil {
+		t.Fatal(err)
+	}
+	if gotVal, err := service.Get(ctx, "temporary"); err != nil || gotVal != "secret-token" {
+		t.Errorf("kvService.Get() before expiry = %v, %v, want secret-token", gotVal, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if _, err := service.Get(ctx, "temporary"); err == nil {
+		t.Errorf("kvService.Get() should not return an expired key")
+	}
+	keys, err := service.ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"permanent"}) {
+		t.Errorf("kvService.ListKeys() = %v, want [permanent]", keys)
+	}
+	outputs, err := service.PurgeExpired(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 {
+		t.Fatalf("kvService.PurgeExpired() ran %d hooks, want 1", len(outputs))
+	}
+	if outputs[0].Event != kv.EventExpire || outputs[0].Stdout != "expire temporary secret-token\n" || outputs[0].Error != nil {
+		t.Errorf("kvService.PurgeExpired() hook output = %+v", outputs[0])
+	}
+	revisions, err := service.History(ctx, "temporary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revisions[len(revisions)-1].Deleted {
+		t.Errorf("kvService.PurgeExpired() should delete the expired key")
+	}
+	outputs, err = service.PurgeExpired(ctx)
+	if err != nil || len(outputs) != 0 {
+		t.Errorf("kvService.PurgeExpired() second sweep = %v, %v, want no hooks", outputs, err)
+	}
+}
+
+func Test_kvService_SetIfVersion(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	if err := service.SetIfVersion(ctx, "k1", "v1", 0); err != nil {
+		t.Fatalf("kvService.SetIfVersion() creating a key error = %v", err)
+	}
+	val, version, err := service.GetWithVersion(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val != "v1" || version != 1 {
+		t.Errorf("kvService.GetWithVersion() = %v, %v, want v1, 1", val, version)
+	}
+	if err := service.Set(ctx, "k1", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		key        string
+		version    int64
+		wantActual int64
+		wantErr    bool
+	}{
+		{name: "Stale version", key: "k1", version: 1, wantActual: 2, wantErr: true},
+		{name: "Create existing key", key: "k1", version: 0, wantActual: 2, wantErr: true},
+		{name: "Update missing key", key: "missing", version: 3, wantActual: 0, wantErr: true},
+		{name: "Current version", key: "k1", version: 2, wantErr: false},
+		{name: "Negative version", key: "k1", version: -1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.SetIfVersion(ctx, tt.key, "new", tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kvService.SetIfVersion() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var conflict *kv.ConflictError
+			if tt.version >= 0 && tt.wantErr {
+				if !errors.As(err, &conflict) {
+					t.Errorf("kvService.SetIfVersion() error = %v, want a *kv.ConflictError", err)
+					return
+				}
+				if conflict.Actual != tt.wantActual {
+					t.Errorf("kvService.SetIfVersion() conflict on version %d, want %d", conflict.Actual, tt.wantActual)
+				}
+			}
+		})
+	}
+	_, version, err = service.GetWithVersion(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 3 {
+		t.Errorf("kvService.GetWithVersion() version = %v, want 3", version)
+	}
+}
+
+func Test_kvService_Apply(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	if err := service.Set(ctx, "a", "initial"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", `echo "$NEW_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "a", "print"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := service.Apply(ctx, []kv.Op{
+		{Type: kv.OpSet, Key: "a", Val: "rolled back"},
+		{Type: kv.OpSet, Key: "c", Val: "rolled back"},
+		{Type: kv.OpDelete, Key: "missing"},
+	})
+	if err == nil {
+		t.Fatalf("kvService.Apply() should fail when an operation fails")
+	}
+	if gotVal, err := service.Get(ctx, "a"); err != nil || gotVal != "initial" {
+		t.Errorf("kvService.Apply() failed batch left a = %v, %v, want initial", gotVal, err)
+	}
+	if _, err := service.Get(ctx, "c"); err == nil {
+		t.Errorf("kvService.Apply() failed batch should not create c")
+	}
+
+	outputs, err := service.Apply(ctx, []kv.Op{
+		{Type: kv.OpSet, Key: "a", Val: "first"},
+		{Type: kv.OpSet, Key: "b", Val: "b"},
+		{Type: kv.OpSet, Key: "a", Val: "second"},
+		{Type: kv.OpDelete, Key: "b"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(outputs) != 1 || outputs[0].Stdout != "second\n" {
+		t.Errorf("kvService.Apply() hook outputs = %+v, want a single run with the final value", outputs)
+	}
+	keys, err := service.ListKeys(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"a"}) {
+		t.Errorf("kvService.ListKeys() after Apply() = %v, want [a]", keys)
+	}
+	if _, err := service.Apply(ctx, nil); err == nil {
+		t.Errorf("kvService.Apply() should reject an empty batch")
+	}
+}
+
+func Test_kvService_ListKeysPage(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	for _, key := range []string{"db.port", "db.host", "app*name", "app.color", "cache.ttl"} {
+		if err := service.Set(ctx, key, "val"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name     string
+		opts     kv.ListOptions
+		wantPage kv.Page
+		wantErr  bool
+	}{
+		{
+			name:     "Everything sorted",
+			opts:     kv.ListOptions{},
+			wantPage: kv.Page{Names: []string{"app*name", "app.color", "cache.ttl", "db.host", "db.port"}},
+		},
+		{
+			name:     "Prefix",
+			opts:     kv.ListOptions{Prefix: "db."},
+			wantPage: kv.Page{Names: []string{"db.host", "db.port"}},
+		},
+		{
+			name:     "Prefix with a glob wildcard is literal",
+			opts:     kv.ListOptions{Prefix: "app*"},
+			wantPage: kv.Page{Names: []string{"app*name"}},
+		},
+		{
+			name:     "Glob",
+			opts:     kv.ListOptions{Glob: "*.[ch]*"},
+			wantPage: kv.Page{Names: []string{"app.color", "db.host"}},
+		},
+		{
+			name:     "Regex",
+			opts:     kv.ListOptions{Regex: `^(db|cache)\.t`},
+			wantPage: kv.Page{Names: []string{"cache.ttl"}},
+		},
+		{
+			name:     "First page",
+			opts:     kv.ListOptions{Limit: 2},
+			wantPage: kv.Page{Names: []string{"app*name", "app.color"}, NextCursor: "app.color"},
+		},
+		{
+			name:     "Last page",
+			opts:     kv.ListOptions{Limit: 2, Cursor: "cache.ttl"},
+			wantPage: kv.Page{Names: []string{"db.host", "db.port"}},
+		},
+		{
+			name:    "Invalid regex",
+			opts:    kv.ListOptions{Regex: "("},
+			wantErr: true,
+		},
+		{
+			name:    "Negative limit",
+			opts:    kv.ListOptions{Limit: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPage, err := service.ListKeysPage(ctx, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("kvService.ListKeysPage() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotPage, tt.wantPage) {
+				t.Errorf("kvService.ListKeysPage() = %+v, want %+v", gotPage, tt.wantPage)
+			}
+		})
+	}
+
+	for _, hook := range []string{"notify", "reload", "restart"} {
+		if err := service.SetScriptHook(ctx, hook, "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	gotPage, err := service.ListHooksPage(ctx, kv.ListOptions{Prefix: "re", Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantPage := kv.Page{Names: []string{"reload"}, NextCursor: "reload"}
+	if !reflect.DeepEqual(gotPage, wantPage) {
+		t.Errorf("kvService.ListHooksPage() = %+v, want %+v", gotPage, wantPage)
+	}
+}
+
+func Test_kvService_Info(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	before := time.Now().Add(-time.Second)
+	for _, key := range []string{"db.host", "db.port", "app.color"} {
+		if err := service.Set(ctx, key, "val"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.SetDescription(ctx, "db.host", "primary database host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetOwner(ctx, "db.host", "platform-team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "db.host", "prod", "database", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "db.port", "database", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.RemoveTags(ctx, "db.port", "stale"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "missing", "prod"); err == nil {
+		t.Errorf("kvService.AddTags() should fail for a missing key")
+	}
+	if err := service.AddTags(ctx, "db.host", " padded"); err == nil {
+		t.Errorf("kvService.AddTags() should reject padded tags")
+	}
+	if err := service.Set(ctx, "db.host", "new"); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := service.Info(ctx, "db.host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Val != "new" || info.Description != "primary database host" || info.Owner != "platform-team" {
+		t.Errorf("kvService.Info() = %+v", info)
+	}
+	if !reflect.DeepEqual(info.Tags, []string{"database", "prod"}) {
+		t.Errorf("kvService.Info() tags = %v, want [database prod]", info.Tags)
+	}
+	if info.CreatedAt.Before(before) || info.UpdatedAt.Before(info.CreatedAt) || !info.ExpiresAt.IsZero() {
+		t.Errorf("kvService.Info() timestamps = %v, %v, %v", info.CreatedAt, info.UpdatedAt, info.ExpiresAt)
+	}
+	if info.Type != kv.TypeString || info.Version != 2 {
+		t.Errorf("kvService.Info() type and version = %v, %v, want string, 2", info.Type, info.Version)
+	}
+	revisions, err := service.History(ctx, "db.host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 {
+		t.Errorf("metadata changes should not be recorded in the history, got %d revisions", len(revisions))
+	}
+
+	page, err := service.ListKeysPage(ctx, kv.ListOptions{Tag: "database"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page.Names, []string{"db.host", "db.port"}) {
+		t.Errorf("kvService.ListKeysPage() by tag = %v, want [db.host db.port]", page.Names)
+	}
+	if err := service.Delete(ctx, "db.host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "db.host", "recreated"); err != nil {
+		t.Fatal(err)
+	}
+	info, err = service.Info(ctx, "db.host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(info.Tags) != 0 || info.Description != "" {
+		t.Errorf("kvService.Info() of a recreated key should not keep old metadata, got %+v", info)
+	}
+}
+
+func Test_kvService_Secrets(t *testing.T) {
+	ctx := context.Background()
+	keyFile := filepath.Join(t.TempDir(), "kvz.key")
+	err := os.WriteFile(keyFile, []byte(strings.Repeat("ab", 32)+"\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFileCipher, err := kv.NewKeyFileCipher(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passphraseCipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphers := map[string]kv.Cipher{
+		"key file":   keyFileCipher,
+		"passphrase": passphraseCipher,
+	}
+	for name, cipher := range ciphers {
+		t.Run(name, func(t *testing.T) {
+			repo := sqlite.NewRepository(sqlite.New(setupDB(t)))
+			service := kv.NewServcice(repo, kv.WithCipher(cipher))
+			if err := service.Set(ctx, "token", "s3cr3t", kv.AsSecret()); err != nil {
+				t.Fatal(err)
+			}
+			if gotVal, err := service.Get(ctx, "token"); err != nil || gotVal != "s3cr3t" {
+				t.Errorf("kvService.Get() = %v, %v, want s3cr3t", gotVal, err)
+			}
+			if err := service.Set(ctx, "token", "rotated"); err != nil {
+				t.Fatal(err)
+			}
+			info, err := service.Info(ctx, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !info.Secret || info.Val != kv.SecretMask {
+				t.Errorf("kvService.Info() should mask secrets, got %+v", info)
+			}
+			revisions, err := service.History(ctx, "token")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, revision := range revisions {
+				if revision.Val != kv.SecretMask {
+					t.Errorf("kvService.History() should only hold encrypted values, got %v", revision.Val)
+				}
+			}
+			if gotVal, err := service.GetAtRevision(ctx, "token", revisions[0].Revision); err != nil || gotVal != "s3cr3t" {
+				t.Errorf("kvService.GetAtRevision() = %v, %v, want s3cr3t", gotVal, err)
+			}
+			entries, err := service.ExportNamespace(ctx, kv.DefaultNamespace)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries) != 1 || entries[0].Val != kv.SecretMask {
+				t.Errorf("kvService.ExportNamespace() should mask secrets, got %+v", entries)
+			}
+			if gotVal, err := service.Get(ctx, "token"); err != nil || gotVal != "rotated" {
+				t.Errorf("kvService.Get() = %v, %v, want rotated", gotVal, err)
+			}
+			locked := kv.NewServcice(repo)
+			if _, err := locked.Get(ctx, "token"); err == nil {
+				t.Errorf("kvService.Get() without a cipher should fail on a secret")
+			}
+			if err := locked.Set(ctx, "other", "val", kv.AsSecret()); err == nil {
+				t.Errorf("kvService.Set() of a secret without a cipher should fail")
+			}
+			if err := service.Set(ctx, "plain", "kvzenc:v2:forged"); err == nil {
+				t.Errorf("kvService.Set() should reject plain values that look encrypted")
+			}
+			// a key made secret does not keep its earlier values in plain text
+			if err := service.Set(ctx, "api_key", "plain-v1"); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.CreateSnapshot(ctx, "plain"); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.Set(ctx, "api_key", "plain-v2"); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.Set(ctx, "api_key", "sealed", kv.AsSecret()); err != nil {
+				t.Fatal(err)
+			}
+			revisions, err = service.History(ctx, "api_key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, revision := range revisions {
+				if revision.Val != kv.SecretMask {
+					t.Errorf("kvService.History() kept %v in plain text after AsSecret", revision.Val)
+				}
+			}
+			if gotVal, err := service.GetAtRevision(ctx, "api_key", revisions[0].Revision); err != nil || gotVal != "plain-v1" {
+				t.Errorf("kvService.GetAtRevision() = %v, %v, want plain-v1", gotVal, err)
+			}
+			watchCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			changes, err := service.Watch(watchCtx, "api_key", kv.WatchAfter(0), kv.WatchInterval(10*time.Millisecond))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 3; i++ {
+				change := <-changes
+				if change.Err != nil || change.NewVal == nil || *change.NewVal != kv.SecretMask {
+					t.Errorf("kvService.Watch() = %+v, want the values masked", change)
+				}
+			}
+			cancel()
+			if err := service.RestoreSnapshot(ctx, "plain", "api_key"); err != nil {
+				t.Fatal(err)
+			}
+			info, err = service.Info(ctx, "api_key")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotVal, err := service.Get(ctx, "api_key"); err != nil || gotVal != "plain-v1" || !info.Secret {
+				t.Errorf("kvService.Get() of a restored secret = %v, %v, secret %v, want plain-v1 and secret", gotVal, err, info.Secret)
+			}
+			// the audit log is append-only, it keeps the values written
+			// before the key was made secret
+			audited, err := service.QueryAudit(ctx, kv.AuditFilter{Key: "api_key"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(audited) == 0 || audited[0].NewVal == nil || *audited[0].NewVal != "plain-v1" {
+				t.Errorf("kvService.QueryAudit() = %+v, want the first plain value", audited)
+			}
+
+			// the value of a secret is bound to its key, a moved secret is
+			// encrypted again for its new key
+			if err := service.Rename(ctx, "token", "api_token"); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.Copy(ctx, "api_token", "token"); err != nil {
+				t.Fatal(err)
+			}
+			for _, key := range []string{"api_token", "token"} {
+				if gotVal, err := service.Get(ctx, key); err != nil || gotVal != "rotated" {
+					t.Errorf("kvService.Get(%s) after a move = %v, %v, want rotated", key, gotVal, err)
+				}
+			}
+		})
+	}
+	otherCipher, err := kv.NewPassphraseCipher("wrong")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := []byte("default\x00token")
+	encrypted, err := passphraseCipher.Encrypt("value", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := otherCipher.Decrypt(encrypted, data); err == nil {
+		t.Errorf("Decrypt() with the wrong passphrase should fail")
+	}
+	if _, err := passphraseCipher.Decrypt(encrypted, []byte("default\x00other")); err == nil {
+		t.Errorf("Decrypt() with other additional data should fail")
+	}
+	// another cipher draws another salt, it derives the key of the value
+	samePassphrase, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plaintext, err := samePassphrase.Decrypt(encrypted, data); err != nil || plaintext != "value" {
+		t.Errorf("Decrypt() with the same passphrase = %v, %v, want value", plaintext, err)
+	}
+	// a value sealed without additional data is not bound to a key
+	block, err := aes.NewCipher(bytes.Repeat([]byte{0xab}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	for _, prefix := range []string{"kvzenc:v1:", "kvzenc:v2:"} {
+		unbound := prefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte("unbound"), nil))
+		if _, err := keyFileCipher.Decrypt(unbound, data); err == nil {
+			t.Errorf("Decrypt() of a %s value without additional data should fail", prefix)
+		}
+	}
+	if _, err := kv.NewKeyFileCipher(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("NewKeyFileCipher() should fail for a missing file")
+	}
+}
+
+func Test_kvService_ContextCancelled(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+	if err := service.SetScriptHook(ctx, "slow", "sleep 5"); err != nil {
+		t.Fatal(err)
+	}
+	hooks := []kv.Hook{{Name: "slow", Script: "sleep 5"}}
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	outputs, err := service.ExecHooks(timeoutCtx, hooks, "val")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("kvService.ExecHooks() took %v after the context was cancelled", elapsed)
+	}
+	if len(outputs) != 1 || outputs[0].Error == nil {
+		t.Errorf("kvService.ExecHooks() should report the killed hook, got %+v", outputs)
+	}
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := service.Set(cancelledCtx, "k1", "val"); err == nil {
+		t.Errorf("kvService.Set() should fail with a cancelled context")
+	}
+	if _, err := service.ExecHooks(cancelledCtx, hooks, "val"); !errors.Is(err, context.Canceled) {
+		t.Errorf("kvService.ExecHooks() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func Test_kvService_Errors(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+	if err := service.Set(ctx, "k1", "val"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "h1", "echo hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k1", "h1"); err != nil {
+		t.Fatal(err)
+	}
+	_, getErr := service.Get(ctx, "missing")
+	_, attachedErr := service.GetAttachedHooks(ctx, "missing")
+	_, _, versionErr := service.GetWithVersion(ctx, "missing")
+	tests := []struct {
+		name     string
+		err      error
+		want     error
+		exitCode int
+	}{
+		{"Get missing key", getErr, kv.ErrKeyNotFound, kv.ExitKeyNotFound},
+		{"Attached hooks of missing key", attachedErr, kv.ErrKeyNotFound, kv.ExitKeyNotFound},
+		{"Version of missing key", versionErr, kv.ErrKeyNotFound, kv.ExitKeyNotFound},
+		{"Delete missing key", service.Delete(ctx, "missing"), kv.ErrKeyNotFound, kv.ExitKeyNotFound},
+		{"Delete missing hook", service.DeleteHook(ctx, "missing"), kv.ErrHookNotFound, kv.ExitHookNotFound},
+		{"Attach missing hook", service.AttachHook(ctx, "k1", "missing"), kv.ErrHookNotFound, kv.ExitHookNotFound},
+		{"Attach twice", service.AttachHook(ctx, "k1", "h1"), kv.ErrAlreadyAttached, kv.ExitAlreadyAttached},
+		{"Empty key", service.Set(ctx, "", "val"), kv.ErrValidation, kv.ExitValidation},
+		{"Invalid namespace", service.DeleteNamespace(ctx, "a//b"), kv.ErrValidation, kv.ExitValidation},
+		{"Version conflict", service.SetIfVersion(ctx, "k1", "val", 5), kv.ErrConflict, kv.ExitConflict},
+		{"Search unavailable", fmt.Errorf("failed to search: %w", kv.ErrSearchUnavailable), kv.ErrSearchUnavailable, kv.ExitSearchUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !errors.Is(tt.err, tt.want) {
+				t.Errorf("error = %v, want %v", tt.err, tt.want)
+			}
+			if got := kv.ExitCode(tt.err); got != tt.exitCode {
+				t.Errorf("kv.ExitCode() = %v, want %v", got, tt.exitCode)
+			}
+		})
+	}
+	var validationErr *kv.ValidationError
+	if err := service.DeclareType(ctx, "k1", kv.TypeInt); !errors.As(err, &validationErr) {
+		t.Errorf("kvService.DeclareType() error = %v, want a *kv.ValidationError", err)
+	}
+	if got := kv.ExitCode(nil); got != kv.ExitOK {
+		t.Errorf("kv.ExitCode(nil) = %v, want %v", got, kv.ExitOK)
+	}
+}
+
+func Test_kvService_DeleteReferenced(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+	for _, key := range []string{"k1", "k2"} {
+		if err := service.Set(ctx, key, "val"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.SetScriptHook(ctx, "h1", "echo hello"); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"k1", "k2"} {
+		if err := service.AttachHook(ctx, key, "h1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.AttachHook(ctx, "k1", "h1", kv.EventExpire); !errors.Is(err, kv.ErrAlreadyAttached) {
+		t.Errorf("kvService.AttachHook() error = %v, want %v", err, kv.ErrAlreadyAttached)
+	}
+	if err := service.DeleteHook(ctx, "h1"); !errors.Is(err, kv.ErrInUse) {
+		t.Errorf("kvService.DeleteHook() error = %v, want %v", err, kv.ErrInUse)
+	}
+	// the attachments of a key do not keep it from being deleted
+	if err := service.Delete(ctx, "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "k1", "val"); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err := service.GetAttachedHooks(ctx, "k1"); err != nil || len(hooks) != 0 {
+		t.Errorf("kvService.GetAttachedHooks() = %v, %v, the attachment should be deleted with the key", hooks, err)
+	}
+	// updating a hook keeps its attachments
+	if err := service.SetScriptHook(ctx, "h1", "echo updated"); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err := service.GetAttachedHooks(ctx, "k2"); err != nil || len(hooks) != 1 || hooks[0].Script != "echo updated" {
+		t.Errorf("kvService.GetAttachedHooks() = %v, %v, want the updated h1 hook", hooks, err)
+	}
+	if err := service.DeleteHook(ctx, "h1", kv.Force()); err != nil {
+		t.Fatal(err)
+	}
+	if hooks, err := service.GetAttachedHooks(ctx, "k2"); err != nil || len(hooks) != 0 {
+		t.Errorf("kvService.GetAttachedHooks() = %v, %v, the attachment should be deleted with the hook", hooks, err)
+	}
+	if err := service.Delete(ctx, "k2"); err != nil {
+		t.Errorf("kvService.Delete() error = %v, want nil once nothing is attached", err)
+	}
+}
+
+func Test_kvService_Attachments(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+	for _, key := range []string{"db/host", "db/port", "web/host"} {
+		if err := service.Set(ctx, key, "val"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, hook := range []string{"h1", "h2"} {
+		if err := service.SetScriptHook(ctx, hook, "echo hello"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.AttachHook(ctx, "db/host", "h1"); err != nil {
+		t.Fatal(err)
+	}
+	attached, err := service.AttachHookMatching(ctx, kv.ListOptions{Prefix: "db/"}, "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db/port"}; !reflect.DeepEqual(attached, want) {
+		t.Errorf("kvService.AttachHookMatching() = %v, want %v", attached, want)
+	}
+	if _, err := service.AttachHookMatching(ctx, kv.ListOptions{}, "missing"); !errors.Is(err, kv.ErrHookNotFound) {
+		t.Errorf("kvService.AttachHookMatching() error = %v, want %v", err, kv.ErrHookNotFound)
+	}
+	if _, err := service.AttachHookMatching(ctx, kv.ListOptions{Glob: "*/host"}, "h2"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := service.GetHookKeys(ctx, "h1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db/host", "db/port"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("kvService.GetHookKeys() = %v, want %v", keys, want)
+	}
+	if err := service.DetachHook(ctx, "db/port", "h1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DetachHook(ctx, "db/port", "h1"); !errors.Is(err, kv.ErrHookNotFound) {
+		t.Errorf("kvService.DetachHook() error = %v, want %v", err, kv.ErrHookNotFound)
+	}
+	detached, err := service.DetachHookMatching(ctx, kv.ListOptions{Regex: "host$"}, "h2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"db/host", "web/host"}; !reflect.DeepEqual(detached, want) {
+		t.Errorf("kvService.DetachHookMatching() = %v, want %v", detached, want)
+	}
+	count, err := service.DetachAllHooks(ctx, "db/host")
+	if err != nil || count != 1 {
+		t.Errorf("kvService.DetachAllHooks() = %v, %v, want 1", count, err)
+	}
+	if keys, err := service.GetHookKeys(ctx, "h1"); err != nil || len(keys) != 0 {
+		t.Errorf("kvService.GetHookKeys() = %v, %v, want no keys", keys, err)
+	}
+}
+
+func Test_kvService_Rename(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+	for _, key := range []string{"db_host_dev", "db_port_dev", "other"} {
+		if err := service.Set(ctx, key, "1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.DeclareType(ctx, "db_port_dev", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetDescription(ctx, "db_port_dev", "database port"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "db_port_dev", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "h1", "echo hello"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "db_port_dev", "h1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.Rename(ctx, "db_port_dev", "other"); !errors.Is(err, kv.ErrKeyExists) {
+		t.Errorf("kvService.Rename() error = %v, want %v", err, kv.ErrKeyExists)
+	}
+	if err := service.Rename(ctx, "missing", "new"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.Rename() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+	if err := service.Copy(ctx, "db_port_dev", "db_port_copy"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []kv.KeyRename{
+		{Old: "db_host_dev", New: "db_host"},
+		{Old: "db_port_dev", New: "db_port"},
+	}
+	renames, err := service.RenameMatching(ctx, "_dev$", "", kv.DryRun())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("kvService.RenameMatching() = %v, want %v", renames, want)
+	}
+	if _, err := service.Get(ctx, "db_host_dev"); err != nil {
+		t.Errorf("kvService.RenameMatching() with DryRun() should not rename, got %v", err)
+	}
+	if _, err := service.RenameMatching(ctx, "^db_(host|port)_dev$", "db"); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.RenameMatching() error = %v, want %v", err, kv.ErrValidation)
+	}
+	renames, err = service.RenameMatching(ctx, "_dev$", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(renames, want) {
+		t.Errorf("kvService.RenameMatching() = %v, want %v", renames, want)
+	}
+
+	for _, key := range []string{"db_port", "db_port_copy"} {
+		info, err := service.Info(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Type != kv.TypeInt || info.Description != "database port" || !reflect.DeepEqual(info.Tags, []string{"db"}) {
+			t.Errorf("kvService.Info(%s) = %+v, want the metadata of db_port_dev", key, info)
+		}
+		hooks, err := service.GetAttachedHooks(ctx, key)
+		if err != nil || len(hooks) != 1 {
+			t.Errorf("kvService.GetAttachedHooks(%s) = %v, %v, want the h1 hook", key, hooks, err)
+		}
+	}
+	if _, err := service.Get(ctx, "db_port_dev"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.Get() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+	revisions, err := service.History(ctx, "db_port_dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := revisions[len(revisions)-1]; !last.Deleted {
+		t.Errorf("kvService.History() should end with a deletion after a rename, got %+v", last)
+	}
+
+	// the moved value must be valid for the type and schema of the new key
+	if err := service.Set(ctx, "name", "kvz"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeclareType(ctx, "replicas", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetSchema(ctx, kv.Schema{Keys: []kv.SchemaKey{{Key: "env", Enum: []string{"dev", "prod"}}}}); err != nil {
+		t.Fatal(err)
+	}
+	for name, move := range map[string]func() error{
+		"Rename onto a declared type": func() error { return service.Rename(ctx, "name", "replicas") },
+		"Copy onto a declared type":   func() error { return service.Copy(ctx, "name", "replicas") },
+		"Copy against the schema":     func() error { return service.Copy(ctx, "name", "env") },
+		"Rename against the schema": func() error {
+			_, err := service.RenameMatching(ctx, "^name$", "env")
+			return err
+		},
+		"Copy of another type": func() error {
+			if err := service.DeclareType(ctx, "ttl", kv.TypeDuration); err != nil {
+				t.Fatal(err)
+			}
+			return service.Copy(ctx, "db_port", "ttl")
+		},
+	} {
+		if err := move(); !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("%s error = %v, want %v", name, err, kv.ErrValidation)
+		}
+	}
+	if _, err := service.Get(ctx, "name"); err != nil {
+		t.Errorf("kvService.Get() after a rejected rename error = %v, want the key kept", err)
+	}
+	if err := service.Set(ctx, "count", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Copy(ctx, "count", "replicas"); err != nil {
+		t.Fatal(err)
+	}
+	if valueType, err := service.GetType(ctx, "replicas"); err != nil || valueType != kv.TypeInt {
+		t.Errorf("kvService.GetType() after Copy() = %v, %v, want the declared int kept", valueType, err)
+	}
+}
+
+func Test_kvService_HookDispatch(t *testing.T) {
+	ctx := context.Background()
+	var reports []kv.HookReport
+	service := setupService(t, kv.WithHookReporter(func(report kv.HookReport) {
+		reports = append(reports, report)
+	}))
+	if err := service.Set(ctx, "k1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", `echo "$KVZ_EVENT $KVZ_KEY $OLD_VAL $NEW_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k1", "print", kv.EventSet, kv.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{"Update", func() error { return service.Set(ctx, "k1", "v2") }, []string{"update k1 v1 v2\n"}},
+		{"Same value", func() error { return service.Set(ctx, "k1", "v2") }, nil},
+		{"Skipped", func() error { return service.Set(kv.SkipHooks(ctx), "k1", "v3") }, nil},
+		{"Versioned update", func() error {
+			_, version, err := service.GetWithVersion(ctx, "k1")
+			if err != nil {
+				return err
+			}
+			return service.SetIfVersion(ctx, "k1", "v4", version)
+		}, []string{"update k1 v3 v4\n"}},
+		{"Batch", func() error {
+			_, err := service.Apply(ctx, []kv.Op{
+				{Type: kv.OpSet, Key: "k1", Val: "v5"},
+				{Type: kv.OpSet, Key: "k1", Val: "v4"},
+			})
+			return err
+		}, nil},
+		{"Delete", func() error { return service.Delete(ctx, "k1") }, []string{"delete k1 v4 \n"}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			reports = nil
+			if err := step.change(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, report := range reports {
+				if report.Err != nil {
+					t.Errorf("hook report error = %v", report.Err)
+				}
+				for _, output := range report.Outputs {
+					got = append(got, output.Stdout)
+				}
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("hook outputs = %q, want %q", got, step.want)
+			}
+		})
+	}
+}
+
+func Test_kvService_Ops(t *testing.T) {
+	service := setupService(t)
+	ctx := context.Background()
+
+	if got, err := service.Incr(ctx, "counter", 5); err != nil || got != 5 {
+		t.Errorf("kvService.Incr() = %v, %v, want 5", got, err)
+	}
+	if got, err := service.Decr(ctx, "counter", 7); err != nil || got != -2 {
+		t.Errorf("kvService.Decr() = %v, %v, want -2", got, err)
+	}
+	if err := service.Set(ctx, "name", "kv", kv.WithTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Incr(ctx, "name", 1); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Incr() error = %v, want %v", err, kv.ErrValidation)
+	}
+	if got, err := service.Append(ctx, "name", "z"); err != nil || got != "kvz" {
+		t.Errorf("kvService.Append() = %v, %v, want kvz", got, err)
+	}
+	info, err := service.Info(ctx, "name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.ExpiresAt.IsZero() {
+		t.Errorf("kvService.Append() should keep the expiry of the key")
+	}
+
+	list, err := service.ListPush(ctx, "list", "a", "b", "a", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"a", "b", "a", "c"}; !reflect.DeepEqual(list, want) {
+		t.Errorf("kvService.ListPush() = %v, want %v", list, want)
+	}
+	if got, err := service.ListPop(ctx, "list"); err != nil || got != "c" {
+		t.Errorf("kvService.ListPop() = %v, %v, want c", got, err)
+	}
+	if got, err := service.ListRemove(ctx, "list", "a"); err != nil || got != 2 {
+		t.Errorf("kvService.ListRemove() = %v, %v, want 2", got, err)
+	}
+	if got, err := service.ListPop(ctx, "list"); err != nil || got != "b" {
+		t.Errorf("kvService.ListPop() = %v, %v, want b", got, err)
+	}
+	if _, err := service.ListPop(ctx, "list"); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.ListPop() error = %v, want %v", err, kv.ErrValidation)
+	}
+	if _, err := service.ListPop(ctx, "missing"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.ListPop() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+	if _, err := service.ListPush(ctx, "name", "x"); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.ListPush() error = %v, want %v", err, kv.ErrValidation)
+	}
+
+	// the errors do not quote the value, it may be a secret
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := setupService(t, kv.WithCipher(cipher))
+	if err := secrets.Set(ctx, "password", "hunter2", kv.AsSecret()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secrets.Incr(ctx, "password", 1); !errors.Is(err, kv.ErrValidation) || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("kvService.Incr() on a secret error = %v, want a %v without the value", err, kv.ErrValidation)
+	}
+	if _, err := secrets.ListPush(ctx, "password", "x"); !errors.Is(err, kv.ErrValidation) || strings.Contains(err.Error(), "hunter2") {
+		t.Errorf("kvService.ListPush() on a secret error = %v, want a %v without the value", err, kv.ErrValidation)
+	}
+}
+
+func Test_kvService_IncrConcurrent(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "kv.db")
+	// half of the writers use a connection of their own, like another
+	// process would
+	var services []kv.KvService
+	for i := 0; i < 2; i++ {
+		db, err := sqlite.OpenDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := sqlite.NewSqliteMigrator(db).Migrate(); err != nil {
+			t.Fatal(err)
+		}
+		services = append(services, kv.NewServcice(sqlite.NewRepository(sqlite.New(db))))
+	}
+
+	const workers = 64
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := 0; i < workers; i++ {
+		service := services[i%len(services)]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.Incr(ctx, "counter", 1); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("kvService.Incr() error = %v", err)
+	}
+	if got, err := services[0].Get(ctx, "counter"); err != nil || got != fmt.Sprint(workers) {
+		t.Errorf("kvService.Incr() from %d goroutines = %v, %v, want %d", workers, got, err, workers)
+	}
+}
+
+func Test_kvService_Search(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	service := kv.NewServcice(sqlite.NewRepository(sqlite.New(db)), kv.WithCipher(cipher))
+	if _, err := service.Search(ctx, "db", 0); errors.Is(err, kv.ErrSearchUnavailable) {
+		t.Skip("sqlite was built without FTS5, run the tests with -tags sqlite_fts5")
+	}
+
+	for key, val := range map[string]string{
+		"db_host":  "db.internal.example.com",
+		"api_url":  "https://api.example.com",
+		"timeout":  "30",
+		"old_host": "legacy.example.com",
+	} {
+		if err := service.Set(ctx, key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := service.Set(ctx, "db_password", "internal-hunter2", kv.AsSecret()); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetDescription(ctx, "timeout", "request timeout of the internal api"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "api_url", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Rename(ctx, "old_host", "legacy_host"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"Value", "internal", []string{"db_host", "timeout"}},
+		{"Key name", "db", []string{"db_host", "db_password"}},
+		{"Every term", "example api", []string{"api_url"}},
+		{"Prefix", "legac", []string{"legacy_host"}},
+		{"Tag", "public", []string{"api_url"}},
+		{"Secret value", "hunter2", nil},
+		{"Quotes", `"db`, []string{"db_host", "db_password"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := service.Search(ctx, tt.query, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var keys []string
+			for _, result := range results {
+				keys = append(keys, result.Key)
+			}
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("kvService.Search(%q) = %v, want %v", tt.query, keys, tt.want)
+			}
+		})
+	}
+
+	results, err := service.Search(ctx, "db", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Snippet, "[db]") {
+		t.Errorf("kvService.Search() = %+v, want a single result with a snippet", results)
+	}
+	if err := service.Delete(ctx, "db_host"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := service.Search(ctx, "internal", 0); len(results) != 1 {
+		t.Errorf("kvService.Search() after Delete() = %+v, want only the timeout key", results)
+	}
+	if err := service.RemoveTags(ctx, "api_url", "public"); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := service.Search(ctx, "public", 0); len(results) != 0 {
+		t.Errorf("kvService.Search() after RemoveTags() = %+v, want none", results)
+	}
+	// migrating again keeps the index in sync with the keys
+	if err := sqlite.NewSqliteMigrator(db).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := service.Search(ctx, "legacy", 0); len(results) != 1 || results[0].Key != "legacy_host" {
+		t.Errorf("kvService.Search() after migrating again = %+v, want legacy_host", results)
+	}
+	if _, err := service.Search(ctx, " ", 0); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Search() error = %v, want %v", err, kv.ErrValidation)
+	}
+}
+
+func Test_kvService_ExportImport(t *testing.T) {
+	ctx := context.Background()
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := setupService(t, kv.WithCipher(cipher))
+	if err := source.Set(ctx, "port", "5432"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.DeclareType(ctx, "port", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Set(ctx, "motd", "line one\nsay \"hi\" to $USER", kv.WithTTL(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SetDescription(ctx, "motd", "message of the day"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.AddTags(ctx, "motd", "ui", "text"); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.Set(ctx, "token", "s3cr3t", kv.AsSecret()); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.SetScriptHook(ctx, "print", `echo "$KVZ_KEY"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := source.AttachHook(ctx, "port", "print", kv.EventUpdate, kv.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []kv.Format{kv.FormatJSON, kv.FormatYAML, kv.FormatTOML, kv.FormatDotenv} {
+		t.Run(string(format), func(t *testing.T) {
+			var opts []kv.ExportOption
+			if format != kv.FormatDotenv {
+				opts = append(opts, kv.IncludeHooks(), kv.IncludeSecrets())
+			}
+			var exported bytes.Buffer
+			if err := source.Export(ctx, &exported, format, opts...); err != nil {
+				t.Fatal(err)
+			}
+			target, err := source.WithNamespace("import-" + string(format))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := target.Import(ctx, &exported, format)
+			if err != nil {
+				t.Fatalf("kvService.Import() error = %v, exported:\n%s", err, exported.String())
+			}
+			want := []string{"motd", "port", "token"}
+			if format == kv.FormatDotenv {
+				want = []string{"motd", "port"}
+			}
+			if !reflect.DeepEqual(result.Created, want) {
+				t.Errorf("kvService.Import() created %v, want %v", result.Created, want)
+			}
+			for _, key := range want {
+				got, err := target.Get(ctx, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				val, _ := source.Get(ctx, key)
+				if got != val {
+					t.Errorf("imported %s = %q, want %q", key, got, val)
+				}
+			}
+			if format == kv.FormatDotenv {
+				return
+			}
+			info, err := target.Info(ctx, "motd")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Description != "message of the day" || !reflect.DeepEqual(info.Tags, []string{"text", "ui"}) || info.ExpiresAt.IsZero() {
+				t.Errorf("imported metadata of motd = %+v", info)
+			}
+			if info, _ := target.Info(ctx, "token"); !info.Secret {
+				t.Errorf("imported token should be secret")
+			}
+			if valueType, _ := target.GetType(ctx, "port"); valueType != kv.TypeInt {
+				t.Errorf("imported type of port = %v, want %v", valueType, kv.TypeInt)
+			}
+			hooks, err := target.GetAttachedHooks(ctx, "port")
+			if err != nil || len(hooks) != 1 || hooks[0].Name != "print" {
+				t.Errorf("imported hooks of port = %v, %v", hooks, err)
+			}
+		})
+	}
+
+	t.Run("Modes", func(t *testing.T) {
+		target, err := source.WithNamespace("modes")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, val := range map[string]string{"port": "1", "stale": "x"} {
+			if err := target.Set(ctx, key, val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		const dotenv = "# comment\nexport port=5432\nhost='db.local'\n"
+		result, err := target.Import(ctx, strings.NewReader(dotenv), kv.FormatDotenv, kv.WithImportMode(kv.ImportReplace), kv.ImportDryRun())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := kv.ImportResult{Created: []string{"host"}, Updated: []string{"port"}, Deleted: []string{"stale"}}
+		if !reflect.DeepEqual(result, want) {
+			t.Errorf("kvService.Import() with ImportDryRun() = %+v, want %+v", result, want)
+		}
+		if _, err := target.Get(ctx, "stale"); err != nil {
+			t.Errorf("kvService.Import() with ImportDryRun() should not delete, got %v", err)
+		}
+		result, err = target.Import(ctx, strings.NewReader(dotenv), kv.FormatDotenv, kv.WithImportMode(kv.ImportSkipExisting))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := target.Get(ctx, "port"); got != "1" || !reflect.DeepEqual(result.Skipped, []string{"port"}) {
+			t.Errorf("kvService.Import() with ImportSkipExisting = %+v, port = %s", result, got)
+		}
+		if _, err := target.Import(ctx, strings.NewReader(dotenv), kv.FormatDotenv, kv.WithImportMode(kv.ImportReplace)); err != nil {
+			t.Fatal(err)
+		}
+		keys, err := target.ListKeys(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(keys, []string{"host", "port"}) {
+			t.Errorf("kvService.ListKeys() after ImportReplace = %v", keys)
+		}
+		if _, err := target.Import(ctx, strings.NewReader("not an env file"), kv.FormatDotenv); !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("kvService.Import() error = %v, want %v", err, kv.ErrValidation)
+		}
+	})
+}
+
+func Test_kvService_Snapshots(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	other, err := service.WithNamespace("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, val := range map[string]string{"host": "db.local", "port": "5432", "user": "admin"} {
+		if err := service.Set(ctx, key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := other.Set(ctx, "host", "other.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeclareType(ctx, "port", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "host", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", "echo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "host", "print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreateSnapshot(ctx, "before"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CreateSnapshot(ctx, "before"); !errors.Is(err, kv.ErrSnapshotExists) {
+		t.Errorf("kvService.CreateSnapshot() error = %v, want %v", err, kv.ErrSnapshotExists)
+	}
+
+	if err := service.Set(ctx, "host", "db.remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(ctx, "user"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "timeout", "30"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AddTags(ctx, "port", "db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Delete(ctx, "host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeleteHook(ctx, "print", kv.Force()); err != nil {
+		t.Fatal(err)
+	}
+
+	diffs, err := service.DiffSnapshot(ctx, "before")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantDiffs := []kv.SnapshotDiff{
+		{Namespace: "default", Name: "host", Kind: kv.DiffChanged},
+		{Namespace: "default", Name: "port", Kind: kv.DiffChanged},
+		{Namespace: "default", Name: "timeout", Kind: kv.DiffAdded},
+		{Namespace: "default", Name: "user", Kind: kv.DiffRemoved},
+		{Namespace: "other", Name: "host", Kind: kv.DiffRemoved},
+		{Namespace: "default", Name: "print", Hook: true, Kind: kv.DiffRemoved},
+	}
+	if !reflect.DeepEqual(diffs, wantDiffs) {
+		t.Errorf("kvService.DiffSnapshot() = %+v, want %+v", diffs, wantDiffs)
+	}
+
+	if err := service.RestoreSnapshot(ctx, "before", "host", "timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := service.Get(ctx, "host"); got != "db.local" {
+		t.Errorf("restored host = %s, want db.local", got)
+	}
+	if _, err := service.Get(ctx, "timeout"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.RestoreSnapshot() should delete keys missing from the snapshot, got %v", err)
+	}
+	if hooks, _ := service.GetAttachedHooks(ctx, "host"); len(hooks) != 1 {
+		t.Errorf("kvService.RestoreSnapshot() should restore the attached hooks, got %v", hooks)
+	}
+	if _, err := service.Get(ctx, "user"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.RestoreSnapshot() with keys should only restore them, got %v", err)
+	}
+	if err := service.RestoreSnapshot(ctx, "before", "missing"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.RestoreSnapshot() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+
+	if err := service.RestoreSnapshot(ctx, "before"); err != nil {
+		t.Fatal(err)
+	}
+	if diffs, err := service.DiffSnapshot(ctx, "before"); err != nil || len(diffs) != 0 {
+		t.Errorf("kvService.DiffSnapshot() after a full restore = %+v, %v", diffs, err)
+	}
+	if got, _ := other.Get(ctx, "host"); got != "other.local" {
+		t.Errorf("restored other/host = %s, want other.local", got)
+	}
+
+	snapshots, err := service.ListSnapshots(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "before" || snapshots[0].Keys != 4 {
+		t.Errorf("kvService.ListSnapshots() = %+v", snapshots)
+	}
+	if err := service.DeleteSnapshot(ctx, "before"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.DiffSnapshot(ctx, "before"); !errors.Is(err, kv.ErrSnapshotNotFound) {
+		t.Errorf("kvService.DiffSnapshot() error = %v, want %v", err, kv.ErrSnapshotNotFound)
+	}
+
+	// secrets are compared once decrypted, they are encrypted anew on every
+	// write
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secrets := setupService(t, kv.WithCipher(cipher))
+	for _, key := range []string{"token", "password"} {
+		if err := secrets.Set(ctx, key, "s3cr3t", kv.AsSecret()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := secrets.CreateSnapshot(ctx, "sealed"); err != nil {
+		t.Fatal(err)
+	}
+	// moving a secret encrypts it again
+	if err := secrets.Rename(ctx, "token", "moved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.Rename(ctx, "moved", "token"); err != nil {
+		t.Fatal(err)
+	}
+	if err := secrets.Set(ctx, "password", "rotated"); err != nil {
+		t.Fatal(err)
+	}
+	diffs, err = secrets.DiffSnapshot(ctx, "sealed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []kv.SnapshotDiff{{Namespace: kv.DefaultNamespace, Name: "password", Kind: kv.DiffChanged}}; !reflect.DeepEqual(diffs, want) {
+		t.Errorf("kvService.DiffSnapshot() of secrets = %+v, want %+v", diffs, want)
+	}
+}
+
+func Test_kvService_Audit(t *testing.T) {
+	ctx := context.Background()
+	db := setupDB(t)
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actor := kv.Actor{User: "alice", Host: "laptop", PID: 42, Command: "kvz set --secret token hunter2"}
+	service := kv.NewServcice(sqlite.NewRepository(sqlite.New(db)), kv.WithCipher(cipher), kv.WithActor(actor))
+	start := time.Now()
+	if err := service.Set(ctx, "host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "host", "db.remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", "echo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "host", "print"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(ctx, "host"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "token", "hunter2", kv.AsSecret()); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(ctx, "missing"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Fatalf("kvService.Delete() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+
+	entries, err := service.QueryAudit(ctx, kv.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	type summary struct {
+		action kv.AuditAction
+		target string
+		oldVal string
+		newVal string
+	}
+	deref := func(s *string) string {
+		if s == nil {
+			return "<nil>"
+		}
+		return *s
+	}
+	var got []summary
+	for _, entry := range entries {
+		got = append(got, summary{entry.Action, entry.Target, deref(entry.OldVal), deref(entry.NewVal)})
+	}
+	want := []summary{
+		{kv.AuditSet, "host", "<nil>", "db.local"},
+		{kv.AuditSet, "host", "db.local", "db.remote"},
+		{kv.AuditSetHook, "print", "<nil>", "echo"},
+		{kv.AuditAttachHook, "host", "<nil>", "print [set]"},
+		{kv.AuditDelete, "host", "db.remote", "<nil>"},
+		{kv.AuditSet, "token", "<nil>", kv.SecretMask},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("kvService.QueryAudit() = %+v, want %+v", got, want)
+	}
+	first := entries[0]
+	if first.User != "alice" || first.Host != "laptop" || first.PID != 42 || first.Namespace != kv.DefaultNamespace {
+		t.Errorf("kvService.QueryAudit() should record the actor, got %+v", first)
+	}
+	if first.At.Before(start.Add(-time.Second)) || first.At.After(time.Now().Add(time.Second)) {
+		t.Errorf("kvService.QueryAudit() recorded at %v, want about %v", first.At, start)
+	}
+	if secret := entries[len(entries)-1]; strings.Contains(secret.Command, "hunter2") {
+		t.Errorf("kvService.QueryAudit() should redact the command line of secrets, got %q", secret.Command)
+	}
+
+	filtered, err := service.QueryAudit(ctx, kv.AuditFilter{Key: "host", User: "alice", Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filtered) != 2 || filtered[0].ID != entries[3].ID || filtered[1].ID != entries[4].ID {
+		t.Errorf("kvService.QueryAudit() with a limit should keep the most recent entries, got %+v", filtered)
+	}
+	if none, err := service.QueryAudit(ctx, kv.AuditFilter{User: "bob"}); err != nil || len(none) != 0 {
+		t.Errorf("kvService.QueryAudit() with a user filter = %+v, %v", none, err)
+	}
+	if none, err := service.QueryAudit(ctx, kv.AuditFilter{Since: time.Now().Add(time.Hour)}); err != nil || len(none) != 0 {
+		t.Errorf("kvService.QueryAudit() with a time range = %+v, %v", none, err)
+	}
+	if _, err := service.QueryAudit(ctx, kv.AuditFilter{Since: time.Now(), Until: start}); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.QueryAudit() error = %v, want %v", err, kv.ErrValidation)
+	}
+
+	if _, err := db.Exec("UPDATE audit_log SET os_user = 'mallory'"); err == nil {
+		t.Error("the audit log should reject updates")
+	}
+	if _, err := db.Exec("DELETE FROM audit_log"); err == nil {
+		t.Error("the audit log should reject deletes")
+	}
+
+	var buf bytes.Buffer
+	if err := kv.WriteAuditJSONLines(&buf, entries[:2]); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[0], `"action":"set"`) || strings.Contains(lines[0], "old_val") {
+		t.Errorf("kv.WriteAuditJSONLines() = %s", buf.String())
+	}
+}
+
+func Test_kvService_Profiles(t *testing.T) {
+	ctx := context.Background()
+	var reports []kv.HookReport
+	service := setupService(t, kv.WithHookReporter(func(report kv.HookReport) {
+		reports = append(reports, report)
+	}))
+	staging, err := service.WithNamespace("staging")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetProfile(ctx, "prod", kv.DefaultNamespace, "staging", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetProfile(ctx, "bad", "prod", "prod"); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.SetProfile() error = %v, want %v", err, kv.ErrValidation)
+	}
+	if _, err := service.WithProfile(ctx, "missing"); !errors.Is(err, kv.ErrProfileNotFound) {
+		t.Errorf("kvService.WithProfile() error = %v, want %v", err, kv.ErrProfileNotFound)
+	}
+	prod, err := service.WithProfile(ctx, "prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prod.Namespace() != "prod" || prod.Profile().Name != "prod" {
+		t.Errorf("kvService.WithProfile() is bound to %s/%+v", prod.Namespace(), prod.Profile())
+	}
+
+	if err := service.Set(ctx, "port", "5432"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.DeclareType(ctx, "port", kv.TypeInt); err != nil {
+		t.Fatal(err)
+	}
+	if err := staging.Set(ctx, "user", "staging"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.Set(ctx, "user", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]kv.Resolved{
+		"port": {Val: "5432", Layer: kv.DefaultNamespace},
+		"user": {Val: "admin", Layer: "prod"},
+	} {
+		if got, err := prod.Resolve(ctx, key); err != nil || got != want {
+			t.Errorf("kvService.Resolve(%s) = %+v, %v, want %+v", key, got, err, want)
+		}
+	}
+	if got, err := prod.GetTyped(ctx, "port"); err != nil || got != int64(5432) {
+		t.Errorf("kvService.GetTyped() = %v, %v, want the type of the base layer", got, err)
+	}
+	if _, err := prod.Get(ctx, "missing"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.Get() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+
+	if err := prod.SetScriptHook(ctx, "print", `echo "$KVZ_PROFILE $KVZ_EVENT $KVZ_KEY $OLD_VAL $NEW_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.AttachProfileHook(ctx, "prod", "host", "print", kv.EventSet, kv.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	steps := []struct {
+		name   string
+		change func() error
+		want   []string
+	}{
+		{"Base create", func() error { return service.Set(ctx, "host", "db.local") }, []string{"prod create host  db.local\n"}},
+		{"Middle override", func() error { return staging.Set(ctx, "host", "db.staging") }, []string{"prod update host db.local db.staging\n"}},
+		{"Overridden base", func() error { return service.Set(ctx, "host", "db.base") }, nil},
+		{"Top override", func() error { return prod.Set(ctx, "host", "db.prod") }, []string{"prod update host db.staging db.prod\n"}},
+		{"Overridden delete", func() error { return staging.Delete(ctx, "host") }, nil},
+		{"Top delete", func() error { return prod.Delete(ctx, "host") }, []string{"prod update host db.prod db.base\n"}},
+		{"Base delete", func() error { return service.Delete(ctx, "host") }, []string{"prod delete host db.base \n"}},
+	}
+	for _, step := range steps {
+		t.Run(step.name, func(t *testing.T) {
+			reports = nil
+			if err := step.change(); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, report := range reports {
+				if report.Err != nil {
+					t.Errorf("hook report error = %v", report.Err)
+				}
+				if report.Profile != "prod" {
+					t.Errorf("hook report profile = %s, want prod", report.Profile)
+				}
+				for _, output := range report.Outputs {
+					got = append(got, output.Stdout)
+				}
+			}
+			if !reflect.DeepEqual(got, step.want) {
+				t.Errorf("hook outputs = %q, want %q", got, step.want)
+			}
+		})
+	}
+
+	profiles, err := service.ListProfiles(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []kv.Profile{{Name: "prod", Layers: []string{kv.DefaultNamespace, "staging", "prod"}}}
+	if !reflect.DeepEqual(profiles, want) {
+		t.Errorf("kvService.ListProfiles() = %+v, want %+v", profiles, want)
+	}
+	// the hook is only attached through the profile
+	if err := prod.DeleteHook(ctx, "print"); !errors.Is(err, kv.ErrInUse) || !strings.Contains(err.Error(), "prod/host") {
+		t.Errorf("kvService.DeleteHook() of a hook attached to a profile error = %v, want %v naming prod/host", err, kv.ErrInUse)
+	}
+	if err := service.DeleteProfile(ctx, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.DeleteHook(ctx, "print"); err != nil {
+		t.Errorf("kvService.DeleteHook() once the profile is deleted error = %v", err)
+	}
+	if err := service.DeleteProfile(ctx, "prod"); !errors.Is(err, kv.ErrProfileNotFound) {
+		t.Errorf("kvService.DeleteProfile() error = %v, want %v", err, kv.ErrProfileNotFound)
+	}
+	if got, _ := staging.Get(ctx, "user"); got != "staging" {
+		t.Errorf("kvService.DeleteProfile() should keep the layers, got %s", got)
+	}
+}
+
+func Test_kvService_Schema(t *testing.T) {
+	ctx := context.Background()
+	repo := sqlite.NewRepository(sqlite.New(setupDB(t)))
+	service := kv.NewServcice(repo)
+	if err := service.Set(ctx, "port", "80"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "env", "qa"); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := kv.ParseSchema(strings.NewReader(`
+keys:
+  - key: port
+    type: int
+    min: 1024
+    max: 65535
+    required: true
+  - key: env
+    enum: [dev, staging, prod]
+    required: true
+  - key: host
+    pattern: '^[a-z.]+$'
+    default: localhost
+    description: the database host
+  - key: replicas
+    type: int
+    default: "3"
+  - key: user
+    required: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, document := range map[string]string{
+		"Unknown field":      "keys:\n  - key: port\n    kind: int\n",
+		"Duplicate key":      "keys:\n  - key: port\n  - key: port\n",
+		"Invalid pattern":    "keys:\n  - key: port\n    pattern: '['\n",
+		"Range on a string":  "keys:\n  - key: port\n    min: 1\n",
+		"Invalid default":    "keys:\n  - key: port\n    type: int\n    default: http\n",
+		"Required default":   "keys:\n  - key: port\n    required: true\n    default: '80'\n",
+		"Unknown value type": "keys:\n  - key: port\n    type: number\n",
+	} {
+		if _, err := kv.ParseSchema(strings.NewReader(document)); !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("kv.ParseSchema() %s error = %v, want %v", name, err, kv.ErrValidation)
+		}
+	}
+	if err := service.SetSchema(ctx, schema); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := service.GetSchema(ctx); err != nil || !reflect.DeepEqual(stored, schema) {
+		t.Errorf("kvService.GetSchema() = %+v, %v, want %+v", stored, err, schema)
+	}
+
+	violations, err := service.Validate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantViolations := []kv.SchemaViolation{
+		{Namespace: kv.DefaultNamespace, Key: "env", Reason: "must be one of [dev staging prod]"},
+		{Namespace: kv.DefaultNamespace, Key: "port", Reason: "must be at least 1024"},
+		{Namespace: kv.DefaultNamespace, Key: "user", Missing: true, Reason: "the key is required"},
+	}
+	if !reflect.DeepEqual(violations, wantViolations) {
+		t.Errorf("kvService.Validate() = %+v, want %+v", violations, wantViolations)
+	}
+
+	for _, tt := range []struct {
+		key     string
+		val     string
+		wantErr bool
+	}{
+		{"port", "8080", false},
+		{"port", "80", true},
+		{"port", "http", true},
+		{"env", "prod", false},
+		{"env", "qa", true},
+		{"host", "db.local", false},
+		{"host", "DB", true},
+		{"undeclared", "anything", false},
+	} {
+		err := service.Set(ctx, tt.key, tt.val)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("kvService.Set(%s, %s) error = %v, wantErr %v", tt.key, tt.val, err, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("kvService.Set(%s, %s) error = %v, want %v", tt.key, tt.val, err, kv.ErrValidation)
+		}
+	}
+	// a pattern matches the whole value, anchored or not
+	version := kv.SchemaKey{Key: "version", Pattern: `v[0-9]+|latest`}
+	for val, wantErr := range map[string]bool{"v2": false, "latest": false, "v2-rc": true, "xv2": true, "not-latest": true} {
+		if err := version.Check(val); (err != nil) != wantErr {
+			t.Errorf("SchemaKey.Check(%s) error = %v, wantErr %v", val, err, wantErr)
+		}
+	}
+	if _, err := service.Incr(ctx, "port", 100000); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Incr() out of range error = %v, want %v", err, kv.ErrValidation)
+	}
+
+	if got, err := service.Get(ctx, "replicas"); err != nil || got != "3" {
+		t.Errorf("kvService.Get() = %s, %v, want the default", got, err)
+	}
+	if got, err := service.GetTyped(ctx, "replicas"); err != nil || got != int64(3) {
+		t.Errorf("kvService.GetTyped() = %v, %v, want the typed default", got, err)
+	}
+	if resolved, err := service.Resolve(ctx, "replicas"); err != nil || !resolved.Default {
+		t.Errorf("kvService.Resolve() = %+v, %v, want a default", resolved, err)
+	}
+	if _, err := service.Get(ctx, "user"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.Get() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+	if err := service.Set(ctx, "user", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if violations, err := service.Validate(ctx); err != nil || len(violations) != 0 {
+		t.Errorf("kvService.Validate() = %+v, %v, want no violations", violations, err)
+	}
+
+	other, err := service.WithNamespace("other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.Set(ctx, "port", "80"); err != nil {
+		t.Errorf("the schema of a namespace should not apply to the others, got %v", err)
+	}
+	fixed := kv.NewServcice(repo, kv.WithSchema(kv.Schema{Keys: []kv.SchemaKey{{Key: "port", Type: kv.TypeInt}}}))
+	if err := fixed.Set(ctx, "port", "80"); err != nil {
+		t.Errorf("kv.WithSchema() should replace the stored schema, got %v", err)
+	}
+	if err := service.DeleteSchema(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Get(ctx, "replicas"); !errors.Is(err, kv.ErrKeyNotFound) {
+		t.Errorf("kvService.Get() after DeleteSchema() error = %v, want %v", err, kv.ErrKeyNotFound)
+	}
+}
+
+func Test_kvService_Prune(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	for _, write := range [][2]string{{"a", "1"}, {"a", "2"}, {"b", "1"}} {
+		if err := service.Set(ctx, write[0], write[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := service.Set(ctx, "a", "3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(ctx, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "c", "1"); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := service.Prune(ctx, kv.Retention{MaxAge: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the older revisions of b are pruned, its deletion is kept
+	if want := (kv.PruneResult{Changes: 3, Revisions: 3}); result != want {
+		t.Errorf("kvService.Prune() with a max age = %+v, want %+v", result, want)
+	}
+	revisions, err := service.History(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 || revisions[0].Val != "3" {
+		t.Errorf("kvService.History() after Prune() = %+v, want the latest revision", revisions)
+	}
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	changes, err := service.Watch(watchCtx, "", kv.WatchAfter(0), kv.WatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for i := 0; i < 3; i++ {
+		change := <-changes
+		got = append(got, string(change.Op)+" "+change.Key)
+	}
+	cancel()
+	if want := []string{"update a", "delete b", "create c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.Watch() after Prune() = %v, want %v", got, want)
+	}
+
+	// the latest revision of every key is kept whatever the retention
+	result, err = service.Prune(ctx, kv.Retention{MaxChanges: 1, MaxRevisions: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (kv.PruneResult{Changes: 2}); result != want {
+		t.Errorf("kvService.Prune() with a max number of rows = %+v, want %+v", result, want)
+	}
+	audited, err := service.QueryAudit(ctx, kv.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last := audited[len(audited)-1]; last.Action != kv.AuditPrune || last.NewVal == nil || *last.NewVal != "2 changes, 0 revisions" {
+		t.Errorf("kvService.QueryAudit() = %+v, want the last prune", last)
+	}
+	if _, err := service.Prune(ctx, kv.Retention{}); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Prune() without a retention error = %v, want ErrValidation", err)
+	}
+	if _, err := service.Prune(ctx, kv.Retention{MaxChanges: -1}); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Prune() with a negative retention error = %v, want ErrValidation", err)
+	}
+}
+
+func Test_kvService_Watch(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	path := filepath.Join(t.TempDir(), "kv.db")
+	// the watcher and the writers use their own connections, like separate
+	// processes would
+	open := func() *sql.DB {
+		db, err := sqlite.OpenDB(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		return db
+	}
+	watcherDB, writerDB := open(), open()
+	if err := sqlite.NewSqliteMigrator(watcherDB).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := kv.NewPassphraseCipher("correct horse battery staple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := kv.NewServcice(sqlite.NewRepository(sqlite.New(watcherDB)))
+	writer := kv.NewServcice(sqlite.NewRepository(sqlite.New(writerDB)), kv.WithCipher(cipher))
+	if err := writer.Set(ctx, "app.before", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	events, err := watcher.Watch(ctx, "app.", kv.WatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Set(ctx, "app.host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Set(ctx, "other", "ignored"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Set(ctx, "app.host", "db.remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Set(ctx, "app.host", "db.remote"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Rename(ctx, "app.host", "app.db"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Set(ctx, "app.token", "hunter2", kv.AsSecret()); err != nil {
+		t.Fatal(err)
+	}
+	// like a plain value, a secret set to the same value is not a change
+	if err := writer.Set(ctx, "app.token", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writerDB.Exec(`DELETE FROM kv WHERE namespace = 'default' AND "key" = 'app.db'`); err != nil {
+		t.Fatal(err)
+	}
+
+	deref := func(s *string) string {
+		if s == nil {
+			return "<nil>"
+		}
+		return *s
+	}
+	want := []string{
+		"create app.host <nil> db.local",
+		"update app.host db.local db.remote",
+		"delete app.host db.remote <nil>",
+		"create app.db <nil> db.remote",
+		"create app.token <nil> " + kv.SecretMask,
+		"delete app.db db.remote <nil>",
+	}
+	var got []string
+	var last int64
+	for len(got) < len(want) {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				t.Fatalf("kvService.Watch() closed the channel after %q", got)
+			}
+			if event.Err != nil {
+				t.Fatal(event.Err)
+			}
+			if event.Revision <= last {
+				t.Errorf("kvService.Watch() revision %d after %d", event.Revision, last)
+			}
+			last = event.Revision
+			got = append(got, strings.Join([]string{string(event.Op), event.Key, deref(event.OldVal), deref(event.NewVal)}, " "))
+		case <-ctx.Done():
+			t.Fatalf("kvService.Watch() = %q, want %q", got, want)
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.Watch() = %q, want %q", got, want)
+	}
+
+	resumeCtx, stop := context.WithCancel(ctx)
+	resumed, err := watcher.Watch(resumeCtx, "app.", kv.WatchAfter(0), kv.WatchInterval(10*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event := <-resumed; event.Key != "app.before" || event.Op != kv.ChangeCreate {
+		t.Errorf("kvService.Watch() after revision 0 = %+v, want the creation of app.before", event)
+	}
+	stop()
+	for range resumed {
+	}
+}
+
+func Test_kvService_Bus(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	sub, err := service.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+	describe := func(event kv.BusEvent) string {
+		switch e := event.(type) {
+		case kv.KeySet:
+			return fmt.Sprintf("set %s/%s %q -> %q created=%v", e.Namespace, e.Key, e.OldVal, e.NewVal, e.Created)
+		case kv.KeyDeleted:
+			return fmt.Sprintf("deleted %s/%s %q", e.Namespace, e.Key, e.OldVal)
+		case kv.HookAttached:
+			return fmt.Sprintf("attached %s to %s/%s %v", e.Hook, e.Namespace, e.Key, e.Events)
+		case kv.HookExecuted:
+			return fmt.Sprintf("executed %s on %s %s: %s", e.Output.Caller, e.Key, e.Event, strings.TrimSpace(e.Output.Stdout))
+		}
+		return fmt.Sprintf("%T", event)
+	}
+	drain := func() []string {
+		var got []string
+		for {
+			select {
+			case event := <-sub.Events():
+				got = append(got, describe(event))
+			default:
+				return got
+			}
+		}
+	}
+
+	if err := service.Set(ctx, "host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "echo", `echo "$KVZ_KEY=$NEW_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "host", "echo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "host", "db.remote"); err != nil {
+		t.Fatal(err)
+	}
+	// the changes are published even when the hooks are skipped
+	if err := service.Set(kv.SkipHooks(ctx), "host", "db.quiet"); err != nil {
+		t.Fatal(err)
+	}
+	prod, err := service.WithNamespace("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.Set(ctx, "host", "db.prod"); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		`set default/host "" -> "db.local" created=true`,
+		"attached echo to default/host [set]",
+		`set default/host "db.local" -> "db.remote" created=false`,
+		"executed echo on host update: host=db.remote",
+		`set default/host "db.remote" -> "db.quiet" created=false`,
+		`set prod/host "" -> "db.prod" created=true`,
+	}
+	if got := drain(); !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.Subscribe() = %q, want %q", got, want)
+	}
+
+	// a batch is published once committed, and not at all when rolled back
+	_, err = service.Apply(kv.SkipHooks(ctx), []kv.Op{
+		{Type: kv.OpSet, Key: "port", Val: "1"},
+		{Type: kv.OpSet, Key: "port", Val: "2"},
+		{Type: kv.OpDelete, Key: "host"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.Apply(ctx, []kv.Op{{Type: kv.OpSet, Key: "port", Val: "3"}, {Type: kv.OpDelete, Key: "missing"}})
+	if err == nil {
+		t.Fatal("kvService.Apply() deleting a missing key should fail")
+	}
+	want = []string{
+		`set default/port "" -> "2" created=true`,
+		`deleted default/host "db.quiet"`,
+	}
+	if got := drain(); !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.Subscribe() after Apply = %q, want %q", got, want)
+	}
+
+	// keys moved or restored without running hooks are published too
+	if err := service.CreateSnapshot(ctx, "bus"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Rename(ctx, "port", "listen"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Copy(ctx, "listen", "port"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RenameMatching(ctx, "^port$", "bind"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RenameMatching(ctx, "^bind$", "port", kv.DryRun()); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.RestoreSnapshot(ctx, "bus"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		`deleted default/port "2"`,
+		`set default/listen "" -> "2" created=true`,
+		`set default/port "" -> "2" created=true`,
+		`deleted default/port "2"`,
+		`set default/bind "" -> "2" created=true`,
+		`deleted default/bind "2"`,
+		`deleted default/listen "2"`,
+		`set default/port "" -> "2" created=true`,
+	}
+	if got := drain(); !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.Subscribe() after moves and restores = %q, want %q", got, want)
+	}
+
+	t.Run("backpressure", func(t *testing.T) {
+		newest, err := service.Subscribe(kv.BufferSize(1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer newest.Close()
+		oldest, err := service.Subscribe(kv.BufferSize(1), kv.OnFull(kv.DropOldest))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer oldest.Close()
+		for _, val := range []string{"a", "b", "c"} {
+			if err := service.Set(ctx, "level", val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if got := (<-newest.Events()).(kv.KeySet).NewVal; got != "a" || newest.Dropped() != 2 {
+			t.Errorf("DropNewest kept %s and dropped %d, want a and 2", got, newest.Dropped())
+		}
+		if got := (<-oldest.Events()).(kv.KeySet).NewVal; got != "c" || oldest.Dropped() != 2 {
+			t.Errorf("DropOldest kept %s and dropped %d, want c and 2", got, oldest.Dropped())
+		}
+		if _, err := service.Subscribe(kv.BufferSize(0)); !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("kvService.Subscribe() with an empty buffer error = %v, want ErrValidation", err)
+		}
+		if _, err := service.Subscribe(kv.OnFull("wait")); !errors.Is(err, kv.ErrValidation) {
+			t.Errorf("kvService.Subscribe() with an unknown policy error = %v, want ErrValidation", err)
+		}
+	})
+
+	t.Run("callback", func(t *testing.T) {
+		received := make(chan string)
+		callback, err := service.SubscribeFunc(func(event kv.BusEvent) {
+			received <- describe(event)
+		}, kv.OnFull(kv.Block))
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() {
+			done <- service.Delete(ctx, "level")
+		}()
+		if got, want := <-received, `deleted default/level "c"`; got != want {
+			t.Errorf("kvService.SubscribeFunc() = %q, want %q", got, want)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		callback.Close()
+		if err := service.Set(ctx, "level", "d"); err != nil {
+			t.Fatal(err)
+		}
+	})
+	drain()
+	sub.Close()
+	if _, ok := <-sub.Events(); ok {
+		t.Error("Subscription.Events() should be closed once the subscription is")
+	}
+}
+
+func Test_kvService_HookError(t *testing.T) {
+	ctx := context.Background()
+	service := setupService(t)
+	if err := service.SetFileHook(ctx, "script", "#!/bin/sh\necho $NEW_VAL\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "host", "script"); err != nil {
+		t.Fatal(err)
+	}
+	// the script of the hook can not be written to a temporary file
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	err := service.Set(ctx, "host", "db.remote")
+	var hookErr *kv.HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("kvService.Set() error = %v, want a HookError", err)
+	}
+	if val, err := service.Get(ctx, "host"); err != nil || val != "db.remote" {
+		t.Errorf("kvService.Get() after a HookError = %q, %v, want the committed db.remote", val, err)
+	}
+}
+
+func Test_kvService_PurgeExpiredHooks(t *testing.T) {
+	ctx := context.Background()
+	var reports []kv.HookReport
+	service := setupService(t, kv.WithHookReporter(func(report kv.HookReport) {
+		reports = append(reports, report)
+	}))
+	if err := service.SetFileHook(ctx, "script", "#!/bin/sh\necho $OLD_VAL\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetScriptHook(ctx, "print", `echo "$KVZ_EVENT $KVZ_KEY $OLD_VAL"`); err != nil {
+		t.Fatal(err)
+	}
+	expire := func() {
+		t.Helper()
+		for key, hook := range map[string]string{"a": "script", "b": "print", "c": "print"} {
+			if err := service.Set(ctx, key, "old "+key, kv.WithTTL(50*time.Millisecond)); err != nil {
+				t.Fatal(err)
+			}
+			if err := service.AttachHook(ctx, key, hook, kv.EventExpire); err != nil {
+				t.Fatal(err)
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	// the hooks of a are not run, the others still are
+	expire()
+	t.Setenv("TMPDIR", filepath.Join(t.TempDir(), "missing"))
+	outputs, err := service.PurgeExpired(ctx)
+	var hookErr *kv.HookError
+	if !errors.As(err, &hookErr) {
+		t.Fatalf("kvService.PurgeExpired() error = %v, want a HookError", err)
+	}
+	var got []string
+	for _, output := range outputs {
+		got = append(got, output.Stdout)
+	}
+	if want := []string{"expire b old b\n", "expire c old c\n"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kvService.PurgeExpired() outputs = %q, want %q", got, want)
+	}
+	if len(reports) != 3 || reports[0].Event != kv.EventExpire || reports[0].Err == nil {
+		t.Errorf("kvService.PurgeExpired() reports = %+v, want one report per key", reports)
+	}
+	if outputs, err := service.PurgeExpired(ctx); err != nil || len(outputs) != 0 {
+		t.Errorf("kvService.PurgeExpired() second sweep = %v, %v, want every key purged", outputs, err)
+	}
+
+	reports = nil
+	expire()
+	if outputs, err := service.PurgeExpired(kv.SkipHooks(ctx)); err != nil || len(outputs) != 0 || len(reports) != 0 {
+		t.Errorf("kvService.PurgeExpired() with SkipHooks = %v, %v, %d reports, want no hooks", outputs, err, len(reports))
+	}
+	revisions, err := service.History(ctx, "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !revisions[len(revisions)-1].Deleted {
+		t.Errorf("kvService.PurgeExpired() with SkipHooks should still delete the expired keys")
+	}
+}
+
+func Test_kvService_HookTimeout(t *testing.T) {
+	ctx := context.Background()
+	var reports []kv.HookReport
+	service := setupService(t, kv.DefaultPerHookTimeout(50*time.Millisecond), kv.WithHookReporter(func(report kv.HookReport) {
+		reports = append(reports, report)
+	}))
+	pidFile := filepath.Join(t.TempDir(), "child.pid")
+	// the hook waits on a child of its own, both are stopped on timeout
+	if err := service.SetScriptHook(ctx, "slow", "sleep 30 & echo $! > "+pidFile+"; wait"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetHookTimeout(ctx, "slow", 200*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "k1", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k1", "slow"); err != nil {
+		t.Fatal(err)
+	}
+	hooks, err := service.GetAttachedHooks(ctx, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks) != 1 || hooks[0].Timeout != 200*time.Millisecond {
+		t.Fatalf("kvService.GetAttachedHooks() = %+v, want slow with a 200ms timeout", hooks)
+	}
+
+	start := time.Now()
+	if err := service.Set(ctx, "k1", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= kv.HookKillGrace {
+		t.Errorf("the timed out hook ran for %s", elapsed)
+	}
+	if len(reports) != 1 || len(reports[0].Outputs) != 1 {
+		t.Fatalf("hook reports = %+v, want a single output", reports)
+	}
+	output := reports[0].Outputs[0]
+	if !output.TimedOut || !errors.Is(output.Error, kv.ErrHookTimeout) {
+		t.Errorf("CmdOutput = %+v, want a timeout", output)
+	}
+	if pid, err := os.ReadFile(pidFile); err != nil {
+		t.Error(err)
+	} else if stat, err := os.ReadFile(filepath.Join("/proc", strings.TrimSpace(string(pid)), "stat")); err == nil && !strings.Contains(string(stat), ") Z") {
+		t.Errorf("the child of the timed out hook is still running: %s", stat)
+	}
+
+	// the timeout of the write overrides the one of the hook, which
+	// overrides the default of the service
+	reports = nil
+	if err := service.SetScriptHook(ctx, "quick", "sleep 0.1; echo done"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "k2", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k2", "quick", kv.EventUpdate, kv.EventDelete); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "k2", "v2", kv.WithHookTimeout(0)); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Delete(ctx, "k2", kv.WithDeleteHookTimeout(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("hook reports = %+v, want one per write", reports)
+	}
+	for _, report := range reports {
+		if output := report.Outputs[0]; output.TimedOut || output.Stdout != "done\n" {
+			t.Errorf("the %s hook with the timeout of the write = %+v, want done", report.Event, output)
+		}
+	}
+	if err := service.Set(ctx, "k2", "v3", kv.WithHookTimeout(-time.Second)); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.Set() with a negative hook timeout error = %v, want ErrValidation", err)
+	}
+	quick := kv.Hook{Name: "quick", Script: "sleep 0.1; echo done"}
+	outputs, err := service.ExecHooks(ctx, []kv.Hook{quick}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !outputs[0].TimedOut {
+		t.Errorf("ExecHooks() with the default timeout = %+v, want a timeout", outputs[0])
+	}
+	quick.Timeout = time.Minute
+	outputs, err = service.ExecHooks(ctx, []kv.Hook{quick}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if outputs[0].TimedOut || outputs[0].Stdout != "done\n" {
+		t.Errorf("ExecHooks() with the timeout of the hook = %+v, want done", outputs[0])
+	}
+	// the override of the context applies to every call running hooks
+	outputs, err = service.ExecHooks(kv.OverrideHookTimeout(ctx, 50*time.Millisecond), []kv.Hook{quick}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !outputs[0].TimedOut {
+		t.Errorf("ExecHooks() with the timeout of the context = %+v, want a timeout", outputs[0])
+	}
+	reports = nil
+	if err := service.Set(ctx, "k3", "v1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.AttachHook(ctx, "k3", "quick"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Append(kv.OverrideHookTimeout(ctx, time.Minute), "k3", "2"); err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Outputs[0].TimedOut {
+		t.Errorf("kvService.Append() with the timeout of the context reports = %+v, want done", reports)
+	}
+	// the global timeout bounds each hook on its own, not the call
+	slowest := kv.Hook{Name: "slowest", Script: "sleep 0.1; echo done"}
+	outputs, err = setupService(t, kv.DefaultPerHookTimeout(300*time.Millisecond)).ExecHooks(ctx, []kv.Hook{slowest, slowest, slowest, slowest}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range outputs {
+		if output.TimedOut {
+			t.Errorf("ExecHooks() with a global timeout shorter than the call = %+v, want done", output)
+		}
+	}
+
+	var exported bytes.Buffer
+	if err := service.Export(ctx, &exported, kv.FormatJSON, kv.IncludeHooks()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(exported.String(), `"timeout": "200ms"`) {
+		t.Errorf("kvService.Export() = %s, want the timeout of the hook", exported.String())
+	}
+
+	if err := service.SetHookTimeout(ctx, "missing", time.Second); !errors.Is(err, kv.ErrHookNotFound) {
+		t.Errorf("kvService.SetHookTimeout() of a missing hook error = %v, want ErrHookNotFound", err)
+	}
+	if err := service.SetHookTimeout(ctx, "slow", -time.Second); !errors.Is(err, kv.ErrValidation) {
+		t.Errorf("kvService.SetHookTimeout() with a negative timeout error = %v, want ErrValidation", err)
+	}
+	if code := kv.ExitCode(output.Error); code != kv.ExitHookTimeout {
+		t.Errorf("ExitCode() of a timed out hook = %d, want %d", code, kv.ExitHookTimeout)
+	}
+}
@@ -0,0 +1,81 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// ListOptions filters and paginates the names returned by ListKeysPage and
+// ListHooksPage. Every filter that is set must match. Names are sorted in
+// ascending byte order.
+type ListOptions struct {
+	Prefix string
+	// Glob uses the SQLite GLOB syntax: *, ? and [...].
+	Glob  string
+	Regex string
+	// Tag only lists keys carrying the tag, it is ignored for hooks.
+	Tag string
+	// Cursor resumes listing after the given name, pass the NextCursor of
+	// the previous page.
+	Cursor string
+	// Limit is the maximum number of names in a page, 0 lists everything.
+	Limit int
+}
+
+type Page struct {
+	Names []string
+	// NextCursor is empty when there are no more pages.
+	NextCursor string
+}
+
+func (opts ListOptions) validate() error {
+	if opts.Limit < 0 {
+		return invalidf("limit may not be negative")
+	}
+	if _, err := regexp.Compile(opts.Regex); err != nil {
+		return invalidf("invalid regex: %w", err)
+	}
+	return nil
+}
+
+// listPage fetches one more name than requested to know whether another
+// page follows.
+func listPage(opts ListOptions, list func(ListOptions) ([]string, error)) (Page, error) {
+	if err := opts.validate(); err != nil {
+		return Page{}, err
+	}
+	query := opts
+	if opts.Limit > 0 {
+		query.Limit = opts.Limit + 1
+	}
+	names, err := list(query)
+	if err != nil {
+		return Page{}, err
+	}
+	if opts.Limit > 0 && len(names) > opts.Limit {
+		names = names[:opts.Limit]
+		return Page{Names: names, NextCursor: names[len(names)-1]}, nil
+	}
+	return Page{Names: names}, nil
+}
+
+func (s *kvService) ListKeysPage(ctx context.Context, opts ListOptions) (Page, error) {
+	page, err := listPage(opts, func(opts ListOptions) ([]string, error) {
+		return s.r.ListKeysPage(ctx, opts)
+	})
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to get the list of keys: %w", err)
+	}
+	return page, nil
+}
+
+func (s *kvService) ListHooksPage(ctx context.Context, opts ListOptions) (Page, error) {
+	page, err := listPage(opts, func(opts ListOptions) ([]string, error) {
+		return s.r.ListHooksPage(ctx, opts)
+	})
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to get the list of hooks: %w", err)
+	}
+	return page, nil
+}
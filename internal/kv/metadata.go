@@ -0,0 +1,123 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// KeyInfo describes a key: its value, version, declared type and the
+// metadata recorded for it. ExpiresAt is zero when the key does not expire
+// and the value of secret keys is masked.
+type KeyInfo struct {
+	Namespace   string
+	Key         string
+	Val         string
+	Type        ValueType
+	Version     int64
+	Description string
+	Owner       string
+	Secret      bool
+	Tags        []string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+func (s *kvService) Info(ctx context.Context, key string) (KeyInfo, error) {
+	if key == "" {
+		return KeyInfo{}, invalidf("key may not be empty")
+	}
+	info, err := s.r.GetKeyInfo(ctx, key)
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("failed to get the details of the %s key: %w", key, err)
+	}
+	if info.Secret {
+		info.Val = SecretMask
+	}
+	info.Type, err = s.r.GetKeyType(ctx, key)
+	if err != nil {
+		return KeyInfo{}, fmt.Errorf("could not get the type of the %s key: %w", key, err)
+	}
+	return info, nil
+}
+
+// requireKey returns an error if the key is empty or not stored.
+func (s *kvService) requireKey(ctx context.Context, key string) error {
+	if key == "" {
+		return invalidf("key may not be empty")
+	}
+	keyExists, err := s.r.KeyExists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not check if key exists: %w", err)
+	}
+	if !keyExists {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	return nil
+}
+
+func (s *kvService) SetDescription(ctx context.Context, key string, description string) error {
+	if err := s.requireKey(ctx, key); err != nil {
+		return err
+	}
+	err := s.r.SetDescription(ctx, key, description)
+	if err != nil {
+		return fmt.Errorf("failed to set the description of the %s key: %w", key, err)
+	}
+	return nil
+}
+
+func (s *kvService) SetOwner(ctx context.Context, key string, owner string) error {
+	if err := s.requireKey(ctx, key); err != nil {
+		return err
+	}
+	err := s.r.SetOwner(ctx, key, owner)
+	if err != nil {
+		return fmt.Errorf("failed to set the owner of the %s key: %w", key, err)
+	}
+	return nil
+}
+
+func validateTags(tags []string) error {
+	if len(tags) == 0 {
+		return invalidf("no tags were provided")
+	}
+	for _, tag := range tags {
+		if tag == "" || strings.TrimSpace(tag) != tag {
+			return invalidf("invalid tag '%s': tags may not be empty or start or end with spaces", tag)
+		}
+	}
+	return nil
+}
+
+func (s *kvService) AddTags(ctx context.Context, key string, tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+	if err := s.requireKey(ctx, key); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := s.r.AddTag(ctx, key, tag); err != nil {
+			return fmt.Errorf("failed to tag the %s key with %s: %w", key, tag, err)
+		}
+	}
+	return nil
+}
+
+func (s *kvService) RemoveTags(ctx context.Context, key string, tags ...string) error {
+	if err := validateTags(tags); err != nil {
+		return err
+	}
+	if err := s.requireKey(ctx, key); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		if err := s.r.RemoveTag(ctx, key, tag); err != nil {
+			return fmt.Errorf("failed to remove the %s tag from the %s key: %w", tag, key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+)
+
+const (
+	// DefaultNamespace is used when no namespace was selected.
+	DefaultNamespace = "default"
+	// NamespaceEnvVar selects the active namespace for the CLI.
+	NamespaceEnvVar = "KVZ_NAMESPACE"
+	// NamespaceSeparator separates the levels of a hierarchical namespace,
+	// e.g. "team/project".
+	NamespaceSeparator = "/"
+)
+
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+(/[A-Za-z0-9._-]+)*$`)
+
+// Entry is a key and its value along with the namespace it is stored in.
+type Entry struct {
+	Namespace string
+	Key       string
+	Val       string
+	Secret    bool
+}
+
+func ValidateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return invalidf("invalid namespace '%s': levels are separated by '%s' and may only contain letters, digits, '.', '_' and '-'", namespace, NamespaceSeparator)
+	}
+	return nil
+}
+
+// NamespaceFromEnv returns the namespace selected through KVZ_NAMESPACE, or
+// the default namespace when it is unset. An invalid namespace is an
+// ErrValidation.
+func NamespaceFromEnv() (string, error) {
+	namespace := os.Getenv(NamespaceEnvVar)
+	if namespace == "" {
+		return DefaultNamespace, nil
+	}
+	if err := ValidateNamespace(namespace); err != nil {
+		return "", fmt.Errorf("invalid %s: %w", NamespaceEnvVar, err)
+	}
+	return namespace, nil
+}
+
+func (s *kvService) Namespace() string {
+	return s.r.Namespace()
+}
+
+func (s *kvService) WithNamespace(namespace string) (KvService, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	scoped := s.withRepository(s.r.WithNamespace(namespace))
+	scoped.profile = Profile{}
+	return scoped, nil
+}
+
+func (s *kvService) ListNamespaces(ctx context.Context) ([]string, error) {
+	namespaces, err := s.r.ListNamespaces(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of namespaces: %w", err)
+	}
+	return namespaces, nil
+}
+
+// ExportNamespace returns every key stored in the namespace and in the
+// namespaces nested below it. The values of secret keys are masked.
+func (s *kvService) ExportNamespace(ctx context.Context, namespace string) ([]Entry, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+	entries, err := s.r.ExportNamespace(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export the %s namespace: %w", namespace, err)
+	}
+	for i := range entries {
+		if entries[i].Secret {
+			entries[i].Val = SecretMask
+		}
+	}
+	return entries, nil
+}
+
+// DeleteNamespace removes the keys, hooks, attachments, types and schema of
+// the namespace and of every namespace nested below it, and removes them
+// from the layers of the profiles. Once it is committed the delete hooks of
+// the keys run and their deletion is published.
+func (s *kvService) DeleteNamespace(ctx context.Context, namespace string) error {
+	if err := ValidateNamespace(namespace); err != nil {
+		return err
+	}
+	var namespaces []string
+	changes := make(map[string][]change)
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		entries, err := r.ExportNamespace(ctx, namespace)
+		if err != nil {
+			return err
+		}
+		before := make([]keyState, len(entries))
+		for i, entry := range entries {
+			before[i], err = s.namespaceKeyState(ctx, r.WithNamespace(entry.Namespace), entry)
+			if err != nil {
+				return err
+			}
+		}
+		if err := r.DeleteNamespace(ctx, namespace); err != nil {
+			return err
+		}
+		for i, entry := range entries {
+			c, err := s.changeOf(ctx, r.WithNamespace(entry.Namespace), entry.Key, before[i], nil)
+			if err != nil {
+				return err
+			}
+			if _, seen := changes[entry.Namespace]; !seen {
+				namespaces = append(namespaces, entry.Namespace)
+			}
+			changes[entry.Namespace] = append(changes[entry.Namespace], c)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete the %s namespace: %w", namespace, err)
+	}
+	var errs []error
+	for _, deleted := range namespaces {
+		scoped := s.withRepository(s.r.WithNamespace(deleted))
+		scoped.profile = Profile{}
+		if _, err := scoped.dispatch(ctx, changes[deleted]...); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// namespaceKeyState reads the state of a key of a deleted namespace. The
+// value of a secret that can not be decrypted is masked, it does not keep
+// the namespace from being deleted.
+func (s *kvService) namespaceKeyState(ctx context.Context, r KvRepository, entry Entry) (keyState, error) {
+	state, err := s.liveState(ctx, r, entry.Key)
+	if err != nil || !state.existed || hooksSkipped(ctx) {
+		return state, err
+	}
+	state.deleteHooks, err = r.GetHooksForEvent(ctx, entry.Key, EventDelete)
+	if err != nil {
+		return keyState{}, fmt.Errorf("failed to get the hooks attached to the %s key: %w", entry.Key, err)
+	}
+	return state, nil
+}
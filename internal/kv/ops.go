@@ -0,0 +1,204 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+// keepExpiry keeps the expiry of a key when its value is rewritten.
+func keepExpiry(expiresAt time.Time) SetOption {
+	return func(o *setOptions) {
+		o.expiresAt = expiresAt
+	}
+}
+
+// update rewrites the value of key with fn in a single transaction. The
+// transaction takes the write lock when it begins, so concurrent writers,
+// in this process or another one, wait for each other instead of losing
+// updates. exists is false when the key is not stored. The expiry of the
+// key is kept and the hooks run as for Set.
+func (s *kvService) update(ctx context.Context, key string, fn func(val string, exists bool) (string, error)) (string, error) {
+	if key == "" {
+		return "", invalidf("key may not be empty")
+	}
+	var newVal string
+	var c change
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := purgeExpiredKey(ctx, r, key); err != nil {
+			return err
+		}
+		tx := s.withRepository(r)
+		var val string
+		var opts []SetOption
+		info, err := r.GetKeyInfo(ctx, key)
+		exists := err == nil
+		if err != nil && !errors.Is(err, ErrKeyNotFound) {
+			return fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+		}
+		if exists {
+			val, err = s.decrypt(s.Namespace(), key, info.Val)
+			if err != nil {
+				return err
+			}
+			opts = append(opts, keepExpiry(info.ExpiresAt))
+		}
+		newVal, err = fn(val, exists)
+		if err != nil {
+			return err
+		}
+		options, err := tx.prepareSet(ctx, key, newVal, opts)
+		if err != nil {
+			return err
+		}
+		before := keyState{val: val, existed: exists, stored: info.Val}
+		options.reuseCiphertext(before, newVal)
+		if err := r.SetVal(ctx, key, options.stored, options.expiresAt, options.secret); err != nil {
+			return fmt.Errorf("failed to set a value to the %s key: %w", key, err)
+		}
+		c, err = s.changeOf(ctx, r, key, before, &newVal)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	if _, err := s.dispatch(ctx, c); err != nil {
+		return "", err
+	}
+	return newVal, nil
+}
+
+// Incr adds delta to an integer key and returns the new value. A key that
+// is not stored starts at 0.
+func (s *kvService) Incr(ctx context.Context, key string, delta int64) (int64, error) {
+	var result int64
+	_, err := s.update(ctx, key, func(val string, exists bool) (string, error) {
+		var current int64
+		if exists {
+			var err error
+			current, err = strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return "", invalidf("the value of the %s key is not an integer", key)
+			}
+		}
+		if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+			return "", invalidf("adding %d to the %s key overflows", delta, key)
+		}
+		result = current + delta
+		return strconv.FormatInt(result, 10), nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment the %s key: %w", key, err)
+	}
+	return result, nil
+}
+
+// Decr subtracts delta from an integer key and returns the new value.
+func (s *kvService) Decr(ctx context.Context, key string, delta int64) (int64, error) {
+	if delta == math.MinInt64 {
+		return 0, invalidf("%d can not be subtracted", delta)
+	}
+	return s.Incr(ctx, key, -delta)
+}
+
+// Append adds suffix to the end of the value of key and returns the new
+// value. A key that is not stored is created with suffix.
+func (s *kvService) Append(ctx context.Context, key string, suffix string) (string, error) {
+	if suffix == "" {
+		return "", invalidf("nothing to append to the %s key", key)
+	}
+	val, err := s.update(ctx, key, func(val string, exists bool) (string, error) {
+		return val + suffix, nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to append to the %s key: %w", key, err)
+	}
+	return val, nil
+}
+
+// updateList rewrites a key holding a JSON array of strings with fn. A key
+// that is not stored holds an empty list when create is set.
+func (s *kvService) updateList(ctx context.Context, key string, create bool, fn func(list []string) ([]string, error)) error {
+	_, err := s.update(ctx, key, func(val string, exists bool) (string, error) {
+		if !exists && !create {
+			return "", fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		list := []string{}
+		if exists {
+			parsed, err := TypeList.Parse(val)
+			if err != nil {
+				return "", invalidf("the value of the %s key is not a list", key)
+			}
+			list = parsed.([]string)
+		}
+		list, err := fn(list)
+		if err != nil {
+			return "", err
+		}
+		encoded, err := json.Marshal(list)
+		if err != nil {
+			return "", err
+		}
+		return string(encoded), nil
+	})
+	return err
+}
+
+// ListPush adds the values to the end of a list key and returns the new
+// list.
+func (s *kvService) ListPush(ctx context.Context, key string, vals ...string) ([]string, error) {
+	if len(vals) == 0 {
+		return nil, invalidf("no values were provided")
+	}
+	var result []string
+	err := s.updateList(ctx, key, true, func(list []string) ([]string, error) {
+		result = append(list, vals...)
+		return result, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push to the %s key: %w", key, err)
+	}
+	return result, nil
+}
+
+// ListPop removes the last value of a list key and returns it.
+func (s *kvService) ListPop(ctx context.Context, key string) (string, error) {
+	var popped string
+	err := s.updateList(ctx, key, false, func(list []string) ([]string, error) {
+		if len(list) == 0 {
+			return nil, invalidf("the %s list is empty", key)
+		}
+		popped = list[len(list)-1]
+		return list[:len(list)-1], nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to pop from the %s key: %w", key, err)
+	}
+	return popped, nil
+}
+
+// ListRemove removes every occurrence of val from a list key and returns how
+// many were removed.
+func (s *kvService) ListRemove(ctx context.Context, key string, val string) (int, error) {
+	var removed int
+	err := s.updateList(ctx, key, false, func(list []string) ([]string, error) {
+		removed = 0
+		kept := []string{}
+		for _, item := range list {
+			if item == val {
+				removed++
+				continue
+			}
+			kept = append(kept, item)
+		}
+		return kept, nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove from the %s key: %w", key, err)
+	}
+	return removed, nil
+}
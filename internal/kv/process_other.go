@@ -0,0 +1,22 @@
+//go:build !unix
+
+package kv
+
+import (
+	"os/exec"
+	"time"
+)
+
+// runInProcessGroup runs cmd, the processes it spawns are not stopped along
+// with it as process groups are not available. Once the context of cmd is
+// done it is killed and its pipes are closed after grace. terminated tells
+// if it was killed.
+func runInProcessGroup(cmd *exec.Cmd, grace time.Duration) (terminated bool, err error) {
+	cmd.Cancel = func() error {
+		terminated = true
+		return cmd.Process.Kill()
+	}
+	cmd.WaitDelay = grace
+	err = cmd.Run()
+	return terminated, err
+}
@@ -0,0 +1,43 @@
+//go:build unix
+
+package kv
+
+import (
+	"os/exec"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// runInProcessGroup runs cmd in a process group of its own, so the
+// processes it spawns can be stopped along with it. Once the context of cmd
+// is done the group gets SIGTERM, then SIGKILL if any of its processes is
+// still running after grace. terminated tells if the group was stopped.
+func runInProcessGroup(cmd *exec.Cmd, grace time.Duration) (terminated bool, err error) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	var stoppedAt atomic.Int64
+	cmd.Cancel = func() error {
+		stoppedAt.Store(time.Now().UnixNano())
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	}
+	// the leader is killed, and its pipes closed, once the grace is over
+	cmd.WaitDelay = grace
+	err = cmd.Run()
+	if at := stoppedAt.Load(); at != 0 {
+		killProcessGroup(cmd.Process.Pid, time.Unix(0, at).Add(grace))
+		return true, err
+	}
+	return false, err
+}
+
+// killProcessGroup waits until the group is gone or the deadline is
+// passed, then kills what is left of it.
+func killProcessGroup(pgid int, deadline time.Time) {
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(-pgid, 0); err != nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Kill(-pgid, syscall.SIGKILL)
+}
@@ -0,0 +1,304 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// Profile is a chain of namespaces used as layers, from the base layer to
+// the top one. A key is read from the top layer defining it, so every layer
+// overrides the ones below it.
+type Profile struct {
+	Name   string
+	Layers []string
+}
+
+// ProfileKey is a key of a profile, e.g. one a hook is attached to.
+type ProfileKey struct {
+	Profile string
+	Key     string
+}
+
+// Resolved is the effective value of a key and the layer it was read from.
+type Resolved struct {
+	Val   string
+	Layer string
+	// Default is set when the key is not stored and Val is the default
+	// declared by the schema, Layer is then empty.
+	Default bool
+}
+
+var profilePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func validateProfile(name string) error {
+	if !profilePattern.MatchString(name) {
+		return invalidf("invalid profile name '%s': it may only contain letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// getProfile returns the profile or ErrProfileNotFound.
+func getProfile(ctx context.Context, r KvRepository, name string) (Profile, error) {
+	if err := validateProfile(name); err != nil {
+		return Profile{}, err
+	}
+	layers, err := r.GetProfile(ctx, name)
+	if err != nil {
+		return Profile{}, fmt.Errorf("failed to get the %s profile: %w", name, err)
+	}
+	if len(layers) == 0 {
+		return Profile{}, fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return Profile{Name: name, Layers: layers}, nil
+}
+
+// SetProfile creates or replaces a profile, the layers are namespaces given
+// from the base layer to the top one.
+func (s *kvService) SetProfile(ctx context.Context, name string, layers ...string) error {
+	if err := validateProfile(name); err != nil {
+		return err
+	}
+	if len(layers) == 0 {
+		return invalidf("the %s profile needs at least one layer", name)
+	}
+	seen := make(map[string]bool, len(layers))
+	for _, layer := range layers {
+		if err := ValidateNamespace(layer); err != nil {
+			return err
+		}
+		if seen[layer] {
+			return invalidf("the %s namespace is used twice as a layer", layer)
+		}
+		seen[layer] = true
+	}
+	if err := s.r.SetProfile(ctx, name, layers); err != nil {
+		return fmt.Errorf("failed to set the %s profile: %w", name, err)
+	}
+	return nil
+}
+
+func (s *kvService) GetProfile(ctx context.Context, name string) (Profile, error) {
+	return getProfile(ctx, s.r, name)
+}
+
+func (s *kvService) ListProfiles(ctx context.Context) ([]Profile, error) {
+	profiles, err := s.r.ListProfiles(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of profiles: %w", err)
+	}
+	return profiles, nil
+}
+
+// DeleteProfile deletes the profile and the hooks attached to its keys, the
+// namespaces used as layers are kept.
+func (s *kvService) DeleteProfile(ctx context.Context, name string) error {
+	if err := validateProfile(name); err != nil {
+		return err
+	}
+	deleted, err := s.r.DeleteProfile(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete the %s profile: %w", name, err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: %s", ErrProfileNotFound, name)
+	}
+	return nil
+}
+
+// WithProfile returns a service bound to the top layer of the profile. Get,
+// GetTyped and Resolve read through its layers, every other call, writes
+// included, uses the top layer.
+func (s *kvService) WithProfile(ctx context.Context, name string) (KvService, error) {
+	profile, err := getProfile(ctx, s.r, name)
+	if err != nil {
+		return nil, err
+	}
+	scoped := s.withRepository(s.r.WithNamespace(profile.Layers[len(profile.Layers)-1]))
+	scoped.profile = profile
+	return scoped, nil
+}
+
+// Profile returns the profile the service reads through, the zero Profile
+// when it is bound to a single namespace.
+func (s *kvService) Profile() Profile {
+	return s.profile
+}
+
+// Resolve returns the value of key from the top layer of the profile that
+// defines it, or from the namespace of the service when it has no profile.
+// The default declared by the schema of the service is returned when no
+// layer defines the key.
+func (s *kvService) Resolve(ctx context.Context, key string) (Resolved, error) {
+	layers := s.profile.Layers
+	if len(layers) == 0 {
+		layers = []string{s.Namespace()}
+	}
+	for i := len(layers) - 1; i >= 0; i-- {
+		r := s.r
+		if layers[i] != s.Namespace() {
+			r = s.r.WithNamespace(layers[i])
+		}
+		val, err := r.GetVal(ctx, key)
+		if errors.Is(err, ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return Resolved{}, fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+		}
+		val, err = s.decrypt(layers[i], key, val)
+		if err != nil {
+			return Resolved{}, err
+		}
+		return Resolved{Val: val, Layer: layers[i]}, nil
+	}
+	declared, ok, err := s.schemaDefault(ctx, key)
+	if err != nil {
+		return Resolved{}, err
+	}
+	if ok {
+		return Resolved{Val: *declared.Default, Default: true}, nil
+	}
+	return Resolved{}, fmt.Errorf("failed to get the value from the %s key: %w", key, ErrKeyNotFound)
+}
+
+// AttachProfileHook attaches a hook of the namespace of the service to a
+// key of the profile. It runs whenever the effective value of the key in
+// the profile changes, whichever layer the change is made in, with the name
+// of the profile in KVZ_PROFILE.
+func (s *kvService) AttachProfileHook(ctx context.Context, profile string, key string, hook string, events ...Event) error {
+	if key == "" || hook == "" {
+		return invalidf("key or hook name may not be empty")
+	}
+	events, err := validateEvents(events)
+	if err != nil {
+		return err
+	}
+	err = s.r.Transact(ctx, func(r KvRepository) error {
+		if _, err := getProfile(ctx, r, profile); err != nil {
+			return err
+		}
+		hookExists, err := r.HookExists(ctx, hook)
+		if err != nil {
+			return fmt.Errorf("could not check if hook exists: %w", err)
+		}
+		if !hookExists {
+			return fmt.Errorf("%w: %s", ErrHookNotFound, hook)
+		}
+		if err := r.AttachProfileHook(ctx, profile, key, hook, events); err != nil {
+			return fmt.Errorf("failed to attach the %s hook to the %s key of the %s profile: %w", hook, key, profile, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	s.bus.publish(ctx, HookAttached{Namespace: s.Namespace(), Key: key, Hook: hook, Events: events, Profile: profile})
+	return nil
+}
+
+func (s *kvService) DetachProfileHook(ctx context.Context, profile string, key string, hook string) error {
+	if err := validateProfile(profile); err != nil {
+		return err
+	}
+	detached, err := s.r.DetachProfileHook(ctx, profile, key, hook)
+	if err != nil {
+		return fmt.Errorf("failed to detach the %s hook from the %s key of the %s profile: %w", hook, key, profile, err)
+	}
+	if !detached {
+		return fmt.Errorf("%w: %s is not attached to the %s key of the %s profile", ErrHookNotFound, hook, key, profile)
+	}
+	return nil
+}
+
+// effectiveChanges returns the changes of the effective value of key in the
+// profiles using the namespace of r as a layer, once a write made through r
+// changed it from before to newVal. Only the changes with hooks attached are
+// returned.
+func (s *kvService) effectiveChanges(ctx context.Context, r KvRepository, key string, before keyState, newVal *string) ([]change, error) {
+	namespace := r.Namespace()
+	profiles, err := r.ProfilesWithLayer(ctx, namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the profiles using the %s namespace: %w", namespace, err)
+	}
+	var changes []change
+	for _, profile := range profiles {
+		layer := 0
+		for i, l := range profile.Layers {
+			if l == namespace {
+				layer = i
+			}
+		}
+		overridden, err := s.overridden(ctx, r, key, profile.Layers[layer+1:])
+		if err != nil {
+			return nil, err
+		}
+		if overridden {
+			continue
+		}
+		lower, err := s.lowerState(ctx, r, key, profile.Layers[:layer])
+		if err != nil {
+			return nil, err
+		}
+		old, after := before, lower
+		if !old.existed {
+			old = lower
+		}
+		if newVal != nil {
+			after = keyState{val: *newVal, existed: true}
+		}
+		c := change{key: key, profile: profile.Name, oldVal: old.val, newVal: after.val}
+		switch {
+		case !old.existed && !after.existed:
+			continue
+		case !after.existed:
+			c.event = EventDelete
+			c.newVal = ""
+		case !old.existed:
+			c.event = EventCreate
+		case old.val == after.val:
+			continue
+		default:
+			c.event = EventUpdate
+		}
+		c.hooks, err = collectHooks(c.event, func(event Event) ([]Hook, error) {
+			return r.GetProfileHooksForEvent(ctx, profile.Name, key, event)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the hooks attached to the %s key of the %s profile: %w", key, profile.Name, err)
+		}
+		if len(c.hooks) > 0 {
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// overridden tells if any of the layers defines key.
+func (s *kvService) overridden(ctx context.Context, r KvRepository, key string, layers []string) (bool, error) {
+	for _, layer := range layers {
+		exists, err := r.WithNamespace(layer).KeyExists(ctx, key)
+		if err != nil {
+			return false, fmt.Errorf("could not check if key exists: %w", err)
+		}
+		if exists {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// lowerState returns the value of key in the top layer defining it.
+func (s *kvService) lowerState(ctx context.Context, r KvRepository, key string, layers []string) (keyState, error) {
+	for i := len(layers) - 1; i >= 0; i-- {
+		state, err := s.snapshot(ctx, r.WithNamespace(layers[i]), key, false)
+		if err != nil {
+			return keyState{}, err
+		}
+		if state.existed {
+			return state, nil
+		}
+	}
+	return keyState{}, nil
+}
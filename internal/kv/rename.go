@@ -0,0 +1,221 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+// KeyRename is a rename planned or applied by RenameMatching.
+type KeyRename struct {
+	Old string
+	New string
+}
+
+// errDryRun rolls back the transaction of a dry run.
+var errDryRun = errors.New("dry run")
+
+type renameOptions struct {
+	dryRun bool
+}
+
+type RenameOption func(*renameOptions)
+
+// DryRun only returns the renames that would be applied.
+func DryRun() RenameOption {
+	return func(o *renameOptions) {
+		o.dryRun = true
+	}
+}
+
+// checkMove checks that key can be moved or copied to newKey. An expired
+// newKey is purged so its name can be reused.
+func checkMove(ctx context.Context, r KvRepository, key string, newKey string) error {
+	if key == "" || newKey == "" {
+		return invalidf("key names may not be empty")
+	}
+	if key == newKey {
+		return invalidf("the %s key can not be moved onto itself", key)
+	}
+	keyExists, err := r.KeyExists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not check if key exists: %w", err)
+	}
+	if !keyExists {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	newKeyExists, err := r.KeyExists(ctx, newKey)
+	if err != nil {
+		return fmt.Errorf("could not check if key exists: %w", err)
+	}
+	if newKeyExists {
+		return fmt.Errorf("%w: %s", ErrKeyExists, newKey)
+	}
+	return purgeExpiredKey(ctx, r, newKey)
+}
+
+// movedVal returns the stored value of key to store in newKey once it was
+// checked against the type and schema of newKey. The value of a secret is
+// bound to its key, it is encrypted again for newKey.
+func (s *kvService) movedVal(ctx context.Context, r KvRepository, key string, newKey string) (string, error) {
+	val, err := r.GetVal(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+	}
+	plaintext := val
+	if isEncrypted(val) {
+		plaintext, err = s.decrypt(s.Namespace(), key, val)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err := s.checkTarget(ctx, r, key, newKey, plaintext); err != nil {
+		return "", err
+	}
+	if !isEncrypted(val) {
+		return val, nil
+	}
+	return s.encrypt(s.Namespace(), newKey, plaintext)
+}
+
+// checkTarget returns an error if Set would reject val for newKey, or if
+// key and newKey are declared with different types: the type of key moves
+// along with its value, a type declared for newKey is kept.
+func (s *kvService) checkTarget(ctx context.Context, r KvRepository, key string, newKey string, val string) error {
+	valueType, err := r.GetKeyType(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not get the type of the %s key: %w", key, err)
+	}
+	newType, err := r.GetKeyType(ctx, newKey)
+	if err != nil {
+		return fmt.Errorf("could not get the type of the %s key: %w", newKey, err)
+	}
+	if valueType != TypeString && newType != TypeString && valueType != newType {
+		return invalidf("the %s key is a %s, the %s key a %s", key, valueType, newKey, newType)
+	}
+	tx := s.withRepository(r)
+	if err := tx.checkType(ctx, newKey, val); err != nil {
+		return err
+	}
+	return tx.checkSchema(ctx, newKey, val)
+}
+
+// Rename moves the value, metadata and attached hooks of a key to a new
+// name in a single transaction. No hook is run, the deletion of key and the
+// creation of newKey are published to the subscribers.
+func (s *kvService) Rename(ctx context.Context, key string, newKey string) error {
+	var events []BusEvent
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := checkMove(ctx, r, key, newKey); err != nil {
+			return err
+		}
+		val, err := s.movedVal(ctx, r, key, newKey)
+		if err != nil {
+			return err
+		}
+		events, err = s.trackWrite(ctx, r, s.refs(key, newKey), func() error {
+			return r.RenameKey(ctx, key, newKey, val)
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rename the %s key to %s: %w", key, newKey, err)
+	}
+	s.bus.publish(ctx, events...)
+	return nil
+}
+
+// Copy copies the value, metadata and attached hooks of a key to a new key
+// in a single transaction. No hook is run, the creation of newKey is
+// published to the subscribers.
+func (s *kvService) Copy(ctx context.Context, key string, newKey string) error {
+	var events []BusEvent
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := checkMove(ctx, r, key, newKey); err != nil {
+			return err
+		}
+		val, err := s.movedVal(ctx, r, key, newKey)
+		if err != nil {
+			return err
+		}
+		events, err = s.trackWrite(ctx, r, s.refs(key, newKey), func() error {
+			return r.CopyKey(ctx, key, newKey, val)
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to copy the %s key to %s: %w", key, newKey, err)
+	}
+	s.bus.publish(ctx, events...)
+	return nil
+}
+
+// RenameMatching renames every key matched by pattern, the new name is the
+// key with the matches replaced by replacement as with
+// regexp.ReplaceAllString. Either every key is renamed or none is. Renaming
+// a key onto another existing key, including one renamed in the same call,
+// is refused. As with Rename, no hook is run.
+func (s *kvService) RenameMatching(ctx context.Context, pattern string, replacement string, opts ...RenameOption) ([]KeyRename, error) {
+	var options renameOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, invalidf("invalid regex: %w", err)
+	}
+	var renames []KeyRename
+	var events []BusEvent
+	err = s.r.Transact(ctx, func(r KvRepository) error {
+		keys, err := matchingKeys(ctx, r, ListOptions{Regex: pattern})
+		if err != nil {
+			return err
+		}
+		targets := make(map[string]string)
+		for _, key := range keys {
+			newKey := re.ReplaceAllString(key, replacement)
+			if newKey == key {
+				continue
+			}
+			if other, ok := targets[newKey]; ok {
+				return invalidf("the %s and %s keys would both be renamed to %s", other, key, newKey)
+			}
+			targets[newKey] = key
+			renames = append(renames, KeyRename{Old: key, New: newKey})
+		}
+		for _, rename := range renames {
+			if err := checkMove(ctx, r, rename.Old, rename.New); err != nil {
+				return err
+			}
+		}
+		if options.dryRun {
+			return errDryRun
+		}
+		var moved []string
+		for _, rename := range renames {
+			moved = append(moved, rename.Old, rename.New)
+		}
+		events, err = s.trackWrite(ctx, r, s.refs(moved...), func() error {
+			for _, rename := range renames {
+				val, err := s.movedVal(ctx, r, rename.Old, rename.New)
+				if err != nil {
+					return err
+				}
+				if err := r.RenameKey(ctx, rename.Old, rename.New, val); err != nil {
+					return fmt.Errorf("failed to rename the %s key to %s: %w", rename.Old, rename.New, err)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+	if errors.Is(err, errDryRun) {
+		return renames, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.bus.publish(ctx, events...)
+	return renames, nil
+}
@@ -0,0 +1,47 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Retention is how much of the change feed and of the history Prune keeps,
+// a zero field keeps everything on its account.
+type Retention struct {
+	// MaxAge prunes the changes and revisions recorded longer ago.
+	MaxAge time.Duration
+	// MaxChanges is the number of changes kept in the feed, the latest.
+	MaxChanges int
+	// MaxRevisions is the number of revisions kept in the history of every
+	// key, the latest.
+	MaxRevisions int
+}
+
+// PruneResult is the number of rows deleted by Prune.
+type PruneResult struct {
+	Changes   int64
+	Revisions int64
+}
+
+// Prune deletes the changes of the feed and the revisions of the history of
+// every namespace beyond the retention. The latest revision of every key is
+// always kept. A watcher resuming after a pruned revision misses the pruned
+// changes. The audit log is append-only, it is never pruned.
+func (s *kvService) Prune(ctx context.Context, retention Retention) (PruneResult, error) {
+	if retention.MaxAge < 0 || retention.MaxChanges < 0 || retention.MaxRevisions < 0 {
+		return PruneResult{}, invalidf("the retention may not be negative")
+	}
+	if retention == (Retention{}) {
+		return PruneResult{}, invalidf("the retention must set a maximum age or a maximum number of rows")
+	}
+	var before time.Time
+	if retention.MaxAge > 0 {
+		before = time.Now().Add(-retention.MaxAge)
+	}
+	result, err := s.r.Prune(ctx, before, retention.MaxChanges, retention.MaxRevisions)
+	if err != nil {
+		return PruneResult{}, fmt.Errorf("failed to prune the change feed and the history: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,294 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Schema declares the keys expected in a namespace.
+type Schema struct {
+	Keys []SchemaKey `json:"keys" yaml:"keys"`
+}
+
+// SchemaKey declares a key and the values Set accepts for it.
+type SchemaKey struct {
+	Key         string    `json:"key" yaml:"key"`
+	Type        ValueType `json:"type,omitempty" yaml:"type,omitempty"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	// Required keys are reported by Validate while they are not stored.
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	// Default is returned by Get while the key is not stored.
+	Default *string  `json:"default,omitempty" yaml:"default,omitempty"`
+	Enum    []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	// Pattern is a regular expression the whole value must match, it is
+	// anchored at both ends.
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	// Min and Max bound the values of int and float keys.
+	Min *float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	Max *float64 `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+// SchemaViolation is a required key that is missing, or a stored value the
+// schema of its namespace rejects.
+type SchemaViolation struct {
+	Namespace string
+	Key       string
+	Missing   bool
+	Reason    string
+}
+
+// ParseSchema reads a schema from a YAML document, e.g. a schema file kept
+// with the code using the keys.
+func ParseSchema(r io.Reader) (Schema, error) {
+	var schema Schema
+	decoder := yaml.NewDecoder(r)
+	decoder.SetStrict(true)
+	if err := decoder.Decode(&schema); err != nil && err != io.EOF {
+		return Schema{}, invalidf("invalid schema: %w", err)
+	}
+	if err := schema.validate(); err != nil {
+		return Schema{}, err
+	}
+	return schema, nil
+}
+
+func (schema Schema) validate() error {
+	seen := make(map[string]bool, len(schema.Keys))
+	for _, key := range schema.Keys {
+		if key.Key == "" {
+			return invalidf("the keys of a schema may not be empty")
+		}
+		if seen[key.Key] {
+			return invalidf("the %s key is declared twice in the schema", key.Key)
+		}
+		seen[key.Key] = true
+		if key.Type != "" {
+			if _, err := ParseValueType(string(key.Type)); err != nil {
+				return err
+			}
+		}
+		if _, err := regexp.Compile(key.Pattern); err != nil {
+			return invalidf("invalid pattern for the %s key: %w", key.Key, err)
+		}
+		if (key.Min != nil || key.Max != nil) && key.Type != TypeInt && key.Type != TypeFloat {
+			return invalidf("only int and float keys can have a range, the %s key is a %s", key.Key, key.valueType())
+		}
+		if key.Min != nil && key.Max != nil && *key.Min > *key.Max {
+			return invalidf("the range of the %s key is empty", key.Key)
+		}
+		if key.Required && key.Default != nil {
+			return invalidf("the %s key is required, it can not have a default", key.Key)
+		}
+		if key.Default != nil {
+			if err := key.Check(*key.Default); err != nil {
+				return invalidf("the default of the %s key is invalid: %w", key.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+func (schema Schema) lookup(key string) (SchemaKey, bool) {
+	for _, k := range schema.Keys {
+		if k.Key == key {
+			return k, true
+		}
+	}
+	return SchemaKey{}, false
+}
+
+func (k SchemaKey) valueType() ValueType {
+	if k.Type == "" {
+		return TypeString
+	}
+	return k.Type
+}
+
+// Check returns an error if the schema rejects val. The error does not
+// quote the value, it may be a secret.
+func (k SchemaKey) Check(val string) error {
+	valueType := k.valueType()
+	typed, err := valueType.Parse(val)
+	if err != nil {
+		return invalidf("not a valid %s", valueType)
+	}
+	if len(k.Enum) > 0 {
+		found := false
+		for _, allowed := range k.Enum {
+			found = found || allowed == val
+		}
+		if !found {
+			return invalidf("must be one of %v", k.Enum)
+		}
+	}
+	if k.Pattern != "" {
+		pattern, err := regexp.Compile(`^(?:` + k.Pattern + `)$`)
+		if err != nil {
+			return invalidf("invalid pattern: %w", err)
+		}
+		if !pattern.MatchString(val) {
+			return invalidf("must match %s", k.Pattern)
+		}
+	}
+	var number float64
+	switch typed := typed.(type) {
+	case int64:
+		number = float64(typed)
+	case float64:
+		number = typed
+	default:
+		return nil
+	}
+	if k.Min != nil && number < *k.Min {
+		return invalidf("must be at least %v", *k.Min)
+	}
+	if k.Max != nil && number > *k.Max {
+		return invalidf("must be at most %v", *k.Max)
+	}
+	return nil
+}
+
+// WithSchema makes the service use schema in whichever namespace it is
+// bound to, instead of the schemas stored in the database.
+func WithSchema(schema Schema) ServiceOption {
+	return func(s *kvService) {
+		s.schema = &schema
+	}
+}
+
+// GetSchema returns the schema of the namespace, the empty Schema when
+// there is none.
+func (s *kvService) GetSchema(ctx context.Context) (Schema, error) {
+	if s.schema != nil {
+		return *s.schema, nil
+	}
+	document, err := s.r.GetSchema(ctx)
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to get the schema of the %s namespace: %w", s.Namespace(), err)
+	}
+	return decodeSchema(s.Namespace(), document)
+}
+
+func decodeSchema(namespace string, document string) (Schema, error) {
+	var schema Schema
+	if document == "" {
+		return schema, nil
+	}
+	if err := json.Unmarshal([]byte(document), &schema); err != nil {
+		return Schema{}, fmt.Errorf("the stored schema of the %s namespace is invalid: %w", namespace, err)
+	}
+	return schema, nil
+}
+
+// SetSchema stores the schema of the namespace. The stored values are not
+// checked, use Validate to find the ones it rejects.
+func (s *kvService) SetSchema(ctx context.Context, schema Schema) error {
+	if err := schema.validate(); err != nil {
+		return err
+	}
+	document, err := json.Marshal(schema)
+	if err != nil {
+		return err
+	}
+	if err := s.r.SetSchema(ctx, string(document)); err != nil {
+		return fmt.Errorf("failed to set the schema of the %s namespace: %w", s.Namespace(), err)
+	}
+	return nil
+}
+
+// DeleteSchema removes the schema of the namespace, if it has one.
+func (s *kvService) DeleteSchema(ctx context.Context) error {
+	if _, err := s.r.DeleteSchema(ctx); err != nil {
+		return fmt.Errorf("failed to delete the schema of the %s namespace: %w", s.Namespace(), err)
+	}
+	return nil
+}
+
+// checkSchema returns an error if the schema of the namespace rejects a
+// write of val to key.
+func (s *kvService) checkSchema(ctx context.Context, key string, val string) error {
+	schema, err := s.GetSchema(ctx)
+	if err != nil {
+		return err
+	}
+	declared, ok := schema.lookup(key)
+	if !ok {
+		return nil
+	}
+	if err := declared.Check(val); err != nil {
+		return invalidf("the value of the %s key does not match the schema: %w", key, err)
+	}
+	return nil
+}
+
+// schemaDefault returns the schema declaration of key when it has a
+// default.
+func (s *kvService) schemaDefault(ctx context.Context, key string) (SchemaKey, bool, error) {
+	schema, err := s.GetSchema(ctx)
+	if err != nil {
+		return SchemaKey{}, false, err
+	}
+	declared, ok := schema.lookup(key)
+	return declared, ok && declared.Default != nil, nil
+}
+
+// Validate checks the stored values against the schema of their namespace
+// and reports the required keys that are missing. Every namespace with a
+// stored schema is checked, or only the namespace of the service when it
+// was given one with WithSchema. The violations are sorted by namespace and
+// key.
+func (s *kvService) Validate(ctx context.Context) ([]SchemaViolation, error) {
+	schemas := make(map[string]Schema)
+	if s.schema != nil {
+		schemas[s.Namespace()] = *s.schema
+	} else {
+		documents, err := s.r.ListSchemas(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the list of schemas: %w", err)
+		}
+		for namespace, document := range documents {
+			schema, err := decodeSchema(namespace, document)
+			if err != nil {
+				return nil, err
+			}
+			schemas[namespace] = schema
+		}
+	}
+	var violations []SchemaViolation
+	for namespace, schema := range schemas {
+		r := s.r.WithNamespace(namespace)
+		for _, declared := range schema.Keys {
+			val, err := r.GetVal(ctx, declared.Key)
+			if errors.Is(err, ErrKeyNotFound) {
+				if declared.Required {
+					violations = append(violations, SchemaViolation{Namespace: namespace, Key: declared.Key, Missing: true, Reason: "the key is required"})
+				}
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to get the value from the %s key: %w", declared.Key, err)
+			}
+			val, err = s.decrypt(namespace, declared.Key, val)
+			if err != nil {
+				return nil, err
+			}
+			if err := declared.Check(val); err != nil {
+				violations = append(violations, SchemaViolation{Namespace: namespace, Key: declared.Key, Reason: err.Error()})
+			}
+		}
+	}
+	sort.Slice(violations, func(i, j int) bool {
+		if violations[i].Namespace != violations[j].Namespace {
+			return violations[i].Namespace < violations[j].Namespace
+		}
+		return violations[i].Key < violations[j].Key
+	})
+	return violations, nil
+}
@@ -0,0 +1,47 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// SearchResult is a key matched by Search. Snippet is the part of the key,
+// value or metadata that matched best, with the matched terms in brackets.
+// Results are sorted by Rank, the best match has the lowest.
+type SearchResult struct {
+	Key     string
+	Snippet string
+	Rank    float64
+}
+
+// searchQuery turns the terms of query into an FTS5 query matching the keys
+// containing every term, the last token of each term may be a prefix.
+func searchQuery(query string) (string, error) {
+	terms := strings.Fields(query)
+	if len(terms) == 0 {
+		return "", invalidf("the search query may not be empty")
+	}
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"*`
+	}
+	return strings.Join(terms, " "), nil
+}
+
+// Search returns the live keys whose name, value, description, owner or tags
+// contain every term of query, at most limit of them or all when limit is 0.
+// The values of secrets are not searched.
+func (s *kvService) Search(ctx context.Context, query string, limit int) ([]SearchResult, error) {
+	if limit < 0 {
+		return nil, invalidf("limit may not be negative")
+	}
+	match, err := searchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.r.Search(ctx, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for '%s': %w", query, err)
+	}
+	return results, nil
+}
@@ -0,0 +1,277 @@
+package kv
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// SecretMask replaces the value of secret keys in listings and exports.
+const SecretMask = "********"
+
+// encryptedPrefix marks values encrypted by kvz, the version allows the
+// format to change later.
+const encryptedPrefix = "kvzenc:v2:"
+
+// Cipher encrypts the values of secret keys before they are stored. The
+// additional data is authenticated along with the value, the service binds
+// every value to its namespace and key with it so a ciphertext copied to
+// another key does not decrypt.
+type Cipher interface {
+	Encrypt(plaintext string, additionalData []byte) (string, error)
+	Decrypt(ciphertext string, additionalData []byte) (string, error)
+}
+
+const (
+	keySize  = 32
+	saltSize = 16
+	// maxDerivedKeys bounds the keys derived for the salts of values
+	// encrypted by other ciphers, e.g. by earlier runs.
+	maxDerivedKeys = 64
+)
+
+// aesGCM encrypts with AES-256-GCM. With a passphrase the key is derived
+// with scrypt from a random salt drawn once per cipher, the salt is stored
+// in front of the nonce so values encrypted with other salts can be
+// decrypted.
+type aesGCM struct {
+	salt []byte
+	// sealer encrypts with the key of salt, or with the key file.
+	sealer     cipher.AEAD
+	passphrase []byte
+	mu         sync.Mutex
+	derived    map[string]*list.Element
+	// recent orders the derived keys from the most to the least recently
+	// used.
+	recent *list.List
+}
+
+type derivedKey struct {
+	salt string
+	aead cipher.AEAD
+}
+
+// NewKeyFileCipher reads a 32 byte key from a file. The file holds either
+// the raw bytes or their hex or base64 encoding.
+func NewKeyFileCipher(path string) (Cipher, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the key file: %w", err)
+	}
+	key := content
+	if len(key) != keySize {
+		trimmed := strings.TrimSpace(string(content))
+		if decoded, err := hex.DecodeString(trimmed); err == nil {
+			key = decoded
+		} else if decoded, err := base64.StdEncoding.DecodeString(trimmed); err == nil {
+			key = decoded
+		}
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("the key file must contain a %d byte key", keySize)
+	}
+	sealer, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	return &aesGCM{sealer: sealer}, nil
+}
+
+// NewPassphraseCipher derives the key from passphrase. scrypt is
+// deliberately slow, the key is derived once here.
+func NewPassphraseCipher(passphrase string) (Cipher, error) {
+	if passphrase == "" {
+		return nil, invalidf("the passphrase may not be empty")
+	}
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	c := &aesGCM{
+		salt:       salt,
+		passphrase: []byte(passphrase),
+		derived:    make(map[string]*list.Element),
+		recent:     list.New(),
+	}
+	sealer, err := c.derive(salt)
+	if err != nil {
+		return nil, err
+	}
+	c.sealer = sealer
+	return c, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (c *aesGCM) derive(salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key(c.passphrase, salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive the key from the passphrase: %w", err)
+	}
+	return newAEAD(key)
+}
+
+// aead returns the cipher for the salt of a stored value. The keys derived
+// for other salts than the one of c are cached, the least recently used is
+// evicted past maxDerivedKeys. They are derived without holding the lock so
+// a derivation does not hold up the other calls.
+func (c *aesGCM) aead(salt []byte) (cipher.AEAD, error) {
+	if c.passphrase == nil || bytes.Equal(salt, c.salt) {
+		return c.sealer, nil
+	}
+	c.mu.Lock()
+	if elem, ok := c.derived[string(salt)]; ok {
+		c.recent.MoveToFront(elem)
+		c.mu.Unlock()
+		return elem.Value.(*derivedKey).aead, nil
+	}
+	c.mu.Unlock()
+	aead, err := c.derive(salt)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.derived[string(salt)]; !ok {
+		c.derived[string(salt)] = c.recent.PushFront(&derivedKey{salt: string(salt), aead: aead})
+		if c.recent.Len() > maxDerivedKeys {
+			oldest := c.recent.Remove(c.recent.Back()).(*derivedKey)
+			delete(c.derived, oldest.salt)
+		}
+	}
+	return aead, nil
+}
+
+func (c *aesGCM) Encrypt(plaintext string, additionalData []byte) (string, error) {
+	nonce := make([]byte, c.sealer.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	prefix := append(bytes.Clone(c.salt), nonce...)
+	sealed := c.sealer.Seal(prefix, nonce, []byte(plaintext), additionalData)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (c *aesGCM) Decrypt(ciphertext string, additionalData []byte) (string, error) {
+	encoded, ok := strings.CutPrefix(ciphertext, encryptedPrefix)
+	if !ok {
+		return "", fmt.Errorf("the value is not encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %w", err)
+	}
+	var salt []byte
+	if c.passphrase != nil {
+		if len(sealed) < saltSize {
+			return "", fmt.Errorf("malformed encrypted value")
+		}
+		salt, sealed = sealed[:saltSize], sealed[saltSize:]
+	}
+	aead, err := c.aead(salt)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value")
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return "", fmt.Errorf("unable to decrypt the value, the key may be wrong: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// secretData is the additional data binding the value of a secret to its
+// namespace and key.
+func secretData(namespace string, key string) []byte {
+	return []byte(namespace + "\x00" + key)
+}
+
+func isEncrypted(val string) bool {
+	return strings.HasPrefix(val, encryptedPrefix)
+}
+
+// AsSecret stores the value encrypted. Once a key is secret every later
+// write to it is encrypted as well. The earlier values of a key made secret
+// are encrypted in its history, its changes and the snapshots. The audit
+// log is append-only, the entries written before keep the plain values.
+func AsSecret() SetOption {
+	return func(o *setOptions) {
+		o.secret = true
+		o.seal = true
+	}
+}
+
+// sealPlainVals encrypts the values key kept in plain text from before it
+// was made secret.
+func (s *kvService) sealPlainVals(ctx context.Context, r KvRepository, key string) error {
+	vals, err := r.ListPlainVals(ctx, key)
+	if err != nil {
+		return fmt.Errorf("failed to get the earlier values of the %s key: %w", key, err)
+	}
+	for _, val := range vals {
+		encrypted, err := s.encrypt(r.Namespace(), key, val)
+		if err != nil {
+			return err
+		}
+		if err := r.SealVal(ctx, key, val, encrypted); err != nil {
+			return fmt.Errorf("failed to encrypt the earlier values of the %s key: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// encrypt encrypts the value of a secret key of the namespace.
+func (s *kvService) encrypt(namespace string, key string, val string) (string, error) {
+	if s.cipher == nil {
+		return "", fmt.Errorf("the %s key is secret but no encryption key was configured", key)
+	}
+	encrypted, err := s.cipher.Encrypt(val, secretData(namespace, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt the value of the %s key: %w", key, err)
+	}
+	return encrypted, nil
+}
+
+// decrypt returns the plaintext of a value stored in a key of the
+// namespace, values that were not encrypted are returned as is.
+func (s *kvService) decrypt(namespace string, key string, val string) (string, error) {
+	if !isEncrypted(val) {
+		return val, nil
+	}
+	if s.cipher == nil {
+		return "", fmt.Errorf("the %s key is secret but no encryption key was configured", key)
+	}
+	plaintext, err := s.cipher.Decrypt(val, secretData(namespace, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt the value of the %s key: %w", key, err)
+	}
+	return plaintext, nil
+}
+
+func (s *kvService) isSecret(ctx context.Context, key string) (bool, error) {
+	secret, err := s.r.IsSecret(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("could not check if the %s key is secret: %w", key, err)
+	}
+	return secret, nil
+}
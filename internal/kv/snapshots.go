@@ -0,0 +1,226 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Snapshot is a named copy of the keys, hooks and attachments of every
+// namespace.
+type Snapshot struct {
+	Name      string
+	CreatedAt time.Time
+	// Keys is the number of keys in the snapshot.
+	Keys int64
+}
+
+// DiffKind is how a key or hook differs between a snapshot and the store.
+type DiffKind string
+
+const (
+	// DiffAdded is only in the store.
+	DiffAdded DiffKind = "added"
+	// DiffRemoved is only in the snapshot.
+	DiffRemoved DiffKind = "removed"
+	// DiffChanged is in both with a different value, metadata or
+	// attachments.
+	DiffChanged DiffKind = "changed"
+)
+
+// SnapshotDiff is a key, or a hook when Hook is set, that differs between a
+// snapshot and the store.
+type SnapshotDiff struct {
+	Namespace string
+	Name      string
+	Hook      bool
+	Kind      DiffKind
+}
+
+// SecretDiff is a secret key stored with a different ciphertext in a
+// snapshot and in the store.
+type SecretDiff struct {
+	Namespace   string
+	Key         string
+	SnapshotVal string
+	Val         string
+}
+
+var snapshotPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+func validateSnapshot(name string) error {
+	if !snapshotPattern.MatchString(name) {
+		return invalidf("invalid snapshot name '%s': it may only contain letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// requireSnapshot returns an error if the snapshot name is invalid or it was
+// not taken.
+func requireSnapshot(ctx context.Context, r KvRepository, name string) error {
+	if err := validateSnapshot(name); err != nil {
+		return err
+	}
+	exists, err := r.SnapshotExists(ctx, name)
+	if err != nil {
+		return fmt.Errorf("could not check if snapshot exists: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return nil
+}
+
+// CreateSnapshot copies the keys, hooks and attachments of every namespace.
+// The values of secrets stay encrypted in the snapshot.
+func (s *kvService) CreateSnapshot(ctx context.Context, name string) error {
+	if err := validateSnapshot(name); err != nil {
+		return err
+	}
+	if err := s.r.CreateSnapshot(ctx, name); err != nil {
+		return fmt.Errorf("failed to create the %s snapshot: %w", name, err)
+	}
+	return nil
+}
+
+func (s *kvService) ListSnapshots(ctx context.Context) ([]Snapshot, error) {
+	snapshots, err := s.r.ListSnapshots(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the list of snapshots: %w", err)
+	}
+	return snapshots, nil
+}
+
+// DiffSnapshot returns the live keys and the hooks of every namespace that
+// differ between the snapshot and the store, sorted by namespace and name.
+func (s *kvService) DiffSnapshot(ctx context.Context, name string) ([]SnapshotDiff, error) {
+	if err := requireSnapshot(ctx, s.r, name); err != nil {
+		return nil, err
+	}
+	return s.diffSnapshot(ctx, s.r, name)
+}
+
+// diffSnapshot compares the snapshot with the store through r. The values of
+// the secrets are compared once decrypted, a secret that can not be
+// decrypted is reported as changed.
+func (s *kvService) diffSnapshot(ctx context.Context, r KvRepository, name string) ([]SnapshotDiff, error) {
+	diffs, err := r.DiffSnapshot(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare the %s snapshot with the store: %w", name, err)
+	}
+	secrets, err := r.DiffSnapshotSecrets(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare the secrets of the %s snapshot with the store: %w", name, err)
+	}
+	listed := make(map[keyRef]bool)
+	for _, diff := range diffs {
+		if !diff.Hook {
+			listed[keyRef{namespace: diff.Namespace, key: diff.Name}] = true
+		}
+	}
+	changed := false
+	for _, secret := range secrets {
+		if listed[keyRef{namespace: secret.Namespace, key: secret.Key}] {
+			continue
+		}
+		snapshotVal, err := s.decrypt(secret.Namespace, secret.Key, secret.SnapshotVal)
+		if err == nil {
+			var val string
+			val, err = s.decrypt(secret.Namespace, secret.Key, secret.Val)
+			if err == nil && val == snapshotVal {
+				continue
+			}
+		}
+		diffs = append(diffs, SnapshotDiff{Namespace: secret.Namespace, Name: secret.Key, Kind: DiffChanged})
+		changed = true
+	}
+	if changed {
+		sort.SliceStable(diffs, func(i, j int) bool {
+			if diffs[i].Hook != diffs[j].Hook {
+				return !diffs[i].Hook
+			}
+			if diffs[i].Namespace != diffs[j].Namespace {
+				return diffs[i].Namespace < diffs[j].Namespace
+			}
+			return diffs[i].Name < diffs[j].Name
+		})
+	}
+	return diffs, nil
+}
+
+// RestoreSnapshot brings the whole store back to the snapshot, or only the
+// given keys of the namespace when there are any. A key that is not in the
+// snapshot is deleted, the hooks attached to a restored key are restored if
+// they were deleted. The hooks are not run, the restored keys are published
+// to the subscribers.
+func (s *kvService) RestoreSnapshot(ctx context.Context, name string, keys ...string) error {
+	var events []BusEvent
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := requireSnapshot(ctx, r, name); err != nil {
+			return err
+		}
+		if len(keys) == 0 {
+			diffs, err := s.diffSnapshot(ctx, r, name)
+			if err != nil {
+				return err
+			}
+			var restored []keyRef
+			for _, diff := range diffs {
+				if !diff.Hook {
+					restored = append(restored, keyRef{namespace: diff.Namespace, key: diff.Name})
+				}
+			}
+			events, err = s.trackWrite(ctx, r, restored, func() error {
+				return r.RestoreSnapshot(ctx, name)
+			})
+			return err
+		}
+		for _, key := range keys {
+			if key == "" {
+				return invalidf("key may not be empty")
+			}
+			inSnapshot, err := r.SnapshotKeyExists(ctx, name, key)
+			if err != nil {
+				return fmt.Errorf("could not check if the snapshot has the %s key: %w", key, err)
+			}
+			keyExists, err := r.KeyExists(ctx, key)
+			if err != nil {
+				return fmt.Errorf("could not check if key exists: %w", err)
+			}
+			if !inSnapshot && !keyExists {
+				return fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+			}
+		}
+		var err error
+		events, err = s.trackWrite(ctx, r, s.refs(keys...), func() error {
+			for _, key := range keys {
+				if err := r.RestoreSnapshotKey(ctx, name, key); err != nil {
+					return fmt.Errorf("failed to restore the %s key: %w", key, err)
+				}
+			}
+			return nil
+		})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to restore the %s snapshot: %w", name, err)
+	}
+	s.bus.publish(ctx, events...)
+	return nil
+}
+
+func (s *kvService) DeleteSnapshot(ctx context.Context, name string) error {
+	if err := validateSnapshot(name); err != nil {
+		return err
+	}
+	deleted, err := s.r.DeleteSnapshot(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete the %s snapshot: %w", name, err)
+	}
+	if !deleted {
+		return fmt.Errorf("%w: %s", ErrSnapshotNotFound, name)
+	}
+	return nil
+}
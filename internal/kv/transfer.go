@@ -0,0 +1,397 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+type exportOptions struct {
+	hooks   bool
+	secrets bool
+}
+
+type ExportOption func(*exportOptions)
+
+// IncludeHooks exports the hooks of the namespace and the hooks attached to
+// every key.
+func IncludeHooks() ExportOption {
+	return func(o *exportOptions) {
+		o.hooks = true
+	}
+}
+
+// IncludeSecrets exports secret keys with their decrypted value, they are
+// left out otherwise.
+func IncludeSecrets() ExportOption {
+	return func(o *exportOptions) {
+		o.secrets = true
+	}
+}
+
+// Export writes the live keys of the namespace with their metadata to w.
+// Dotenv files only hold keys and values, they can not include hooks or
+// secrets.
+func (s *kvService) Export(ctx context.Context, w io.Writer, format Format, opts ...ExportOption) error {
+	var options exportOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if format == FormatDotenv && (options.hooks || options.secrets) {
+		return invalidf("dotenv files can not hold hooks or secrets")
+	}
+	var dump Dump
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		var err error
+		dump, err = s.dump(ctx, r, options)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to export the %s namespace: %w", s.Namespace(), err)
+	}
+	return encodeDump(w, format, dump)
+}
+
+func (s *kvService) dump(ctx context.Context, r KvRepository, options exportOptions) (Dump, error) {
+	dump := Dump{Keys: []DumpKey{}}
+	keys, err := r.ListKeys(ctx)
+	if err != nil {
+		return Dump{}, err
+	}
+	attachments := make(map[string][]DumpAttachment)
+	if options.hooks {
+		hooks, err := r.ExportHooks(ctx)
+		if err != nil {
+			return Dump{}, err
+		}
+		for _, hook := range hooks {
+			dumped := DumpHook{Name: hook.Name, IsFile: hook.IsFile}
+			if hook.IsLocalFile {
+				dumped.Filepath = hook.Filepath
+			} else {
+				dumped.Script = hook.Script
+			}
+			if hook.Timeout > 0 {
+				dumped.Timeout = hook.Timeout.String()
+			}
+			dump.Hooks = append(dump.Hooks, dumped)
+		}
+		attached, err := r.ExportAttachments(ctx)
+		if err != nil {
+			return Dump{}, err
+		}
+		for _, a := range attached {
+			attachments[a.Key] = append(attachments[a.Key], DumpAttachment{Hook: a.Hook, Events: a.Events})
+		}
+	}
+	for _, key := range keys {
+		info, err := r.GetKeyInfo(ctx, key)
+		if err != nil {
+			return Dump{}, err
+		}
+		if info.Secret && !options.secrets {
+			continue
+		}
+		val, err := s.decrypt(s.Namespace(), key, info.Val)
+		if err != nil {
+			return Dump{}, err
+		}
+		valueType, err := r.GetKeyType(ctx, key)
+		if err != nil {
+			return Dump{}, err
+		}
+		if valueType == TypeString {
+			valueType = ""
+		}
+		dumped := DumpKey{
+			Key:         key,
+			Val:         val,
+			Secret:      info.Secret,
+			Type:        valueType,
+			Description: info.Description,
+			Owner:       info.Owner,
+			Tags:        info.Tags,
+			Hooks:       attachments[key],
+		}
+		if !info.ExpiresAt.IsZero() {
+			expiresAt := info.ExpiresAt.UTC()
+			dumped.ExpiresAt = &expiresAt
+		}
+		dump.Keys = append(dump.Keys, dumped)
+	}
+	return dump, nil
+}
+
+// ImportMode decides what Import does with the keys that are already
+// stored.
+type ImportMode string
+
+const (
+	// ImportMerge overwrites the stored keys that are in the import and
+	// keeps the others.
+	ImportMerge ImportMode = "merge"
+	// ImportReplace also deletes the stored keys that are not in the import.
+	// Hooks are merged, they are never deleted.
+	ImportReplace ImportMode = "replace"
+	// ImportSkipExisting leaves the stored keys and hooks untouched.
+	ImportSkipExisting ImportMode = "skip"
+)
+
+type importOptions struct {
+	mode   ImportMode
+	dryRun bool
+}
+
+type ImportOption func(*importOptions)
+
+// WithImportMode sets what happens to the stored keys, ImportMerge is used
+// by default.
+func WithImportMode(mode ImportMode) ImportOption {
+	return func(o *importOptions) {
+		o.mode = mode
+	}
+}
+
+// ImportDryRun only returns what the import would change.
+func ImportDryRun() ImportOption {
+	return func(o *importOptions) {
+		o.dryRun = true
+	}
+}
+
+// ImportResult lists the keys changed by an import, or that would be with
+// ImportDryRun.
+type ImportResult struct {
+	Created []string
+	Updated []string
+	Skipped []string
+	Deleted []string
+	// Hooks are the hooks created or updated.
+	Hooks []string
+}
+
+// Import reads keys, and the hooks when they were exported, from r and
+// stores them in a single transaction. Once it is committed the hooks of
+// the changed keys run as with Apply, pass a context from SkipHooks to
+// import without running them.
+func (s *kvService) Import(ctx context.Context, r io.Reader, format Format, opts ...ImportOption) (ImportResult, error) {
+	options := importOptions{mode: ImportMerge}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	switch options.mode {
+	case ImportMerge, ImportReplace, ImportSkipExisting:
+	default:
+		return ImportResult{}, invalidf("unknown import mode '%s'", options.mode)
+	}
+	dump, err := decodeDump(r, format)
+	if err != nil {
+		return ImportResult{}, err
+	}
+	if err := validateDump(dump); err != nil {
+		return ImportResult{}, err
+	}
+	var result ImportResult
+	var changes []change
+	err = s.r.Transact(ctx, func(r KvRepository) error {
+		var err error
+		result, changes, err = s.load(ctx, r, dump, options.mode)
+		if err != nil {
+			return err
+		}
+		if options.dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		return result, nil
+	}
+	if err != nil {
+		return ImportResult{}, fmt.Errorf("the import was rolled back: %w", err)
+	}
+	if _, err := s.dispatch(ctx, changes...); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// validateDump rejects the dumps naming a key or hook twice.
+func validateDump(dump Dump) error {
+	keys := make(map[string]bool)
+	for _, key := range dump.Keys {
+		if key.Key == "" {
+			return invalidf("key names may not be empty")
+		}
+		if keys[key.Key] {
+			return invalidf("the %s key is imported twice", key.Key)
+		}
+		keys[key.Key] = true
+	}
+	hooks := make(map[string]bool)
+	for _, hook := range dump.Hooks {
+		if hook.Name == "" {
+			return invalidf("hook names may not be empty")
+		}
+		if hooks[hook.Name] {
+			return invalidf("the %s hook is imported twice", hook.Name)
+		}
+		hooks[hook.Name] = true
+		if _, err := hook.timeout(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load stores dump through r and returns the changes whose hooks run once
+// the import is committed.
+func (s *kvService) load(ctx context.Context, r KvRepository, dump Dump, mode ImportMode) (ImportResult, []change, error) {
+	tx := s.withRepository(r)
+	// the hooks run once the whole import is committed
+	opCtx := deferDispatch(ctx)
+	var result ImportResult
+	var changes []change
+	for _, hook := range dump.Hooks {
+		hookExists, err := r.HookExists(ctx, hook.Name)
+		if err != nil {
+			return result, nil, fmt.Errorf("could not check if hook exists: %w", err)
+		}
+		if hookExists && mode == ImportSkipExisting {
+			continue
+		}
+		switch {
+		case hook.Filepath != "":
+			err = tx.SetFilePathHook(opCtx, hook.Name, hook.Filepath)
+		case hook.IsFile:
+			err = tx.SetFileHook(opCtx, hook.Name, hook.Script)
+		default:
+			err = tx.SetScriptHook(opCtx, hook.Name, hook.Script)
+		}
+		if err != nil {
+			return result, nil, fmt.Errorf("failed to import the %s hook: %w", hook.Name, err)
+		}
+		// new hooks have no timeout, the replaced ones get the imported one
+		timeout, err := hook.timeout()
+		if err != nil {
+			return result, nil, err
+		}
+		if timeout > 0 || hookExists {
+			if err := tx.SetHookTimeout(opCtx, hook.Name, timeout); err != nil {
+				return result, nil, fmt.Errorf("failed to import the %s hook: %w", hook.Name, err)
+			}
+		}
+		result.Hooks = append(result.Hooks, hook.Name)
+	}
+	imported := make(map[string]bool)
+	for _, key := range dump.Keys {
+		imported[key.Key] = true
+		before, err := s.snapshot(ctx, r, key.Key, false)
+		if err != nil {
+			return result, nil, err
+		}
+		if before.existed && mode == ImportSkipExisting {
+			result.Skipped = append(result.Skipped, key.Key)
+			continue
+		}
+		if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+			result.Skipped = append(result.Skipped, key.Key)
+			continue
+		}
+		if err := s.loadKey(opCtx, tx, r, key); err != nil {
+			return result, nil, fmt.Errorf("failed to import the %s key: %w", key.Key, err)
+		}
+		c, err := s.changeOf(ctx, r, key.Key, before, &key.Val)
+		if err != nil {
+			return result, nil, err
+		}
+		changes = append(changes, c)
+		if before.existed {
+			result.Updated = append(result.Updated, key.Key)
+		} else {
+			result.Created = append(result.Created, key.Key)
+		}
+	}
+	if mode != ImportReplace {
+		return result, changes, nil
+	}
+	stored, err := r.ListKeys(ctx)
+	if err != nil {
+		return result, nil, fmt.Errorf("failed to get the list of keys: %w", err)
+	}
+	for _, key := range stored {
+		if imported[key] {
+			continue
+		}
+		before, err := s.snapshot(ctx, r, key, true)
+		if err != nil {
+			return result, nil, err
+		}
+		if err := tx.Delete(opCtx, key); err != nil {
+			return result, nil, err
+		}
+		c, err := s.changeOf(ctx, r, key, before, nil)
+		if err != nil {
+			return result, nil, err
+		}
+		changes = append(changes, c)
+		result.Deleted = append(result.Deleted, key)
+	}
+	return result, changes, nil
+}
+
+// loadKey stores the value, type, metadata and attachments of an imported
+// key, replacing the stored ones.
+func (s *kvService) loadKey(ctx context.Context, tx KvService, r KvRepository, key DumpKey) error {
+	// the stored type may reject the imported value and the imported type
+	// the stored value, the type is declared once the value is stored
+	if err := tx.DeclareType(ctx, key.Key, TypeString); err != nil {
+		return err
+	}
+	var opts []SetOption
+	if key.Secret {
+		opts = append(opts, AsSecret())
+	}
+	if key.ExpiresAt != nil {
+		opts = append(opts, keepExpiry(*key.ExpiresAt))
+	}
+	if err := tx.Set(ctx, key.Key, key.Val, opts...); err != nil {
+		return err
+	}
+	if key.Type != "" && key.Type != TypeString {
+		if err := tx.DeclareType(ctx, key.Key, key.Type); err != nil {
+			return err
+		}
+	}
+	if err := tx.SetDescription(ctx, key.Key, key.Description); err != nil {
+		return err
+	}
+	if err := tx.SetOwner(ctx, key.Key, key.Owner); err != nil {
+		return err
+	}
+	info, err := tx.Info(ctx, key.Key)
+	if err != nil {
+		return err
+	}
+	if len(info.Tags) > 0 {
+		if err := tx.RemoveTags(ctx, key.Key, info.Tags...); err != nil {
+			return err
+		}
+	}
+	if len(key.Tags) > 0 {
+		if err := tx.AddTags(ctx, key.Key, key.Tags...); err != nil {
+			return err
+		}
+	}
+	for _, attachment := range key.Hooks {
+		if _, err := r.DetachHook(ctx, key.Key, attachment.Hook); err != nil {
+			return err
+		}
+		if err := tx.AttachHook(ctx, key.Key, attachment.Hook, attachment.Events...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// PurgeExpired deletes the expired keys of every namespace and runs the
+// hooks attached to them for the expire event. The expired value is passed
+// to the hooks in OLD_VAL and the key in KVZ_KEY. A KeyDeleted event is
+// published for every purged key. The hooks are run and reported as for
+// Delete, every expired key is purged before a *HookError joining the
+// errors of the failed hooks is returned.
+func (s *kvService) PurgeExpired(ctx context.Context) ([]CmdOutput, error) {
+	expired, err := s.r.ListExpired(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the expired keys: %w", err)
+	}
+	var cmdOutputs []CmdOutput
+	var errs []error
+	for _, entry := range expired {
+		ns := s.withRepository(s.r.WithNamespace(entry.Namespace))
+		c := change{key: entry.Key, event: EventExpire}
+		var deleted bool
+		err := ns.r.Transact(ctx, func(r KvRepository) error {
+			if !hooksSkipped(ctx) {
+				hooks, err := r.GetHooksForEvent(ctx, entry.Key, EventExpire)
+				if err != nil {
+					return fmt.Errorf("failed to get the expiry hooks of the %s key: %w", entry.Key, err)
+				}
+				c.hooks = hooks
+			}
+			var err error
+			deleted, err = r.DeleteExpiredKey(ctx, entry.Key)
+			if err != nil {
+				return fmt.Errorf("failed to delete the expired %s key: %w", entry.Key, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return cmdOutputs, err
+		}
+		if !deleted {
+			continue
+		}
+		c.oldVal, err = s.decrypt(entry.Namespace, entry.Key, entry.Val)
+		if err != nil {
+			if len(c.hooks) > 0 {
+				errs = append(errs, err)
+			}
+			// the subscribers are told about the expiry without the value
+			c.oldVal = SecretMask
+			c.hooks = nil
+		}
+		outputs, err := ns.dispatch(ctx, c)
+		cmdOutputs = append(cmdOutputs, outputs...)
+		var hookErr *HookError
+		if errors.As(err, &hookErr) {
+			errs = append(errs, hookErr.Err)
+		} else if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return cmdOutputs, &HookError{Err: errors.Join(errs...)}
+	}
+	return cmdOutputs, nil
+}
+
+// RunSweeper purges expired keys every interval until ctx is done. The result
+// of every sweep is passed to report, which may be nil.
+func RunSweeper(ctx context.Context, s KvService, interval time.Duration, report func([]CmdOutput, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			outputs, err := s.PurgeExpired(ctx)
+			if report != nil {
+				report(outputs, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package kv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// ValueType is the declared type of a key. Values are always stored as text,
+// the type decides which values Set accepts and what GetTyped returns.
+type ValueType string
+
+const (
+	TypeString   ValueType = "string"
+	TypeInt      ValueType = "int"
+	TypeFloat    ValueType = "float"
+	TypeBool     ValueType = "bool"
+	TypeDuration ValueType = "duration"
+	TypeJSON     ValueType = "json"
+	// TypeList values are JSON arrays of strings.
+	TypeList ValueType = "list"
+)
+
+var valueTypes = []ValueType{TypeString, TypeInt, TypeFloat, TypeBool, TypeDuration, TypeJSON, TypeList}
+
+func ParseValueType(name string) (ValueType, error) {
+	for _, t := range valueTypes {
+		if string(t) == name {
+			return t, nil
+		}
+	}
+	return "", invalidf("unknown value type '%s', expected one of %v", name, valueTypes)
+}
+
+// Parse converts a stored value to the Go type matching t: string, int64,
+// float64, bool, time.Duration, []string for lists and the result of
+// json.Unmarshal for JSON. The error may quote val, callers holding a
+// secret must not return it.
+func (t ValueType) Parse(val string) (any, error) {
+	switch t {
+	case TypeString, "":
+		return val, nil
+	case TypeInt:
+		return strconv.ParseInt(val, 10, 64)
+	case TypeFloat:
+		return strconv.ParseFloat(val, 64)
+	case TypeBool:
+		return strconv.ParseBool(val)
+	case TypeDuration:
+		return time.ParseDuration(val)
+	case TypeJSON:
+		var v any
+		if err := json.Unmarshal([]byte(val), &v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	case TypeList:
+		var v []string
+		if err := json.Unmarshal([]byte(val), &v); err != nil {
+			return nil, invalidf("a list must be a JSON array of strings: %w", err)
+		}
+		return v, nil
+	}
+	return nil, invalidf("unknown value type '%s'", t)
+}
+
+// checkType returns an error if val is not valid for the declared type of
+// key. The error does not quote the value, it may be a secret.
+func (s *kvService) checkType(ctx context.Context, key string, val string) error {
+	valueType, err := s.r.GetKeyType(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not get the type of the %s key: %w", key, err)
+	}
+	if _, err := valueType.Parse(val); err != nil {
+		return invalidf("the value is not a valid %s for the %s key", valueType, key)
+	}
+	return nil
+}
+
+// DeclareType sets the type of a key. If the key already holds a value it
+// must be valid for the new type.
+func (s *kvService) DeclareType(ctx context.Context, key string, valueType ValueType) error {
+	if key == "" {
+		return invalidf("key may not be empty")
+	}
+	if _, err := ParseValueType(string(valueType)); err != nil {
+		return err
+	}
+	keyExists, err := s.r.KeyExists(ctx, key)
+	if err != nil {
+		return fmt.Errorf("could not check if key exists: %w", err)
+	}
+	if keyExists {
+		val, err := s.r.GetVal(ctx, key)
+		if err != nil {
+			return fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+		}
+		val, err = s.decrypt(s.Namespace(), key, val)
+		if err != nil {
+			return err
+		}
+		if _, err := valueType.Parse(val); err != nil {
+			return invalidf("the current value of the %s key is not a valid %s", key, valueType)
+		}
+	}
+	err = s.r.SetKeyType(ctx, key, valueType)
+	if err != nil {
+		return fmt.Errorf("failed to declare the type of the %s key: %w", key, err)
+	}
+	return nil
+}
+
+func (s *kvService) GetType(ctx context.Context, key string) (ValueType, error) {
+	if key == "" {
+		return "", invalidf("key may not be empty")
+	}
+	valueType, err := s.r.GetKeyType(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("could not get the type of the %s key: %w", key, err)
+	}
+	return valueType, nil
+}
+
+// GetTyped returns the value of a key converted to its declared type.
+func (s *kvService) GetTyped(ctx context.Context, key string) (any, error) {
+	resolved, err := s.Resolve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	// the type is declared in the layer the value was read from, or by the
+	// schema for defaults
+	var valueType ValueType
+	if resolved.Default {
+		declared, _, err := s.schemaDefault(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		valueType = declared.valueType()
+	} else {
+		layer := s.withRepository(s.r.WithNamespace(resolved.Layer))
+		valueType, err = layer.GetType(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	typed, err := valueType.Parse(resolved.Val)
+	if err != nil {
+		return nil, fmt.Errorf("the stored value of the %s key is not a valid %s", key, valueType)
+	}
+	return typed, nil
+}
@@ -0,0 +1,78 @@
+package kv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// GetWithVersion returns the value of a key along with its version. The
+// version is incremented on every write and can be passed to SetIfVersion.
+func (s *kvService) GetWithVersion(ctx context.Context, key string) (string, int64, error) {
+	if key == "" {
+		return "", 0, invalidf("key may not be empty")
+	}
+	val, version, err := s.r.GetValWithVersion(ctx, key)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to get the value from the %s key: %w", key, err)
+	}
+	val, err = s.decrypt(s.Namespace(), key, val)
+	if err != nil {
+		return "", 0, err
+	}
+	return val, version, nil
+}
+
+// SetIfVersion sets the value of a key only if its stored version is still
+// version, a version of 0 only creates the key. A *ConflictError is returned
+// when the key was changed in the meantime, a *HookError when the value was
+// stored but its hooks could not be run.
+func (s *kvService) SetIfVersion(ctx context.Context, key string, val string, version int64, opts ...SetOption) error {
+	if version < 0 {
+		return invalidf("version may not be negative for key: %s", key)
+	}
+	var options setOptions
+	var c change
+	var written bool
+	err := s.r.Transact(ctx, func(r KvRepository) error {
+		if err := purgeExpiredKey(ctx, r, key); err != nil {
+			return err
+		}
+		var err error
+		options, err = s.withRepository(r).prepareSet(ctx, key, val, opts)
+		if err != nil {
+			return err
+		}
+		before, err := s.snapshot(ctx, r, key, false)
+		if err != nil {
+			return err
+		}
+		options.reuseCiphertext(before, val)
+		written, err = r.SetValIfVersion(ctx, key, options.stored, options.expiresAt, options.secret, version)
+		if err != nil {
+			return fmt.Errorf("failed to set a value to the %s key: %w", key, err)
+		}
+		if !written {
+			return nil
+		}
+		if options.seal {
+			if err := s.sealPlainVals(ctx, r, key); err != nil {
+				return err
+			}
+		}
+		c, err = s.changeOf(ctx, r, key, before, &val)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if written {
+		_, err = s.dispatch(overrideHookTimeout(ctx, options.hookTimeout), c)
+		return err
+	}
+	_, actual, err := s.r.GetValWithVersion(ctx, key)
+	if err != nil && !errors.Is(err, ErrKeyNotFound) {
+		return fmt.Errorf("could not get the version of the %s key: %w", key, err)
+	}
+	return &ConflictError{Key: key, Expected: version, Actual: actual}
+}
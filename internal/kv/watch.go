@@ -0,0 +1,129 @@
+package kv
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ChangeOp is what a change did to a key.
+type ChangeOp string
+
+const (
+	ChangeCreate ChangeOp = "create"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// ChangeEvent is a change of a key recorded in the change feed. The values
+// are nil when there was none, e.g. the new value of a deleted key, and the
+// values of secrets are masked.
+type ChangeEvent struct {
+	Revision  int64     `json:"revision"`
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Op        ChangeOp  `json:"op"`
+	OldVal    *string   `json:"old_val,omitempty"`
+	NewVal    *string   `json:"new_val,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+	// Err is set on the last event sent by Watch when the change feed could
+	// not be read, the other fields are then empty.
+	Err error `json:"-"`
+}
+
+// DefaultWatchInterval is how often Watch polls the change feed.
+const DefaultWatchInterval = 250 * time.Millisecond
+
+// watchPageSize is the maximum number of changes read in a single query.
+const watchPageSize = 256
+
+type watchOptions struct {
+	interval time.Duration
+	after    int64
+	resume   bool
+}
+
+type WatchOption func(*watchOptions)
+
+// WatchInterval sets how often the change feed is polled.
+func WatchInterval(interval time.Duration) WatchOption {
+	return func(o *watchOptions) {
+		o.interval = interval
+	}
+}
+
+// WatchAfter streams the changes recorded after the revision, e.g. the last
+// one seen before a restart, instead of the changes made once Watch is
+// called.
+func WatchAfter(revision int64) WatchOption {
+	return func(o *watchOptions) {
+		o.after = revision
+		o.resume = true
+	}
+}
+
+// Watch streams the changes of the keys of the namespace starting with
+// prefix, in the order they were committed, as they are made by any
+// process. The channel is closed once ctx is done.
+func (s *kvService) Watch(ctx context.Context, prefix string, opts ...WatchOption) (<-chan ChangeEvent, error) {
+	options := watchOptions{interval: DefaultWatchInterval}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	if options.interval <= 0 {
+		return nil, invalidf("the watch interval must be positive")
+	}
+	after := options.after
+	if !options.resume {
+		// the changes are streamed from the moment Watch returns
+		var err error
+		after, err = s.r.LastChange(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the change feed: %w", err)
+		}
+	}
+	events := make(chan ChangeEvent)
+	go func() {
+		defer close(events)
+		ticker := time.NewTicker(options.interval)
+		defer ticker.Stop()
+		for {
+			changes, err := s.r.ListChanges(ctx, prefix, after, watchPageSize)
+			if err != nil {
+				if ctx.Err() == nil {
+					select {
+					case events <- ChangeEvent{Err: fmt.Errorf("failed to read the change feed: %w", err)}:
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			for _, change := range changes {
+				change.OldVal = maskEncrypted(change.OldVal)
+				change.NewVal = maskEncrypted(change.NewVal)
+				select {
+				case events <- change:
+				case <-ctx.Done():
+					return
+				}
+				after = change.Revision
+			}
+			if len(changes) == watchPageSize {
+				continue
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
+
+func maskEncrypted(val *string) *string {
+	if val != nil && isEncrypted(*val) {
+		return ptr(SecretMask)
+	}
+	return val
+}
@@ -3,25 +3,40 @@ package sqlite
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"github.com/inner-daydream/kvz/internal/kv"
 )
 
 type KvRepositoryAdapter struct {
-	q Querier
+	q         Querier
+	namespace string
 }
 
 func (r *KvRepositoryAdapter) DeleteHook(ctx context.Context, name string) error {
-	return r.q.deleteHook(ctx, name)
+	params := deleteHookParams{
+		Namespace: r.namespace,
+		Name:      name,
+	}
+	return r.q.deleteHook(ctx, params)
 }
 
 func (r *KvRepositoryAdapter) DeleteKey(ctx context.Context, key string) error {
-	return r.q.deleteKey(ctx, key)
+	params := deleteKeyParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	return r.q.deleteKey(ctx, params)
 }
 
 func (r *KvRepositoryAdapter) SetFileHook(ctx context.Context, name string, content string) error {
 	params := setFileHookParams{
-		Name: name,
+		Namespace: r.namespace,
+		Name:      name,
 		Script: sql.NullString{
 			Valid:  true,
 			String: content,
@@ -32,7 +47,8 @@ func (r *KvRepositoryAdapter) SetFileHook(ctx context.Context, name string, cont
 
 func (r *KvRepositoryAdapter) SetFilePathHook(ctx context.Context, name string, filepath string) error {
 	params := setFilePathHookParams{
-		Name: name,
+		Namespace: r.namespace,
+		Name:      name,
 		Filepath: sql.NullString{
 			Valid:  true,
 			String: filepath,
@@ -43,7 +59,8 @@ func (r *KvRepositoryAdapter) SetFilePathHook(ctx context.Context, name string,
 
 func (r *KvRepositoryAdapter) SetScriptHook(ctx context.Context, name string, script string) error {
 	params := setScriptHookParams{
-		Name: name,
+		Namespace: r.namespace,
+		Name:      name,
 		Script: sql.NullString{
 			Valid:  true,
 			String: script,
@@ -52,42 +69,90 @@ func (r *KvRepositoryAdapter) SetScriptHook(ctx context.Context, name string, sc
 	return r.q.setScriptHook(ctx, params)
 }
 
-func (r *KvRepositoryAdapter) AttachHook(ctx context.Context, key string, hook string) error {
+func (r *KvRepositoryAdapter) SetHookTimeout(ctx context.Context, name string, timeout time.Duration) (bool, error) {
+	params := setHookTimeoutParams{
+		TimeoutMs: timeout.Milliseconds(),
+		Namespace: r.namespace,
+		Name:      name,
+	}
+	updated, err := r.q.setHookTimeout(ctx, params)
+	return updated > 0, err
+}
+
+func (r *KvRepositoryAdapter) AttachHook(ctx context.Context, key string, hook string, events []kv.Event) error {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = string(event)
+	}
 	params := attachHookParams{
-		Key:  key,
-		Hook: hook,
+		Namespace: r.namespace,
+		Key:       key,
+		Hook:      hook,
+		Events:    strings.Join(names, ","),
 	}
-	return r.q.attachHook(ctx, params)
+	err := r.q.attachHook(ctx, params)
+	if isConstraint(err) {
+		return kv.ErrAlreadyAttached
+	}
+	return err
 }
 
 func (r *KvRepositoryAdapter) GetVal(ctx context.Context, key string) (val string, err error) {
-	return r.q.getVal(ctx, key)
+	params := getValParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	val, err = r.q.getVal(ctx, params)
+	return val, keyError(err)
 }
 
 func (r *KvRepositoryAdapter) ListHooks(ctx context.Context) ([]string, error) {
-	return r.q.listHooks(ctx)
+	return r.q.listHooks(ctx, r.namespace)
 }
 
 func (r *KvRepositoryAdapter) ListKeys(ctx context.Context) ([]string, error) {
-	return r.q.listKeys(ctx)
+	return r.q.listKeys(ctx, r.namespace)
 }
 
-func (r *KvRepositoryAdapter) SetVal(ctx context.Context, key string, val string) error {
+func (r *KvRepositoryAdapter) SetVal(ctx context.Context, key string, val string, expiresAt time.Time, secret bool) error {
 	params := setValParams{
-		Key: key,
-		Val: val,
+		Namespace: r.namespace,
+		Key:       key,
+		Val:       val,
+		ExpiresAt: sql.NullInt64{
+			Valid: !expiresAt.IsZero(),
+			Int64: expiresAt.UnixMilli(),
+		},
+		Secret: secret,
 	}
 	return r.q.setVal(ctx, params)
 }
 
 func NewRepository(querier Querier) *KvRepositoryAdapter {
 	return &KvRepositoryAdapter{
-		q: querier,
+		q:         querier,
+		namespace: kv.DefaultNamespace,
 	}
 }
 
+// WithNamespace returns a copy of the repository scoped to the given namespace.
+func (r *KvRepositoryAdapter) WithNamespace(namespace string) kv.KvRepository {
+	return &KvRepositoryAdapter{
+		q:         r.q,
+		namespace: namespace,
+	}
+}
+
+func (r *KvRepositoryAdapter) Namespace() string {
+	return r.namespace
+}
+
 func (r *KvRepositoryAdapter) GetAttachedHooks(ctx context.Context, key string) ([]kv.Hook, error) {
-	sqliteHooks, err := r.q.getAttachedHooks(ctx, key)
+	params := getAttachedHooksParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	sqliteHooks, err := r.q.getAttachedHooks(ctx, params)
 	if err != nil {
 		return nil, err
 	}
@@ -103,13 +168,18 @@ func (r *KvRepositoryAdapter) GetAttachedHooks(ctx context.Context, key string)
 			IsFile:      sqliteHook.IsFile,
 			IsLocalFile: sqliteHook.Filepath.Valid,
 			Filepath:    sqliteHook.Filepath.String,
+			Timeout:     time.Duration(sqliteHook.TimeoutMs) * time.Millisecond,
 		}
 	}
 	return kvHooks, nil
 }
 
 func (r *KvRepositoryAdapter) KeyExists(ctx context.Context, key string) (bool, error) {
-	status, err := r.q.keyExists(ctx, key)
+	params := keyExistsParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	status, err := r.q.keyExists(ctx, params)
 	if err != nil {
 		return false, err
 	}
@@ -117,9 +187,1075 @@ func (r *KvRepositoryAdapter) KeyExists(ctx context.Context, key string) (bool,
 }
 
 func (r *KvRepositoryAdapter) HookExists(ctx context.Context, name string) (bool, error) {
-	status, err := r.q.hookExists(ctx, name)
+	params := hookExistsParams{
+		Namespace: r.namespace,
+		Name:      name,
+	}
+	status, err := r.q.hookExists(ctx, params)
 	if err != nil {
 		return false, err
 	}
 	return status == 1, nil
 }
+
+func (r *KvRepositoryAdapter) GetHookKeys(ctx context.Context, hook string) ([]string, error) {
+	params := getHookKeysParams{
+		Namespace: r.namespace,
+		Hook:      hook,
+	}
+	return r.q.getHookKeys(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) DetachHook(ctx context.Context, key string, hook string) (bool, error) {
+	params := detachHookParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Hook:      hook,
+	}
+	detached, err := r.q.detachHook(ctx, params)
+	if err != nil {
+		return false, err
+	}
+	return detached > 0, nil
+}
+
+func (r *KvRepositoryAdapter) DetachAllHooks(ctx context.Context, key string) (int64, error) {
+	params := detachAllHooksParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	return r.q.detachAllHooks(ctx, params)
+}
+
+func toRevision(h KvHistory) kv.Revision {
+	return kv.Revision{
+		Revision:  h.Revision,
+		Key:       h.Key,
+		Val:       h.Val.String,
+		Deleted:   h.Deleted,
+		ChangedAt: time.UnixMilli(h.ChangedAt),
+	}
+}
+
+func (r *KvRepositoryAdapter) ListRevisions(ctx context.Context, key string) ([]kv.Revision, error) {
+	params := listRevisionsParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	history, err := r.q.listRevisions(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]kv.Revision, len(history))
+	for i, h := range history {
+		revisions[i] = toRevision(h)
+	}
+	return revisions, nil
+}
+
+func (r *KvRepositoryAdapter) GetRevision(ctx context.Context, key string, revision int64) (kv.Revision, error) {
+	params := getRevisionParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Revision:  revision,
+	}
+	h, err := r.q.getRevision(ctx, params)
+	if err != nil {
+		return kv.Revision{}, keyError(err)
+	}
+	return toRevision(h), nil
+}
+
+func (r *KvRepositoryAdapter) GetRevisionAt(ctx context.Context, key string, at time.Time) (kv.Revision, error) {
+	params := getRevisionAtParams{
+		Namespace: r.namespace,
+		Key:       key,
+		ChangedAt: at.UnixMilli(),
+	}
+	h, err := r.q.getRevisionAt(ctx, params)
+	if err != nil {
+		return kv.Revision{}, keyError(err)
+	}
+	return toRevision(h), nil
+}
+
+func (r *KvRepositoryAdapter) ListPlainVals(ctx context.Context, key string) ([]string, error) {
+	return r.q.listPlainVals(ctx, listPlainValsParams{
+		Namespace: r.namespace,
+		Key:       key,
+	})
+}
+
+// SealVal replaces val with encrypted in the history and the changes of
+// key, and in the snapshots where the key is marked secret.
+func (r *KvRepositoryAdapter) SealVal(ctx context.Context, key string, val string, encrypted string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		params := sealHistoryValParams{
+			Encrypted: encrypted,
+			Namespace: r.namespace,
+			Key:       key,
+			Val:       val,
+		}
+		if err := q.sealHistoryVal(ctx, params); err != nil {
+			return err
+		}
+		if err := q.sealChangesOldVal(ctx, sealChangesOldValParams(params)); err != nil {
+			return err
+		}
+		if err := q.sealChangesNewVal(ctx, sealChangesNewValParams(params)); err != nil {
+			return err
+		}
+		return q.sealSnapshotVal(ctx, sealSnapshotValParams(params))
+	})
+}
+
+func (r *KvRepositoryAdapter) ListNamespaces(ctx context.Context) ([]string, error) {
+	return r.q.listNamespaces(ctx)
+}
+
+func (r *KvRepositoryAdapter) ExportNamespace(ctx context.Context, namespace string) ([]kv.Entry, error) {
+	params := exportNamespaceParams{
+		Namespace: namespace,
+		Children:  namespace + kv.NamespaceSeparator + "*",
+	}
+	rows, err := r.q.exportNamespace(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]kv.Entry, len(rows))
+	for i, row := range rows {
+		entries[i] = kv.Entry{
+			Namespace: row.Namespace,
+			Key:       row.Key,
+			Val:       row.Val,
+			Secret:    row.Secret,
+		}
+	}
+	return entries, nil
+}
+
+// DeleteNamespace deletes the rows of the namespace, and of the namespaces
+// nested below it, from every table scoped by namespace. The profiles left
+// without layers are deleted.
+func (r *KvRepositoryAdapter) DeleteNamespace(ctx context.Context, namespace string) error {
+	children := namespace + kv.NamespaceSeparator + "*"
+	return r.transact(ctx, func(q *Queries) error {
+		if err := q.deleteNamespaceKeyHooks(ctx, deleteNamespaceKeyHooksParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		if err := q.deleteNamespaceKeys(ctx, deleteNamespaceKeysParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		if err := q.deleteNamespaceHooks(ctx, deleteNamespaceHooksParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		if err := q.deleteNamespaceTypes(ctx, deleteNamespaceTypesParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		if err := q.deleteNamespaceSchemas(ctx, deleteNamespaceSchemasParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		if err := q.deleteNamespaceLayers(ctx, deleteNamespaceLayersParams{Namespace: namespace, Children: children}); err != nil {
+			return err
+		}
+		return q.deleteEmptyProfiles(ctx)
+	})
+}
+
+// GetKeyType returns the declared type of a key, keys without a declaration
+// are strings.
+func (r *KvRepositoryAdapter) GetKeyType(ctx context.Context, key string) (kv.ValueType, error) {
+	params := getKeyTypeParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	valueType, err := r.q.getKeyType(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return kv.TypeString, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return kv.ValueType(valueType), nil
+}
+
+func (r *KvRepositoryAdapter) SetKeyType(ctx context.Context, key string, valueType kv.ValueType) error {
+	params := setKeyTypeParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Type:      string(valueType),
+	}
+	return r.q.setKeyType(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) GetHooksForEvent(ctx context.Context, key string, event kv.Event) ([]kv.Hook, error) {
+	params := getHooksForEventParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Event:     string(event),
+	}
+	sqliteHooks, err := r.q.getHooksForEvent(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	kvHooks := make([]kv.Hook, len(sqliteHooks))
+	for i, sqliteHook := range sqliteHooks {
+		kvHooks[i] = kv.Hook{
+			Script:      sqliteHook.Script.String,
+			Name:        sqliteHook.Name,
+			IsFile:      sqliteHook.IsFile,
+			IsLocalFile: sqliteHook.Filepath.Valid,
+			Filepath:    sqliteHook.Filepath.String,
+			Timeout:     time.Duration(sqliteHook.TimeoutMs) * time.Millisecond,
+		}
+	}
+	return kvHooks, nil
+}
+
+// ListExpired returns the expired keys of every namespace.
+func (r *KvRepositoryAdapter) ListExpired(ctx context.Context) ([]kv.Entry, error) {
+	rows, err := r.q.listExpired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]kv.Entry, len(rows))
+	for i, row := range rows {
+		entries[i] = kv.Entry{
+			Namespace: row.Namespace,
+			Key:       row.Key,
+			Val:       row.Val,
+			Secret:    row.Secret,
+		}
+	}
+	return entries, nil
+}
+
+// DeleteExpiredKey deletes the key only if it is still expired, so a value
+// written since it was listed is kept.
+func (r *KvRepositoryAdapter) DeleteExpiredKey(ctx context.Context, key string) (bool, error) {
+	params := deleteExpiredKeyParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	deleted, err := r.q.deleteExpiredKey(ctx, params)
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+func (r *KvRepositoryAdapter) GetValWithVersion(ctx context.Context, key string) (string, int64, error) {
+	params := getValWithVersionParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	row, err := r.q.getValWithVersion(ctx, params)
+	if err != nil {
+		return "", 0, keyError(err)
+	}
+	return row.Val, row.Version, nil
+}
+
+// SetValIfVersion writes the value only if the stored version of the key
+// matches. Version 0 expects the key to not exist. It reports whether the
+// value was written.
+func (r *KvRepositoryAdapter) SetValIfVersion(ctx context.Context, key string, val string, expiresAt time.Time, secret bool, version int64) (bool, error) {
+	expires := sql.NullInt64{
+		Valid: !expiresAt.IsZero(),
+		Int64: expiresAt.UnixMilli(),
+	}
+	var written int64
+	var err error
+	if version == 0 {
+		written, err = r.q.setValIfAbsent(ctx, setValIfAbsentParams{
+			Namespace: r.namespace,
+			Key:       key,
+			Val:       val,
+			ExpiresAt: expires,
+			Secret:    secret,
+		})
+	} else {
+		written, err = r.q.setValIfVersion(ctx, setValIfVersionParams{
+			Val:       val,
+			ExpiresAt: expires,
+			Secret:    secret,
+			Namespace: r.namespace,
+			Key:       key,
+			Version:   version,
+		})
+	}
+	if err != nil {
+		return false, err
+	}
+	return written > 0, nil
+}
+
+// Transact runs fn with a repository bound to a single transaction. The
+// transaction is rolled back if fn returns an error.
+func (r *KvRepositoryAdapter) Transact(ctx context.Context, fn func(kv.KvRepository) error) error {
+	return r.transact(ctx, func(tx *Queries) error {
+		return fn(&KvRepositoryAdapter{
+			q:         tx,
+			namespace: r.namespace,
+		})
+	})
+}
+
+func (r *KvRepositoryAdapter) transact(ctx context.Context, fn func(*Queries) error) error {
+	q, ok := r.q.(*Queries)
+	if !ok {
+		return fmt.Errorf("transactions are not supported by %T", r.q)
+	}
+	return q.transact(ctx, fn)
+}
+
+// globEscaper quotes the GLOB wildcards so a prefix is matched literally.
+var globEscaper = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+
+// pagePatterns returns the prefix, glob and page size to pass to the
+// listing queries, the filters that are not set match everything.
+func pagePatterns(opts kv.ListOptions) (prefix string, glob string, pageSize int64) {
+	prefix = globEscaper.Replace(opts.Prefix) + "*"
+	glob = opts.Glob
+	if glob == "" {
+		glob = "*"
+	}
+	pageSize = int64(opts.Limit)
+	if pageSize <= 0 {
+		pageSize = -1
+	}
+	return prefix, glob, pageSize
+}
+
+func (r *KvRepositoryAdapter) ListKeysPage(ctx context.Context, opts kv.ListOptions) ([]string, error) {
+	prefix, glob, pageSize := pagePatterns(opts)
+	params := listKeysPageParams{
+		Namespace: r.namespace,
+		Cursor:    opts.Cursor,
+		Prefix:    prefix,
+		Pattern:   glob,
+		Regex:     opts.Regex,
+		Tag:       opts.Tag,
+		PageSize:  pageSize,
+	}
+	if opts.Tag != "" {
+		params.MinTagMatches = 1
+	}
+	return r.q.listKeysPage(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) ListHooksPage(ctx context.Context, opts kv.ListOptions) ([]string, error) {
+	prefix, glob, pageSize := pagePatterns(opts)
+	params := listHooksPageParams{
+		Namespace: r.namespace,
+		Cursor:    opts.Cursor,
+		Prefix:    prefix,
+		Pattern:   glob,
+		Regex:     opts.Regex,
+		PageSize:  pageSize,
+	}
+	return r.q.listHooksPage(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) GetKeyInfo(ctx context.Context, key string) (kv.KeyInfo, error) {
+	params := getKeyInfoParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	row, err := r.q.getKeyInfo(ctx, params)
+	if err != nil {
+		return kv.KeyInfo{}, keyError(err)
+	}
+	tags, err := r.q.listTags(ctx, listTagsParams{
+		Namespace: r.namespace,
+		Key:       key,
+	})
+	if err != nil {
+		return kv.KeyInfo{}, err
+	}
+	info := kv.KeyInfo{
+		Namespace:   row.Namespace,
+		Key:         row.Key,
+		Val:         row.Val,
+		Version:     row.Version,
+		Description: row.Description,
+		Owner:       row.Owner,
+		Secret:      row.Secret,
+		Tags:        tags,
+		CreatedAt:   time.UnixMilli(row.CreatedAt),
+		UpdatedAt:   time.UnixMilli(row.UpdatedAt),
+	}
+	if row.ExpiresAt.Valid {
+		info.ExpiresAt = time.UnixMilli(row.ExpiresAt.Int64)
+	}
+	return info, nil
+}
+
+func (r *KvRepositoryAdapter) SetDescription(ctx context.Context, key string, description string) error {
+	params := setDescriptionParams{
+		Description: description,
+		Namespace:   r.namespace,
+		Key:         key,
+	}
+	return r.q.setDescription(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) SetOwner(ctx context.Context, key string, owner string) error {
+	params := setOwnerParams{
+		Owner:     owner,
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	return r.q.setOwner(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) AddTag(ctx context.Context, key string, tag string) error {
+	params := addTagParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Tag:       tag,
+	}
+	return r.q.addTag(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) RemoveTag(ctx context.Context, key string, tag string) error {
+	params := removeTagParams{
+		Namespace: r.namespace,
+		Key:       key,
+		Tag:       tag,
+	}
+	return r.q.removeTag(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) IsSecret(ctx context.Context, key string) (bool, error) {
+	params := isSecretParams{
+		Namespace: r.namespace,
+		Key:       key,
+	}
+	secret, err := r.q.isSecret(ctx, params)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return secret, err
+}
+
+// RenameKey moves the value, metadata, tags, type and attachments of a key
+// to a new name, val is stored as the value of newKey. A type declared for
+// newKey is kept.
+func (r *KvRepositoryAdapter) RenameKey(ctx context.Context, key string, newKey string, val string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		err := q.renameKey(ctx, renameKeyParams{
+			NewKey:    newKey,
+			Val:       val,
+			Namespace: r.namespace,
+			Key:       key,
+		})
+		if err != nil {
+			return err
+		}
+		params := renameKeyTagsParams{
+			NewKey:    newKey,
+			Namespace: r.namespace,
+			Key:       key,
+		}
+		if err := q.renameKeyTags(ctx, params); err != nil {
+			return err
+		}
+		if err := q.copyKeyType(ctx, copyKeyTypeParams(params)); err != nil {
+			return err
+		}
+		return q.deleteKeyType(ctx, deleteKeyTypeParams{
+			Namespace: r.namespace,
+			Key:       key,
+		})
+	})
+}
+
+// CopyKey copies the metadata, tags, type and attachments of a key to a new
+// key whose value is val. A type declared for newKey is kept.
+func (r *KvRepositoryAdapter) CopyKey(ctx context.Context, key string, newKey string, val string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		err := q.copyKey(ctx, copyKeyParams{
+			NewKey:    newKey,
+			Val:       val,
+			Namespace: r.namespace,
+			Key:       key,
+		})
+		if err != nil {
+			return err
+		}
+		params := copyKeyTagsParams{
+			NewKey:    newKey,
+			Namespace: r.namespace,
+			Key:       key,
+		}
+		if err := q.copyKeyTags(ctx, params); err != nil {
+			return err
+		}
+		if err := q.copyKeyType(ctx, copyKeyTypeParams(params)); err != nil {
+			return err
+		}
+		return q.copyKeyHooks(ctx, copyKeyHooksParams(params))
+	})
+}
+
+func (r *KvRepositoryAdapter) Search(ctx context.Context, match string, limit int) ([]kv.SearchResult, error) {
+	pageSize := int64(limit)
+	if pageSize <= 0 {
+		pageSize = -1
+	}
+	rows, err := r.q.searchKeys(ctx, searchKeysParams{
+		Query:     match,
+		Namespace: r.namespace,
+		PageSize:  pageSize,
+	})
+	if err != nil {
+		return nil, searchError(err)
+	}
+	results := make([]kv.SearchResult, 0, len(rows))
+	for _, row := range rows {
+		results = append(results, kv.SearchResult{Key: row.Key, Snippet: row.Snippet, Rank: row.Rank})
+	}
+	return results, nil
+}
+
+func (r *KvRepositoryAdapter) ExportHooks(ctx context.Context) ([]kv.Hook, error) {
+	rows, err := r.q.exportHooks(ctx, r.namespace)
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]kv.Hook, len(rows))
+	for i, row := range rows {
+		hooks[i] = kv.Hook{
+			Name:        row.Name,
+			Script:      row.Script.String,
+			IsFile:      row.IsFile,
+			IsLocalFile: row.Filepath.Valid,
+			Filepath:    row.Filepath.String,
+			Timeout:     time.Duration(row.TimeoutMs) * time.Millisecond,
+		}
+	}
+	return hooks, nil
+}
+
+func (r *KvRepositoryAdapter) ExportAttachments(ctx context.Context) ([]kv.Attachment, error) {
+	rows, err := r.q.exportAttachments(ctx, r.namespace)
+	if err != nil {
+		return nil, err
+	}
+	attachments := make([]kv.Attachment, len(rows))
+	for i, row := range rows {
+		var events []kv.Event
+		for _, event := range strings.Split(row.Events, ",") {
+			events = append(events, kv.Event(event))
+		}
+		attachments[i] = kv.Attachment{Key: row.Key, Hook: row.Hook, Events: events}
+	}
+	return attachments, nil
+}
+
+func (r *KvRepositoryAdapter) CreateSnapshot(ctx context.Context, name string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		err := q.createSnapshot(ctx, name)
+		if isConstraint(err) {
+			return kv.ErrSnapshotExists
+		}
+		if err != nil {
+			return err
+		}
+		copies := []func(context.Context, string) error{
+			q.snapshotKeys,
+			q.snapshotHooks,
+			q.snapshotAttachments,
+			q.snapshotTags,
+			q.snapshotTypes,
+		}
+		for _, copy := range copies {
+			if err := copy(ctx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *KvRepositoryAdapter) ListSnapshots(ctx context.Context) ([]kv.Snapshot, error) {
+	rows, err := r.q.listSnapshots(ctx)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]kv.Snapshot, len(rows))
+	for i, row := range rows {
+		snapshots[i] = kv.Snapshot{
+			Name:      row.Name,
+			CreatedAt: time.UnixMilli(row.CreatedAt),
+			Keys:      row.Keys,
+		}
+	}
+	return snapshots, nil
+}
+
+func (r *KvRepositoryAdapter) SnapshotExists(ctx context.Context, name string) (bool, error) {
+	status, err := r.q.snapshotExists(ctx, name)
+	return status == 1, err
+}
+
+func (r *KvRepositoryAdapter) SnapshotKeyExists(ctx context.Context, name string, key string) (bool, error) {
+	status, err := r.q.snapshotKeyExists(ctx, snapshotKeyExistsParams{
+		Snapshot:  name,
+		Namespace: r.namespace,
+		Key:       key,
+	})
+	return status == 1, err
+}
+
+func (r *KvRepositoryAdapter) DiffSnapshot(ctx context.Context, name string) ([]kv.SnapshotDiff, error) {
+	keys, err := r.q.diffSnapshotKeys(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := r.q.diffSnapshotHooks(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	diffs := make([]kv.SnapshotDiff, 0, len(keys)+len(hooks))
+	for _, key := range keys {
+		diffs = append(diffs, kv.SnapshotDiff{Namespace: key.Namespace, Name: key.Key, Kind: kv.DiffKind(key.Kind)})
+	}
+	for _, hook := range hooks {
+		diffs = append(diffs, kv.SnapshotDiff{Namespace: hook.Namespace, Name: hook.Name, Hook: true, Kind: kv.DiffKind(hook.Kind)})
+	}
+	return diffs, nil
+}
+
+func (r *KvRepositoryAdapter) DiffSnapshotSecrets(ctx context.Context, name string) ([]kv.SecretDiff, error) {
+	rows, err := r.q.diffSnapshotSecrets(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make([]kv.SecretDiff, len(rows))
+	for i, row := range rows {
+		secrets[i] = kv.SecretDiff(row)
+	}
+	return secrets, nil
+}
+
+// snapshotScope is the whole store or a single key, the parameters shared by
+// the restore queries.
+type snapshotScope struct {
+	WholeStore bool
+	Namespace  string
+	Key        string
+}
+
+// restoreScope restores the keys of the scope from the snapshot, restoreHooks
+// restores the hooks before the attachments.
+func restoreScope(ctx context.Context, q *Queries, name string, scope snapshotScope, restoreHooks func() error) error {
+	err := q.restoreDeleteKeys(ctx, restoreDeleteKeysParams{
+		WholeStore: scope.WholeStore,
+		Namespace:  scope.Namespace,
+		Key:        scope.Key,
+		Snapshot:   name,
+	})
+	if err != nil {
+		return err
+	}
+	err = q.restoreKeys(ctx, restoreKeysParams{
+		Snapshot:   name,
+		WholeStore: scope.WholeStore,
+		Namespace:  scope.Namespace,
+		Key:        scope.Key,
+	})
+	if err != nil {
+		return err
+	}
+	if err := restoreHooks(); err != nil {
+		return err
+	}
+	if err := q.restoreDeleteAttachments(ctx, restoreDeleteAttachmentsParams(scope)); err != nil {
+		return err
+	}
+	err = q.restoreAttachments(ctx, restoreAttachmentsParams{
+		Snapshot:   name,
+		WholeStore: scope.WholeStore,
+		Namespace:  scope.Namespace,
+		Key:        scope.Key,
+	})
+	if err != nil {
+		return err
+	}
+	if err := q.restoreDeleteTags(ctx, restoreDeleteTagsParams(scope)); err != nil {
+		return err
+	}
+	err = q.restoreTags(ctx, restoreTagsParams{
+		Snapshot:   name,
+		WholeStore: scope.WholeStore,
+		Namespace:  scope.Namespace,
+		Key:        scope.Key,
+	})
+	if err != nil {
+		return err
+	}
+	if err := q.restoreDeleteTypes(ctx, restoreDeleteTypesParams(scope)); err != nil {
+		return err
+	}
+	return q.restoreTypes(ctx, restoreTypesParams{
+		Snapshot:   name,
+		WholeStore: scope.WholeStore,
+		Namespace:  scope.Namespace,
+		Key:        scope.Key,
+	})
+}
+
+func (r *KvRepositoryAdapter) RestoreSnapshot(ctx context.Context, name string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		return restoreScope(ctx, q, name, snapshotScope{WholeStore: true}, func() error {
+			if err := q.restoreDeleteHooks(ctx, name); err != nil {
+				return err
+			}
+			return q.restoreHooks(ctx, name)
+		})
+	})
+}
+
+func (r *KvRepositoryAdapter) RestoreSnapshotKey(ctx context.Context, name string, key string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		scope := snapshotScope{Namespace: r.namespace, Key: key}
+		return restoreScope(ctx, q, name, scope, func() error {
+			return q.restoreKeyHooks(ctx, restoreKeyHooksParams{
+				Snapshot:  name,
+				Namespace: r.namespace,
+				Key:       key,
+			})
+		})
+	})
+}
+
+func (r *KvRepositoryAdapter) DeleteSnapshot(ctx context.Context, name string) (bool, error) {
+	deleted, err := r.q.deleteSnapshot(ctx, name)
+	return deleted > 0, err
+}
+
+func (r *KvRepositoryAdapter) AppendAudit(ctx context.Context, entry kv.AuditEntry) error {
+	params := appendAuditParams{
+		Namespace: entry.Namespace,
+		Action:    string(entry.Action),
+		Target:    entry.Target,
+		OldVal:    nullString(entry.OldVal),
+		NewVal:    nullString(entry.NewVal),
+		OsUser:    entry.User,
+		Host:      entry.Host,
+		Pid:       int64(entry.PID),
+		Command:   entry.Command,
+	}
+	return r.q.appendAudit(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) QueryAudit(ctx context.Context, filter kv.AuditFilter) ([]kv.AuditEntry, error) {
+	params := queryAuditParams{
+		Namespace: exactGlob(filter.Namespace),
+		Target:    exactGlob(filter.Key),
+		OsUser:    exactGlob(filter.User),
+		Until:     math.MaxInt64,
+		PageSize:  int64(filter.Limit),
+	}
+	if !filter.Since.IsZero() {
+		params.Since = filter.Since.UnixMilli()
+	}
+	if !filter.Until.IsZero() {
+		params.Until = filter.Until.UnixMilli()
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = -1
+	}
+	rows, err := r.q.queryAudit(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	// the query returns the newest entries first so that the limit keeps
+	// them, they are returned in the order they were recorded
+	entries := make([]kv.AuditEntry, len(rows))
+	for j, row := range rows {
+		i := len(rows) - 1 - j
+		entries[i] = kv.AuditEntry{
+			ID:        row.ID,
+			At:        time.UnixMilli(row.At),
+			Namespace: row.Namespace,
+			Action:    kv.AuditAction(row.Action),
+			Target:    row.Target,
+			User:      row.OsUser,
+			Host:      row.Host,
+			PID:       int(row.Pid),
+			Command:   row.Command,
+		}
+		if row.OldVal.Valid {
+			oldVal := row.OldVal.String
+			entries[i].OldVal = &oldVal
+		}
+		if row.NewVal.Valid {
+			newVal := row.NewVal.String
+			entries[i].NewVal = &newVal
+		}
+	}
+	return entries, nil
+}
+
+func nullString(s *string) sql.NullString {
+	if s == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{Valid: true, String: *s}
+}
+
+// exactGlob returns a GLOB pattern matching s literally, or anything when s
+// is empty.
+func exactGlob(s string) string {
+	if s == "" {
+		return "*"
+	}
+	return globEscaper.Replace(s)
+}
+
+// SetProfile replaces the layers of the profile, the hooks attached to its
+// keys are kept.
+func (r *KvRepositoryAdapter) SetProfile(ctx context.Context, name string, layers []string) error {
+	return r.transact(ctx, func(q *Queries) error {
+		if err := q.createProfile(ctx, name); err != nil {
+			return err
+		}
+		if err := q.deleteProfileLayers(ctx, name); err != nil {
+			return err
+		}
+		for i, layer := range layers {
+			params := addProfileLayerParams{
+				Profile:   name,
+				Position:  int64(i),
+				Namespace: layer,
+			}
+			if err := q.addProfileLayer(ctx, params); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *KvRepositoryAdapter) GetProfile(ctx context.Context, name string) ([]string, error) {
+	return r.q.getProfileLayers(ctx, name)
+}
+
+func (r *KvRepositoryAdapter) ListProfiles(ctx context.Context) ([]kv.Profile, error) {
+	rows, err := r.q.listProfileLayers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []kv.Profile
+	for _, row := range rows {
+		profiles = appendLayer(profiles, row.Name, row.Namespace)
+	}
+	return profiles, nil
+}
+
+func (r *KvRepositoryAdapter) ProfilesWithLayer(ctx context.Context, namespace string) ([]kv.Profile, error) {
+	rows, err := r.q.listProfileLayersWith(ctx, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var profiles []kv.Profile
+	for _, row := range rows {
+		profiles = appendLayer(profiles, row.Profile, row.Namespace)
+	}
+	return profiles, nil
+}
+
+// appendLayer adds a layer to the last profile, or a new profile when the
+// layer belongs to another one. The layers are listed profile by profile.
+func appendLayer(profiles []kv.Profile, name string, layer string) []kv.Profile {
+	if n := len(profiles); n > 0 && profiles[n-1].Name == name {
+		profiles[n-1].Layers = append(profiles[n-1].Layers, layer)
+		return profiles
+	}
+	return append(profiles, kv.Profile{Name: name, Layers: []string{layer}})
+}
+
+func (r *KvRepositoryAdapter) DeleteProfile(ctx context.Context, name string) (bool, error) {
+	deleted, err := r.q.deleteProfile(ctx, name)
+	return deleted > 0, err
+}
+
+func (r *KvRepositoryAdapter) AttachProfileHook(ctx context.Context, profile string, key string, hook string, events []kv.Event) error {
+	names := make([]string, len(events))
+	for i, event := range events {
+		names[i] = string(event)
+	}
+	params := attachProfileHookParams{
+		Profile:   profile,
+		Key:       key,
+		Namespace: r.namespace,
+		Hook:      hook,
+		Events:    strings.Join(names, ","),
+	}
+	err := r.q.attachProfileHook(ctx, params)
+	if isConstraint(err) {
+		return kv.ErrAlreadyAttached
+	}
+	return err
+}
+
+func (r *KvRepositoryAdapter) DetachProfileHook(ctx context.Context, profile string, key string, hook string) (bool, error) {
+	params := detachProfileHookParams{
+		Profile: profile,
+		Key:     key,
+		Hook:    hook,
+	}
+	detached, err := r.q.detachProfileHook(ctx, params)
+	return detached > 0, err
+}
+
+func (r *KvRepositoryAdapter) GetProfileHooksForEvent(ctx context.Context, profile string, key string, event kv.Event) ([]kv.Hook, error) {
+	params := getProfileHooksForEventParams{
+		Profile: profile,
+		Key:     key,
+		Event:   string(event),
+	}
+	rows, err := r.q.getProfileHooksForEvent(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	hooks := make([]kv.Hook, len(rows))
+	for i, row := range rows {
+		hooks[i] = kv.Hook{
+			Script:      row.Script.String,
+			Name:        row.Name,
+			IsFile:      row.IsFile,
+			IsLocalFile: row.Filepath.Valid,
+			Filepath:    row.Filepath.String,
+			Timeout:     time.Duration(row.TimeoutMs) * time.Millisecond,
+		}
+	}
+	return hooks, nil
+}
+
+func (r *KvRepositoryAdapter) GetHookProfileKeys(ctx context.Context, hook string) ([]kv.ProfileKey, error) {
+	params := getHookProfileKeysParams{
+		Namespace: r.namespace,
+		Hook:      hook,
+	}
+	rows, err := r.q.getHookProfileKeys(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]kv.ProfileKey, len(rows))
+	for i, row := range rows {
+		keys[i] = kv.ProfileKey{Profile: row.Profile, Key: row.Key}
+	}
+	return keys, nil
+}
+
+func (r *KvRepositoryAdapter) GetSchema(ctx context.Context) (string, error) {
+	document, err := r.q.getSchema(ctx, r.namespace)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return document, err
+}
+
+func (r *KvRepositoryAdapter) SetSchema(ctx context.Context, document string) error {
+	params := setSchemaParams{
+		Namespace: r.namespace,
+		Document:  document,
+	}
+	return r.q.setSchema(ctx, params)
+}
+
+func (r *KvRepositoryAdapter) DeleteSchema(ctx context.Context) (bool, error) {
+	deleted, err := r.q.deleteSchema(ctx, r.namespace)
+	return deleted > 0, err
+}
+
+func (r *KvRepositoryAdapter) ListSchemas(ctx context.Context) (map[string]string, error) {
+	rows, err := r.q.listSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schemas := make(map[string]string, len(rows))
+	for _, row := range rows {
+		schemas[row.Namespace] = row.Document
+	}
+	return schemas, nil
+}
+
+func (r *KvRepositoryAdapter) LastChange(ctx context.Context) (int64, error) {
+	return r.q.lastChange(ctx)
+}
+
+func (r *KvRepositoryAdapter) Prune(ctx context.Context, before time.Time, maxChanges int, maxRevisions int) (kv.PruneResult, error) {
+	var result kv.PruneResult
+	err := r.transact(ctx, func(q *Queries) error {
+		if !before.IsZero() {
+			changes, err := q.pruneChangesBefore(ctx, before.UnixMilli())
+			if err != nil {
+				return err
+			}
+			revisions, err := q.pruneHistoryBefore(ctx, before.UnixMilli())
+			if err != nil {
+				return err
+			}
+			result.Changes += changes
+			result.Revisions += revisions
+		}
+		if maxChanges > 0 {
+			changes, err := q.pruneChangesBeyond(ctx, int64(maxChanges-1))
+			if err != nil {
+				return err
+			}
+			result.Changes += changes
+		}
+		if maxRevisions > 0 {
+			revisions, err := q.pruneHistoryBeyond(ctx, int64(maxRevisions-1))
+			if err != nil {
+				return err
+			}
+			result.Revisions += revisions
+		}
+		return nil
+	})
+	return result, err
+}
+
+// ListChanges returns the changes of the keys of the namespace starting
+// with prefix recorded after the revision, the oldest first.
+func (r *KvRepositoryAdapter) ListChanges(ctx context.Context, prefix string, after int64, limit int) ([]kv.ChangeEvent, error) {
+	params := listChangesParams{
+		After:     after,
+		Namespace: r.namespace,
+		Prefix:    globEscaper.Replace(prefix) + "*",
+		PageSize:  int64(limit),
+	}
+	if params.PageSize <= 0 {
+		params.PageSize = -1
+	}
+	rows, err := r.q.listChanges(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	changes := make([]kv.ChangeEvent, len(rows))
+	for i, row := range rows {
+		changes[i] = kv.ChangeEvent{
+			Revision:  row.Revision,
+			Namespace: row.Namespace,
+			Key:       row.Key,
+			Op:        kv.ChangeOp(row.Op),
+			ChangedAt: time.UnixMilli(row.ChangedAt),
+		}
+		if row.OldVal.Valid {
+			oldVal := row.OldVal.String
+			changes[i].OldVal = &oldVal
+		}
+		if row.NewVal.Valid {
+			newVal := row.NewVal.String
+			changes[i].NewVal = &newVal
+		}
+	}
+	return changes, nil
+}
@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/inner-daydream/kvz/internal/kv"
+	"github.com/mattn/go-sqlite3"
+)
+
+// keyError translates a missing row into kv.ErrKeyNotFound.
+func keyError(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return kv.ErrKeyNotFound
+	}
+	return err
+}
+
+// isConstraint reports whether err is the violation of a unique or primary
+// key constraint.
+func isConstraint(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+		sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// searchError translates the missing search index of a sqlite built without
+// FTS5 into kv.ErrSearchUnavailable.
+func searchError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), "no such table: kv_search") || strings.Contains(err.Error(), "no such module: fts5") {
+		return fmt.Errorf("%w: kvz was built without FTS5", kv.ErrSearchUnavailable)
+	}
+	return err
+}
@@ -11,61 +11,209 @@ import (
 )
 
 const attachHook = `-- name: attachHook :exec
-INSERT INTO key_hooks ("key", hook)
-VALUES (?, ?)
+INSERT INTO key_hooks (namespace, "key", hook, events)
+VALUES (?, ?, ?, ?)
 `
 
 type attachHookParams struct {
-	Key  string
-	Hook string
+	Namespace string
+	Key       string
+	Hook      string
+	Events    string
 }
 
 func (q *Queries) attachHook(ctx context.Context, arg attachHookParams) error {
-	_, err := q.db.ExecContext(ctx, attachHook, arg.Key, arg.Hook)
+	_, err := q.db.ExecContext(ctx, attachHook, arg.Namespace, arg.Key, arg.Hook, arg.Events)
 	return err
 }
 
 const deleteHook = `-- name: deleteHook :exec
 DELETE FROM hooks
-where name = ?
+where namespace = ? AND name = ?
 `
 
-func (q *Queries) deleteHook(ctx context.Context, name string) error {
-	_, err := q.db.ExecContext(ctx, deleteHook, name)
+type deleteHookParams struct {
+	Namespace string
+	Name      string
+}
+
+func (q *Queries) deleteHook(ctx context.Context, arg deleteHookParams) error {
+	_, err := q.db.ExecContext(ctx, deleteHook, arg.Namespace, arg.Name)
 	return err
 }
 
 const deleteKey = `-- name: deleteKey :exec
 DELETE FROM kv
-WHERE "key" = ?
+WHERE namespace = ? AND "key" = ?
 `
 
-func (q *Queries) deleteKey(ctx context.Context, key string) error {
-	_, err := q.db.ExecContext(ctx, deleteKey, key)
+type deleteKeyParams struct {
+	Namespace string
+	Key       string
+}
+
+func (q *Queries) deleteKey(ctx context.Context, arg deleteKeyParams) error {
+	_, err := q.db.ExecContext(ctx, deleteKey, arg.Namespace, arg.Key)
 	return err
 }
 
+const detachAllHooks = `-- name: detachAllHooks :execrows
+DELETE FROM key_hooks
+WHERE namespace = ? AND "key" = ?
+`
+
+type detachAllHooksParams struct {
+	Namespace string
+	Key       string
+}
+
+func (q *Queries) detachAllHooks(ctx context.Context, arg detachAllHooksParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, detachAllHooks, arg.Namespace, arg.Key)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const detachHook = `-- name: detachHook :execrows
+DELETE FROM key_hooks
+WHERE namespace = ? AND "key" = ? AND hook = ?
+`
+
+type detachHookParams struct {
+	Namespace string
+	Key       string
+	Hook      string
+}
+
+func (q *Queries) detachHook(ctx context.Context, arg detachHookParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, detachHook, arg.Namespace, arg.Key, arg.Hook)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAttachedHooks = `-- name: getAttachedHooks :many
-SELECT h.name, h.script, h.is_file, h.filepath
+SELECT h.name, h.script, h.is_file, h.filepath, h.timeout_ms
+FROM key_hooks kh
+JOIN hooks h ON kh.namespace = h.namespace AND kh.hook = h.name
+WHERE kh.namespace = ? AND kh.key = ?
+`
+
+type getAttachedHooksParams struct {
+	Namespace string
+	Key       string
+}
+
+type getAttachedHooksRow struct {
+	Name      string
+	Script    sql.NullString
+	IsFile    bool
+	Filepath  sql.NullString
+	TimeoutMs int64
+}
+
+func (q *Queries) getAttachedHooks(ctx context.Context, arg getAttachedHooksParams) ([]getAttachedHooksRow, error) {
+	rows, err := q.db.QueryContext(ctx, getAttachedHooks, arg.Namespace, arg.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []getAttachedHooksRow
+	for rows.Next() {
+		var i getAttachedHooksRow
+		if err := rows.Scan(
+			&i.Name,
+			&i.Script,
+			&i.IsFile,
+			&i.Filepath,
+			&i.TimeoutMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHookKeys = `-- name: getHookKeys :many
+SELECT "key" FROM key_hooks
+WHERE namespace = ? AND hook = ?
+ORDER BY "key"
+`
+
+type getHookKeysParams struct {
+	Namespace string
+	Hook      string
+}
+
+func (q *Queries) getHookKeys(ctx context.Context, arg getHookKeysParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getHookKeys, arg.Namespace, arg.Hook)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getHooksForEvent = `-- name: getHooksForEvent :many
+SELECT h.name, h.script, h.is_file, h.filepath, h.timeout_ms
 FROM key_hooks kh
-JOIN hooks h ON kh.hook = h.name
-WHERE kh.key = ?
+JOIN hooks h ON kh.namespace = h.namespace AND kh.hook = h.name
+WHERE kh.namespace = ? AND kh.key = ?
+  AND (',' || kh.events || ',') LIKE ('%,' || ? || ',%')
 `
 
-func (q *Queries) getAttachedHooks(ctx context.Context, key string) ([]Hook, error) {
-	rows, err := q.db.QueryContext(ctx, getAttachedHooks, key)
+type getHooksForEventParams struct {
+	Namespace string
+	Key       string
+	Event     string
+}
+
+type getHooksForEventRow struct {
+	Name      string
+	Script    sql.NullString
+	IsFile    bool
+	Filepath  sql.NullString
+	TimeoutMs int64
+}
+
+func (q *Queries) getHooksForEvent(ctx context.Context, arg getHooksForEventParams) ([]getHooksForEventRow, error) {
+	rows, err := q.db.QueryContext(ctx, getHooksForEvent, arg.Namespace, arg.Key, arg.Event)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Hook
+	var items []getHooksForEventRow
 	for rows.Next() {
-		var i Hook
+		var i getHooksForEventRow
 		if err := rows.Scan(
 			&i.Name,
 			&i.Script,
 			&i.IsFile,
 			&i.Filepath,
+			&i.TimeoutMs,
 		); err != nil {
 			return nil, err
 		}
@@ -83,11 +231,17 @@ func (q *Queries) getAttachedHooks(ctx context.Context, key string) ([]Hook, err
 const getVal = `-- name: getVal :one
 SELECT val
 FROM kv
-WHERE "key" = ?
+WHERE namespace = ? AND "key" = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
 `
 
-func (q *Queries) getVal(ctx context.Context, key string) (string, error) {
-	row := q.db.QueryRowContext(ctx, getVal, key)
+type getValParams struct {
+	Namespace string
+	Key       string
+}
+
+func (q *Queries) getVal(ctx context.Context, arg getValParams) (string, error) {
+	row := q.db.QueryRowContext(ctx, getVal, arg.Namespace, arg.Key)
 	var val string
 	err := row.Scan(&val)
 	return val, err
@@ -97,12 +251,17 @@ const hookExists = `-- name: hookExists :one
 SELECT EXISTS(
     SELECT 1
     FROM hooks
-    WHERE name=?
+    WHERE namespace = ? AND name=?
 )
 `
 
-func (q *Queries) hookExists(ctx context.Context, name string) (int64, error) {
-	row := q.db.QueryRowContext(ctx, hookExists, name)
+type hookExistsParams struct {
+	Namespace string
+	Name      string
+}
+
+func (q *Queries) hookExists(ctx context.Context, arg hookExistsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, hookExists, arg.Namespace, arg.Name)
 	var column_1 int64
 	err := row.Scan(&column_1)
 	return column_1, err
@@ -112,12 +271,18 @@ const keyExists = `-- name: keyExists :one
 SELECT EXISTS(
     SELECT 1 
     FROM kv 
-    WHERE "key"=?
+    WHERE namespace = ? AND "key"=?
+      AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
 )
 `
 
-func (q *Queries) keyExists(ctx context.Context, key string) (int64, error) {
-	row := q.db.QueryRowContext(ctx, keyExists, key)
+type keyExistsParams struct {
+	Namespace string
+	Key       string
+}
+
+func (q *Queries) keyExists(ctx context.Context, arg keyExistsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, keyExists, arg.Namespace, arg.Key)
 	var column_1 int64
 	err := row.Scan(&column_1)
 	return column_1, err
@@ -125,10 +290,55 @@ func (q *Queries) keyExists(ctx context.Context, key string) (int64, error) {
 
 const listHooks = `-- name: listHooks :many
 SELECT name FROM hooks
+WHERE namespace = ?
+ORDER BY name
 `
 
-func (q *Queries) listHooks(ctx context.Context) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, listHooks)
+func (q *Queries) listHooks(ctx context.Context, namespace string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listHooks, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		items = append(items, name)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHooksPage = `-- name: listHooksPage :many
+SELECT name FROM hooks
+WHERE namespace = ?
+  AND name > ?
+  AND name GLOB ?
+  AND name GLOB ?
+  AND name REGEXP ?
+ORDER BY name
+LIMIT ?
+`
+
+type listHooksPageParams struct {
+	Namespace string
+	Cursor    string
+	Prefix    string
+	Pattern   string
+	Regex     string
+	PageSize  int64
+}
+
+func (q *Queries) listHooksPage(ctx context.Context, arg listHooksPageParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listHooksPage, arg.Namespace, arg.Cursor, arg.Prefix, arg.Pattern, arg.Regex, arg.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -152,10 +362,65 @@ func (q *Queries) listHooks(ctx context.Context) ([]string, error) {
 
 const listKeys = `-- name: listKeys :many
 SELECT "key" FROM kv
+WHERE namespace = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY "key"
+`
+
+func (q *Queries) listKeys(ctx context.Context, namespace string) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listKeys, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		items = append(items, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listKeysPage = `-- name: listKeysPage :many
+SELECT "key" FROM kv
+WHERE namespace = ?
+  AND "key" > ?
+  AND "key" GLOB ?
+  AND "key" GLOB ?
+  AND "key" REGEXP ?
+  -- min_tag_matches is 0 when the listing is not filtered by tag
+  AND (
+    SELECT count(*)
+    FROM key_tags t
+    WHERE t.namespace = kv.namespace AND t."key" = kv."key" AND t.tag = ?
+  ) >= ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY "key"
+LIMIT ?
 `
 
-func (q *Queries) listKeys(ctx context.Context) ([]string, error) {
-	rows, err := q.db.QueryContext(ctx, listKeys)
+type listKeysPageParams struct {
+	Namespace     string
+	Cursor        string
+	Prefix        string
+	Pattern       string
+	Regex         string
+	Tag           string
+	MinTagMatches int64
+	PageSize      int64
+}
+
+func (q *Queries) listKeysPage(ctx context.Context, arg listKeysPageParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listKeysPage, arg.Namespace, arg.Cursor, arg.Prefix, arg.Pattern, arg.Regex, arg.Tag, arg.MinTagMatches, arg.PageSize)
 	if err != nil {
 		return nil, err
 	}
@@ -178,61 +443,107 @@ func (q *Queries) listKeys(ctx context.Context) ([]string, error) {
 }
 
 const setFileHook = `-- name: setFileHook :exec
-INSERT OR REPLACE INTO hooks (name, script, is_file)
-VALUES (?, ?, TRUE)
+INSERT INTO hooks (namespace, name, script, is_file)
+VALUES (?, ?, ?, TRUE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file
 `
 
 type setFileHookParams struct {
-	Name   string
-	Script sql.NullString
+	Namespace string
+	Name      string
+	Script    sql.NullString
 }
 
 func (q *Queries) setFileHook(ctx context.Context, arg setFileHookParams) error {
-	_, err := q.db.ExecContext(ctx, setFileHook, arg.Name, arg.Script)
+	_, err := q.db.ExecContext(ctx, setFileHook, arg.Namespace, arg.Name, arg.Script)
 	return err
 }
 
 const setFilePathHook = `-- name: setFilePathHook :exec
-INSERT OR REPLACE INTO hooks (name, filepath, is_file)
-VALUES (?, ?, TRUE)
+INSERT INTO hooks (namespace, name, filepath, is_file)
+VALUES (?, ?, ?, TRUE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file
 `
 
 type setFilePathHookParams struct {
-	Name     string
-	Filepath sql.NullString
+	Namespace string
+	Name      string
+	Filepath  sql.NullString
 }
 
 func (q *Queries) setFilePathHook(ctx context.Context, arg setFilePathHookParams) error {
-	_, err := q.db.ExecContext(ctx, setFilePathHook, arg.Name, arg.Filepath)
+	_, err := q.db.ExecContext(ctx, setFilePathHook, arg.Namespace, arg.Name, arg.Filepath)
 	return err
 }
 
+const setHookTimeout = `-- name: setHookTimeout :execrows
+UPDATE hooks
+SET timeout_ms = ?
+WHERE namespace = ? AND name = ?
+`
+
+type setHookTimeoutParams struct {
+	TimeoutMs int64
+	Namespace string
+	Name      string
+}
+
+func (q *Queries) setHookTimeout(ctx context.Context, arg setHookTimeoutParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setHookTimeout, arg.TimeoutMs, arg.Namespace, arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const setScriptHook = `-- name: setScriptHook :exec
-INSERT OR REPLACE INTO hooks (name, script, is_file)
-VALUES (?, ?, FALSE)
+INSERT INTO hooks (namespace, name, script, is_file)
+VALUES (?, ?, ?, FALSE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file
 `
 
 type setScriptHookParams struct {
-	Name   string
-	Script sql.NullString
+	Namespace string
+	Name      string
+	Script    sql.NullString
 }
 
 func (q *Queries) setScriptHook(ctx context.Context, arg setScriptHookParams) error {
-	_, err := q.db.ExecContext(ctx, setScriptHook, arg.Name, arg.Script)
+	_, err := q.db.ExecContext(ctx, setScriptHook, arg.Namespace, arg.Name, arg.Script)
 	return err
 }
 
 const setVal = `-- name: setVal :exec
-INSERT OR REPLACE INTO kv ("key", val)
-VALUES (?, ?)
+INSERT INTO kv (namespace, "key", val, expires_at, secret)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (namespace, "key") DO UPDATE
+SET val = excluded.val,
+    expires_at = excluded.expires_at,
+    secret = excluded.secret,
+    version = CASE
+        WHEN kv.expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER) THEN 1
+        ELSE kv.version + 1
+    END
 `
 
 type setValParams struct {
-	Key string
-	Val string
+	Namespace string
+	Key       string
+	Val       string
+	ExpiresAt sql.NullInt64
+	Secret    bool
 }
 
 func (q *Queries) setVal(ctx context.Context, arg setValParams) error {
-	_, err := q.db.ExecContext(ctx, setVal, arg.Key, arg.Val)
+	_, err := q.db.ExecContext(ctx, setVal, arg.Namespace, arg.Key, arg.Val, arg.ExpiresAt, arg.Secret)
 	return err
 }
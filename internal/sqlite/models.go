@@ -8,19 +8,156 @@ import (
 	"database/sql"
 )
 
+type AuditLog struct {
+	ID        int64
+	At        int64
+	Namespace string
+	Action    string
+	Target    string
+	OldVal    sql.NullString
+	NewVal    sql.NullString
+	OsUser    string
+	Host      string
+	Pid       int64
+	Command   string
+}
+
 type Hook struct {
-	Name     string
-	Script   sql.NullString
-	IsFile   bool
-	Filepath sql.NullString
+	Namespace string
+	Name      string
+	Script    sql.NullString
+	IsFile    bool
+	Filepath  sql.NullString
+	TimeoutMs int64
 }
 
 type KeyHook struct {
-	Key  string
-	Hook string
+	Namespace string
+	Key       string
+	Hook      string
+	Events    string
+}
+
+type KeyTag struct {
+	Namespace string
+	Key       string
+	Tag       string
+}
+
+type KeyType struct {
+	Namespace string
+	Key       string
+	Type      string
 }
 
 type Kv struct {
-	Key string
-	Val string
+	Namespace   string
+	Key         string
+	Val         string
+	ExpiresAt   sql.NullInt64
+	Version     int64
+	Description string
+	Owner       string
+	CreatedAt   int64
+	UpdatedAt   int64
+	Secret      bool
+}
+
+type KvChange struct {
+	Revision  int64
+	Namespace string
+	Key       string
+	Op        string
+	OldVal    sql.NullString
+	NewVal    sql.NullString
+	ChangedAt int64
+}
+
+type KvHistory struct {
+	Revision  int64
+	Key       string
+	Val       sql.NullString
+	Deleted   bool
+	ChangedAt int64
+	Namespace string
+}
+
+type KvSearch struct {
+	Namespace   string
+	Key         string
+	Val         string
+	Description string
+	Owner       string
+	Tags        string
+}
+
+type Profile struct {
+	Name string
+}
+
+type ProfileHook struct {
+	Profile   string
+	Key       string
+	Namespace string
+	Hook      string
+	Events    string
+}
+
+type ProfileLayer struct {
+	Profile   string
+	Position  int64
+	Namespace string
+}
+
+type Schema struct {
+	Namespace string
+	Document  string
+}
+
+type Snapshot struct {
+	Name      string
+	CreatedAt int64
+}
+
+type SnapshotHook struct {
+	Snapshot  string
+	Namespace string
+	Name      string
+	Script    sql.NullString
+	IsFile    bool
+	Filepath  sql.NullString
+	TimeoutMs int64
+}
+
+type SnapshotKeyHook struct {
+	Snapshot  string
+	Namespace string
+	Key       string
+	Hook      string
+	Events    string
+}
+
+type SnapshotKeyTag struct {
+	Snapshot  string
+	Namespace string
+	Key       string
+	Tag       string
+}
+
+type SnapshotKeyType struct {
+	Snapshot  string
+	Namespace string
+	Key       string
+	Type      string
+}
+
+type SnapshotKv struct {
+	Snapshot    string
+	Namespace   string
+	Key         string
+	Val         string
+	ExpiresAt   sql.NullInt64
+	Description string
+	Owner       string
+	Secret      bool
 }
@@ -4,14 +4,58 @@ import (
 	"database/sql"
 	"embed"
 	"fmt"
+	"regexp"
+	"strings"
+	"sync"
 
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
 )
 
-func OpenDB(path string) (*sql.DB, error) {
+// driverName is the sqlite3 driver with the functions kvz queries rely on
+// registered and foreign keys enforced on every connection. Connections wait
+// for the locks held by other connections and processes instead of failing
+// right away.
+const driverName = "sqlite3_kvz"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if _, err := conn.Exec("PRAGMA foreign_keys = ON", nil); err != nil {
+				return err
+			}
+			if _, err := conn.Exec("PRAGMA busy_timeout = 5000", nil); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("regexp", regexpMatch, true)
+		},
+	})
+}
+
+var regexpCache sync.Map
+
+// regexpMatch implements the REGEXP operator, "x REGEXP y" calls regexp(y, x).
+func regexpMatch(pattern string, s string) (bool, error) {
+	cached, ok := regexpCache.Load(pattern)
+	if !ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, err
+		}
+		cached, _ = regexpCache.LoadOrStore(pattern, re)
+	}
+	return cached.(*regexp.Regexp).MatchString(s), nil
+}
 
-	db, err := sql.Open("sqlite3", path)
+// OpenDB opens the database at path. Transactions take the write lock when
+// they begin so the ones reading a key before writing it never fail midway
+// on a lock held by another process.
+func OpenDB(path string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open(driverName, path+separator+"_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open the database: %w", err)
 	}
@@ -26,12 +70,100 @@ func (m *SqliteMigrator) Migrate() error {
 	goose.SetLogger(goose.NopLogger())
 	goose.SetDialect("sqlite3")
 	goose.SetBaseFS(embedMigrations)
+	// foreign keys can only be toggled outside of a transaction and the
+	// migrations rebuild referenced tables, so they run on a single
+	// connection with foreign keys disabled
+	maxOpen := m.db.Stats().MaxOpenConnections
+	m.db.SetMaxOpenConns(1)
+	defer m.db.SetMaxOpenConns(maxOpen)
+	if _, err := m.db.Exec("PRAGMA foreign_keys = OFF"); err != nil {
+		return fmt.Errorf("unable to disable foreign keys: %w", err)
+	}
+	defer m.db.Exec("PRAGMA foreign_keys = ON")
 	if err := goose.Up(m.db, "sql/migrations"); err != nil {
 		return fmt.Errorf("migrations failed: %w", err)
 	}
+	var violations int
+	err := m.db.QueryRow("SELECT count(*) FROM pragma_foreign_key_check").Scan(&violations)
+	if err != nil {
+		return fmt.Errorf("unable to check foreign keys: %w", err)
+	}
+	if violations > 0 {
+		return fmt.Errorf("migrations left %d foreign key violations", violations)
+	}
+	if err := m.migrateSearch(); err != nil {
+		return fmt.Errorf("unable to migrate the search index: %w", err)
+	}
 	return nil
 }
 
+//go:embed sql/search/index.sql
+var searchIndex string
+
+// searchIndexVersion is the version of sql/search/index.sql, it is stored in
+// the user_version of the database once the index is built. Bump it when
+// the index or its triggers change so existing databases rebuild it.
+const searchIndexVersion = 2
+
+// searchTriggers maintain the search index, a database without all of them
+// has no index or a stale one.
+var searchTriggers = []string{
+	"kv_search_insert",
+	"kv_search_update",
+	"kv_search_delete",
+	"kv_search_tags_insert",
+	"kv_search_tags_update",
+	"kv_search_tags_delete",
+}
+
+// migrateSearch builds the search index when sqlite was compiled with FTS5
+// and it is missing or stale. Without FTS5 the triggers would fail every
+// write, they are dropped and the index is rebuilt by the next build that
+// has it.
+//
+// The index is not a goose migration: whether it can exist depends on the
+// build opening the database rather than on its schema version, and the same
+// file may be opened by builds with and without FTS5 in turn.
+func (m *SqliteMigrator) migrateSearch() error {
+	var fts5 bool
+	if err := m.db.QueryRow("SELECT sqlite_compileoption_used('ENABLE_FTS5')").Scan(&fts5); err != nil {
+		return err
+	}
+	var triggers int
+	err := m.db.QueryRow("SELECT count(*) FROM sqlite_schema WHERE type = 'trigger' AND name GLOB 'kv_search_*'").Scan(&triggers)
+	if err != nil {
+		return err
+	}
+	var version int
+	if err := m.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	switch {
+	case fts5 && (triggers < len(searchTriggers) || version != searchIndexVersion):
+		if _, err := tx.Exec(searchIndex); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", searchIndexVersion)); err != nil {
+			return err
+		}
+	case !fts5 && triggers > 0:
+		for _, trigger := range searchTriggers {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("PRAGMA user_version = 0"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
 type SqliteMigrator struct {
 	db *sql.DB
 }
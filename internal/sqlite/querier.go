@@ -9,19 +9,114 @@ import (
 )
 
 type Querier interface {
+	addProfileLayer(ctx context.Context, arg addProfileLayerParams) error
+	addTag(ctx context.Context, arg addTagParams) error
+	appendAudit(ctx context.Context, arg appendAuditParams) error
 	attachHook(ctx context.Context, arg attachHookParams) error
-	deleteHook(ctx context.Context, name string) error
-	deleteKey(ctx context.Context, key string) error
-	getAttachedHooks(ctx context.Context, key string) ([]Hook, error)
-	getVal(ctx context.Context, key string) (string, error)
-	hookExists(ctx context.Context, name string) (int64, error)
-	keyExists(ctx context.Context, key string) (int64, error)
-	listHooks(ctx context.Context) ([]string, error)
-	listKeys(ctx context.Context) ([]string, error)
+	attachProfileHook(ctx context.Context, arg attachProfileHookParams) error
+	copyKey(ctx context.Context, arg copyKeyParams) error
+	copyKeyHooks(ctx context.Context, arg copyKeyHooksParams) error
+	copyKeyTags(ctx context.Context, arg copyKeyTagsParams) error
+	copyKeyType(ctx context.Context, arg copyKeyTypeParams) error
+	createProfile(ctx context.Context, name string) error
+	createSnapshot(ctx context.Context, name string) error
+	deleteEmptyProfiles(ctx context.Context) error
+	deleteExpiredKey(ctx context.Context, arg deleteExpiredKeyParams) (int64, error)
+	deleteHook(ctx context.Context, arg deleteHookParams) error
+	deleteKey(ctx context.Context, arg deleteKeyParams) error
+	deleteKeyType(ctx context.Context, arg deleteKeyTypeParams) error
+	deleteNamespaceHooks(ctx context.Context, arg deleteNamespaceHooksParams) error
+	deleteNamespaceKeyHooks(ctx context.Context, arg deleteNamespaceKeyHooksParams) error
+	deleteNamespaceKeys(ctx context.Context, arg deleteNamespaceKeysParams) error
+	deleteNamespaceLayers(ctx context.Context, arg deleteNamespaceLayersParams) error
+	deleteNamespaceSchemas(ctx context.Context, arg deleteNamespaceSchemasParams) error
+	deleteNamespaceTypes(ctx context.Context, arg deleteNamespaceTypesParams) error
+	deleteProfile(ctx context.Context, name string) (int64, error)
+	deleteProfileLayers(ctx context.Context, profile string) error
+	deleteSchema(ctx context.Context, namespace string) (int64, error)
+	deleteSnapshot(ctx context.Context, name string) (int64, error)
+	detachAllHooks(ctx context.Context, arg detachAllHooksParams) (int64, error)
+	detachHook(ctx context.Context, arg detachHookParams) (int64, error)
+	detachProfileHook(ctx context.Context, arg detachProfileHookParams) (int64, error)
+	diffSnapshotHooks(ctx context.Context, snapshot string) ([]diffSnapshotHooksRow, error)
+	diffSnapshotKeys(ctx context.Context, snapshot string) ([]diffSnapshotKeysRow, error)
+	diffSnapshotSecrets(ctx context.Context, snapshot string) ([]diffSnapshotSecretsRow, error)
+	exportAttachments(ctx context.Context, namespace string) ([]exportAttachmentsRow, error)
+	exportHooks(ctx context.Context, namespace string) ([]exportHooksRow, error)
+	exportNamespace(ctx context.Context, arg exportNamespaceParams) ([]exportNamespaceRow, error)
+	getAttachedHooks(ctx context.Context, arg getAttachedHooksParams) ([]getAttachedHooksRow, error)
+	getHookKeys(ctx context.Context, arg getHookKeysParams) ([]string, error)
+	getHookProfileKeys(ctx context.Context, arg getHookProfileKeysParams) ([]getHookProfileKeysRow, error)
+	getHooksForEvent(ctx context.Context, arg getHooksForEventParams) ([]getHooksForEventRow, error)
+	getKeyInfo(ctx context.Context, arg getKeyInfoParams) (getKeyInfoRow, error)
+	getKeyType(ctx context.Context, arg getKeyTypeParams) (string, error)
+	getProfileHooksForEvent(ctx context.Context, arg getProfileHooksForEventParams) ([]getProfileHooksForEventRow, error)
+	getProfileLayers(ctx context.Context, profile string) ([]string, error)
+	getRevision(ctx context.Context, arg getRevisionParams) (KvHistory, error)
+	getRevisionAt(ctx context.Context, arg getRevisionAtParams) (KvHistory, error)
+	getSchema(ctx context.Context, namespace string) (string, error)
+	getVal(ctx context.Context, arg getValParams) (string, error)
+	getValWithVersion(ctx context.Context, arg getValWithVersionParams) (getValWithVersionRow, error)
+	hookExists(ctx context.Context, arg hookExistsParams) (int64, error)
+	isSecret(ctx context.Context, arg isSecretParams) (bool, error)
+	keyExists(ctx context.Context, arg keyExistsParams) (int64, error)
+	lastChange(ctx context.Context) (int64, error)
+	listChanges(ctx context.Context, arg listChangesParams) ([]KvChange, error)
+	listExpired(ctx context.Context) ([]listExpiredRow, error)
+	listHooks(ctx context.Context, namespace string) ([]string, error)
+	listHooksPage(ctx context.Context, arg listHooksPageParams) ([]string, error)
+	listKeys(ctx context.Context, namespace string) ([]string, error)
+	listKeysPage(ctx context.Context, arg listKeysPageParams) ([]string, error)
+	listNamespaces(ctx context.Context) ([]string, error)
+	listPlainVals(ctx context.Context, arg listPlainValsParams) ([]string, error)
+	listProfileLayers(ctx context.Context) ([]listProfileLayersRow, error)
+	listProfileLayersWith(ctx context.Context, layer string) ([]listProfileLayersWithRow, error)
+	listRevisions(ctx context.Context, arg listRevisionsParams) ([]KvHistory, error)
+	listSchemas(ctx context.Context) ([]Schema, error)
+	listSnapshots(ctx context.Context) ([]listSnapshotsRow, error)
+	listTags(ctx context.Context, arg listTagsParams) ([]string, error)
+	pruneChangesBefore(ctx context.Context, changedAt int64) (int64, error)
+	pruneChangesBeyond(ctx context.Context, offset int64) (int64, error)
+	pruneHistoryBefore(ctx context.Context, changedAt int64) (int64, error)
+	pruneHistoryBeyond(ctx context.Context, offset int64) (int64, error)
+	queryAudit(ctx context.Context, arg queryAuditParams) ([]AuditLog, error)
+	removeTag(ctx context.Context, arg removeTagParams) error
+	renameKey(ctx context.Context, arg renameKeyParams) error
+	renameKeyTags(ctx context.Context, arg renameKeyTagsParams) error
+	restoreAttachments(ctx context.Context, arg restoreAttachmentsParams) error
+	restoreDeleteAttachments(ctx context.Context, arg restoreDeleteAttachmentsParams) error
+	restoreDeleteHooks(ctx context.Context, snapshot string) error
+	restoreDeleteKeys(ctx context.Context, arg restoreDeleteKeysParams) error
+	restoreDeleteTags(ctx context.Context, arg restoreDeleteTagsParams) error
+	restoreDeleteTypes(ctx context.Context, arg restoreDeleteTypesParams) error
+	restoreHooks(ctx context.Context, snapshot string) error
+	restoreKeyHooks(ctx context.Context, arg restoreKeyHooksParams) error
+	restoreKeys(ctx context.Context, arg restoreKeysParams) error
+	restoreTags(ctx context.Context, arg restoreTagsParams) error
+	restoreTypes(ctx context.Context, arg restoreTypesParams) error
+	sealChangesNewVal(ctx context.Context, arg sealChangesNewValParams) error
+	sealChangesOldVal(ctx context.Context, arg sealChangesOldValParams) error
+	sealHistoryVal(ctx context.Context, arg sealHistoryValParams) error
+	sealSnapshotVal(ctx context.Context, arg sealSnapshotValParams) error
+	searchKeys(ctx context.Context, arg searchKeysParams) ([]searchKeysRow, error)
+	setDescription(ctx context.Context, arg setDescriptionParams) error
 	setFileHook(ctx context.Context, arg setFileHookParams) error
 	setFilePathHook(ctx context.Context, arg setFilePathHookParams) error
+	setHookTimeout(ctx context.Context, arg setHookTimeoutParams) (int64, error)
+	setKeyType(ctx context.Context, arg setKeyTypeParams) error
+	setOwner(ctx context.Context, arg setOwnerParams) error
+	setSchema(ctx context.Context, arg setSchemaParams) error
 	setScriptHook(ctx context.Context, arg setScriptHookParams) error
 	setVal(ctx context.Context, arg setValParams) error
+	setValIfAbsent(ctx context.Context, arg setValIfAbsentParams) (int64, error)
+	setValIfVersion(ctx context.Context, arg setValIfVersionParams) (int64, error)
+	snapshotAttachments(ctx context.Context, snapshot string) error
+	snapshotExists(ctx context.Context, name string) (int64, error)
+	snapshotHooks(ctx context.Context, snapshot string) error
+	snapshotKeyExists(ctx context.Context, arg snapshotKeyExistsParams) (int64, error)
+	snapshotKeys(ctx context.Context, snapshot string) error
+	snapshotTags(ctx context.Context, snapshot string) error
+	snapshotTypes(ctx context.Context, snapshot string) error
 }
 
 var _ Querier = (*Queries)(nil)
@@ -0,0 +1,45 @@
+-- +goose Up
+CREATE TABLE kv_history
+(
+    revision INTEGER PRIMARY KEY AUTOINCREMENT,
+    "key" TEXT NOT NULL,
+    val TEXT,
+    deleted BOOLEAN DEFAULT FALSE NOT NULL,
+    changed_at INTEGER NOT NULL
+);
+
+CREATE INDEX kv_history_key ON kv_history ("key", revision);
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_insert AFTER INSERT ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, changed_at)
+    VALUES (NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, changed_at)
+    VALUES (NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_delete AFTER DELETE ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, deleted, changed_at)
+    VALUES (OLD."key", NULL, TRUE, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+INSERT INTO kv_history ("key", val, changed_at)
+SELECT "key", val, CAST(unixepoch('subsec') * 1000 AS INTEGER)
+FROM kv;
+
+-- +goose Down
+DROP TRIGGER kv_history_insert;
+DROP TRIGGER kv_history_update;
+DROP TRIGGER kv_history_delete;
+DROP TABLE kv_history;
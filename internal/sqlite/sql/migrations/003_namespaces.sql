@@ -0,0 +1,145 @@
+-- +goose Up
+CREATE TABLE kv_ns
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    "key" TEXT NOT NULL,
+    val TEXT NOT NULL,
+    PRIMARY KEY (namespace, "key")
+);
+
+CREATE TABLE hooks_ns
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    name TEXT NOT NULL,
+    script TEXT,
+    is_file BOOLEAN DEFAULT FALSE NOT NULL,
+    filepath TEXT,
+    PRIMARY KEY (namespace, name)
+);
+
+CREATE TABLE key_hooks_ns
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    "key" TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    FOREIGN KEY (namespace, "key") REFERENCES kv (namespace, "key"),
+    FOREIGN KEY (namespace, hook) REFERENCES hooks (namespace, name)
+);
+
+INSERT INTO kv_ns ("key", val)
+SELECT "key", val FROM kv;
+
+INSERT INTO hooks_ns (name, script, is_file, filepath)
+SELECT name, script, is_file, filepath FROM hooks;
+
+INSERT INTO key_hooks_ns ("key", hook)
+SELECT "key", hook FROM key_hooks;
+
+DROP TRIGGER kv_history_insert;
+DROP TRIGGER kv_history_update;
+DROP TRIGGER kv_history_delete;
+DROP TABLE key_hooks;
+DROP TABLE kv;
+DROP TABLE hooks;
+ALTER TABLE kv_ns RENAME TO kv;
+ALTER TABLE hooks_ns RENAME TO hooks;
+ALTER TABLE key_hooks_ns RENAME TO key_hooks;
+
+ALTER TABLE kv_history ADD COLUMN namespace TEXT DEFAULT 'default' NOT NULL;
+DROP INDEX kv_history_key;
+CREATE INDEX kv_history_key ON kv_history (namespace, "key", revision);
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_insert AFTER INSERT ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_delete AFTER DELETE ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, deleted, changed_at)
+    VALUES (OLD.namespace, OLD."key", NULL, TRUE, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+CREATE TABLE kv_flat
+(
+    "key" TEXT PRIMARY KEY,
+    val TEXT NOT NULL
+);
+
+CREATE TABLE hooks_flat
+(
+    name TEXT PRIMARY KEY,
+    script TEXT,
+    is_file BOOLEAN DEFAULT FALSE NOT NULL,
+    filepath TEXT
+);
+
+CREATE TABLE key_hooks_flat
+(
+    "key" TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    FOREIGN KEY ("key") REFERENCES kv ("key"),
+    FOREIGN KEY (hook) REFERENCES hooks ("name")
+);
+
+INSERT INTO kv_flat ("key", val)
+SELECT "key", val FROM kv WHERE namespace = 'default';
+
+INSERT INTO hooks_flat (name, script, is_file, filepath)
+SELECT name, script, is_file, filepath FROM hooks WHERE namespace = 'default';
+
+INSERT INTO key_hooks_flat ("key", hook)
+SELECT "key", hook FROM key_hooks WHERE namespace = 'default';
+
+DROP TRIGGER kv_history_insert;
+DROP TRIGGER kv_history_update;
+DROP TRIGGER kv_history_delete;
+DROP TABLE key_hooks;
+DROP TABLE kv;
+DROP TABLE hooks;
+ALTER TABLE kv_flat RENAME TO kv;
+ALTER TABLE hooks_flat RENAME TO hooks;
+ALTER TABLE key_hooks_flat RENAME TO key_hooks;
+
+DELETE FROM kv_history WHERE namespace != 'default';
+DROP INDEX kv_history_key;
+ALTER TABLE kv_history DROP COLUMN namespace;
+CREATE INDEX kv_history_key ON kv_history ("key", revision);
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_insert AFTER INSERT ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, changed_at)
+    VALUES (NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, changed_at)
+    VALUES (NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_delete AFTER DELETE ON kv
+BEGIN
+    INSERT INTO kv_history ("key", val, deleted, changed_at)
+    VALUES (OLD."key", NULL, TRUE, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+CREATE TABLE key_types
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    "key" TEXT NOT NULL,
+    type TEXT DEFAULT 'string' NOT NULL,
+    PRIMARY KEY (namespace, "key")
+);
+
+-- +goose Down
+DROP TABLE key_types;
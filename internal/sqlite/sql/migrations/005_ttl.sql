@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE kv ADD COLUMN expires_at INTEGER;
+ALTER TABLE key_hooks ADD COLUMN events TEXT DEFAULT 'set' NOT NULL;
+
+CREATE INDEX kv_expires_at ON kv (expires_at) WHERE expires_at IS NOT NULL;
+
+-- +goose Down
+DROP INDEX kv_expires_at;
+ALTER TABLE key_hooks DROP COLUMN events;
+ALTER TABLE kv DROP COLUMN expires_at;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE kv ADD COLUMN version INTEGER DEFAULT 1 NOT NULL;
+
+-- +goose Down
+ALTER TABLE kv DROP COLUMN version;
@@ -0,0 +1,77 @@
+-- +goose Up
+ALTER TABLE kv ADD COLUMN description TEXT DEFAULT '' NOT NULL;
+ALTER TABLE kv ADD COLUMN owner TEXT DEFAULT '' NOT NULL;
+ALTER TABLE kv ADD COLUMN created_at INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE kv ADD COLUMN updated_at INTEGER DEFAULT 0 NOT NULL;
+
+CREATE TABLE key_tags
+(
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (namespace, "key", tag)
+);
+
+CREATE INDEX key_tags_tag ON key_tags (namespace, tag);
+
+-- only writes of the value are part of the history, metadata changes are not
+DROP TRIGGER kv_history_update;
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE OF val ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+UPDATE kv
+SET created_at = CAST(unixepoch('subsec') * 1000 AS INTEGER),
+    updated_at = CAST(unixepoch('subsec') * 1000 AS INTEGER);
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_timestamps_insert AFTER INSERT ON kv
+BEGIN
+    UPDATE kv
+    SET created_at = CAST(unixepoch('subsec') * 1000 AS INTEGER),
+        updated_at = CAST(unixepoch('subsec') * 1000 AS INTEGER)
+    WHERE namespace = NEW.namespace AND "key" = NEW."key";
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_timestamps_update AFTER UPDATE OF val ON kv
+BEGIN
+    UPDATE kv
+    SET updated_at = CAST(unixepoch('subsec') * 1000 AS INTEGER)
+    WHERE namespace = NEW.namespace AND "key" = NEW."key";
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_tags_delete AFTER DELETE ON kv
+BEGIN
+    DELETE FROM key_tags
+    WHERE namespace = OLD.namespace AND "key" = OLD."key";
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER kv_tags_delete;
+DROP TRIGGER kv_timestamps_update;
+DROP TRIGGER kv_timestamps_insert;
+DROP TRIGGER kv_history_update;
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+DROP TABLE key_tags;
+ALTER TABLE kv DROP COLUMN updated_at;
+ALTER TABLE kv DROP COLUMN created_at;
+ALTER TABLE kv DROP COLUMN owner;
+ALTER TABLE kv DROP COLUMN description;
@@ -0,0 +1,5 @@
+-- +goose Up
+ALTER TABLE kv ADD COLUMN secret BOOLEAN DEFAULT FALSE NOT NULL;
+
+-- +goose Down
+ALTER TABLE kv DROP COLUMN secret;
@@ -0,0 +1,46 @@
+-- +goose Up
+-- attachments are unique and follow the key or hook they reference,
+-- orphaned and duplicated attachments are dropped
+CREATE TABLE key_hooks_fk
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    "key" TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    events TEXT DEFAULT 'set' NOT NULL,
+    PRIMARY KEY (namespace, "key", hook),
+    FOREIGN KEY (namespace, "key") REFERENCES kv (namespace, "key")
+        ON UPDATE CASCADE ON DELETE CASCADE,
+    FOREIGN KEY (namespace, hook) REFERENCES hooks (namespace, name)
+        ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+INSERT OR IGNORE INTO key_hooks_fk (namespace, "key", hook, events)
+SELECT key_hooks.namespace, key_hooks."key", key_hooks.hook, key_hooks.events
+FROM key_hooks
+JOIN kv ON kv.namespace = key_hooks.namespace AND kv."key" = key_hooks."key"
+JOIN hooks ON hooks.namespace = key_hooks.namespace AND hooks.name = key_hooks.hook
+ORDER BY key_hooks.rowid;
+
+DROP TABLE key_hooks;
+ALTER TABLE key_hooks_fk RENAME TO key_hooks;
+
+CREATE INDEX key_hooks_hook ON key_hooks (namespace, hook);
+
+-- +goose Down
+DROP INDEX key_hooks_hook;
+
+CREATE TABLE key_hooks_nofk
+(
+    namespace TEXT DEFAULT 'default' NOT NULL,
+    "key" TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    events TEXT DEFAULT 'set' NOT NULL,
+    FOREIGN KEY (namespace, "key") REFERENCES kv (namespace, "key"),
+    FOREIGN KEY (namespace, hook) REFERENCES hooks (namespace, name)
+);
+
+INSERT INTO key_hooks_nofk (namespace, "key", hook, events)
+SELECT namespace, "key", hook, events FROM key_hooks;
+
+DROP TABLE key_hooks;
+ALTER TABLE key_hooks_nofk RENAME TO key_hooks;
@@ -0,0 +1,14 @@
+-- +goose Up
+-- a rename ends the history of the old key and starts the one of the new key
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_rename AFTER UPDATE OF "key" ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, deleted, changed_at)
+    VALUES (OLD.namespace, OLD."key", NULL, TRUE, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER kv_history_rename;
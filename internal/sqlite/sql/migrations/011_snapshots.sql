@@ -0,0 +1,73 @@
+-- +goose Up
+CREATE TABLE snapshots
+(
+    name TEXT PRIMARY KEY,
+    created_at INTEGER NOT NULL
+);
+
+-- the snapshot tables copy the rows of the store as they were, the values
+-- of secrets stay encrypted
+CREATE TABLE snapshot_kv
+(
+    snapshot TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    val TEXT NOT NULL,
+    expires_at INTEGER,
+    description TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    secret BOOLEAN NOT NULL,
+    PRIMARY KEY (snapshot, namespace, "key"),
+    FOREIGN KEY (snapshot) REFERENCES snapshots (name) ON DELETE CASCADE
+);
+
+CREATE TABLE snapshot_hooks
+(
+    snapshot TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    name TEXT NOT NULL,
+    script TEXT,
+    is_file BOOLEAN NOT NULL,
+    filepath TEXT,
+    PRIMARY KEY (snapshot, namespace, name),
+    FOREIGN KEY (snapshot) REFERENCES snapshots (name) ON DELETE CASCADE
+);
+
+CREATE TABLE snapshot_key_hooks
+(
+    snapshot TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    events TEXT NOT NULL,
+    PRIMARY KEY (snapshot, namespace, "key", hook),
+    FOREIGN KEY (snapshot) REFERENCES snapshots (name) ON DELETE CASCADE
+);
+
+CREATE TABLE snapshot_key_tags
+(
+    snapshot TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (snapshot, namespace, "key", tag),
+    FOREIGN KEY (snapshot) REFERENCES snapshots (name) ON DELETE CASCADE
+);
+
+CREATE TABLE snapshot_key_types
+(
+    snapshot TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    type TEXT NOT NULL,
+    PRIMARY KEY (snapshot, namespace, "key"),
+    FOREIGN KEY (snapshot) REFERENCES snapshots (name) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE snapshot_key_types;
+DROP TABLE snapshot_key_tags;
+DROP TABLE snapshot_key_hooks;
+DROP TABLE snapshot_hooks;
+DROP TABLE snapshot_kv;
+DROP TABLE snapshots;
@@ -0,0 +1,40 @@
+-- +goose Up
+CREATE TABLE profiles
+(
+    name TEXT PRIMARY KEY
+);
+
+-- the layers of a profile are namespaces, the base layer has position 0 and
+-- every following layer overrides the ones below it
+CREATE TABLE profile_layers
+(
+    profile TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    namespace TEXT NOT NULL,
+    PRIMARY KEY (profile, position),
+    UNIQUE (profile, namespace),
+    FOREIGN KEY (profile) REFERENCES profiles (name) ON DELETE CASCADE
+);
+
+CREATE INDEX profile_layers_namespace ON profile_layers (namespace);
+
+-- hooks attached to a key of a profile run when its effective value changes,
+-- whichever layer the change was made in
+CREATE TABLE profile_hooks
+(
+    profile TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    namespace TEXT NOT NULL,
+    hook TEXT NOT NULL,
+    events TEXT DEFAULT 'set' NOT NULL,
+    PRIMARY KEY (profile, "key", hook),
+    FOREIGN KEY (profile) REFERENCES profiles (name) ON DELETE CASCADE,
+    FOREIGN KEY (namespace, hook) REFERENCES hooks (namespace, name)
+        ON UPDATE CASCADE ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE profile_hooks;
+DROP INDEX profile_layers_namespace;
+DROP TABLE profile_layers;
+DROP TABLE profiles;
@@ -0,0 +1,10 @@
+-- +goose Up
+-- the schema of a namespace is a JSON document declaring its expected keys
+CREATE TABLE schemas
+(
+    namespace TEXT PRIMARY KEY,
+    document TEXT NOT NULL
+);
+
+-- +goose Down
+DROP TABLE schemas;
@@ -0,0 +1,59 @@
+-- +goose Up
+-- the change feed is filled by triggers so the writes of every process,
+-- kvz or not, are seen by the watchers
+CREATE TABLE kv_changes
+(
+    revision INTEGER PRIMARY KEY AUTOINCREMENT,
+    namespace TEXT NOT NULL,
+    "key" TEXT NOT NULL,
+    op TEXT NOT NULL,
+    old_val TEXT,
+    new_val TEXT,
+    changed_at INTEGER NOT NULL
+);
+
+CREATE INDEX kv_changes_key ON kv_changes (namespace, "key", revision);
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_changes_insert AFTER INSERT ON kv
+BEGIN
+    INSERT INTO kv_changes (namespace, "key", op, new_val, changed_at)
+    VALUES (NEW.namespace, NEW."key", 'create', NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_changes_update AFTER UPDATE OF val ON kv
+WHEN OLD.val IS NOT NEW.val AND OLD.namespace = NEW.namespace AND OLD."key" = NEW."key"
+BEGIN
+    INSERT INTO kv_changes (namespace, "key", op, old_val, new_val, changed_at)
+    VALUES (NEW.namespace, NEW."key", 'update', OLD.val, NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- a rename deletes the old key and creates the new one
+-- +goose StatementBegin
+CREATE TRIGGER kv_changes_rename AFTER UPDATE OF namespace, "key" ON kv
+WHEN OLD.namespace IS NOT NEW.namespace OR OLD."key" IS NOT NEW."key"
+BEGIN
+    INSERT INTO kv_changes (namespace, "key", op, old_val, changed_at)
+    VALUES (OLD.namespace, OLD."key", 'delete', OLD.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+    INSERT INTO kv_changes (namespace, "key", op, new_val, changed_at)
+    VALUES (NEW.namespace, NEW."key", 'create', NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_changes_delete AFTER DELETE ON kv
+BEGIN
+    INSERT INTO kv_changes (namespace, "key", op, old_val, changed_at)
+    VALUES (OLD.namespace, OLD."key", 'delete', OLD.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER kv_changes_delete;
+DROP TRIGGER kv_changes_rename;
+DROP TRIGGER kv_changes_update;
+DROP TRIGGER kv_changes_insert;
+DROP TABLE kv_changes;
@@ -0,0 +1,8 @@
+-- +goose Up
+-- the timeout of a hook in milliseconds, 0 when it has none
+ALTER TABLE hooks ADD COLUMN timeout_ms INTEGER DEFAULT 0 NOT NULL;
+ALTER TABLE snapshot_hooks ADD COLUMN timeout_ms INTEGER DEFAULT 0 NOT NULL;
+
+-- +goose Down
+ALTER TABLE snapshot_hooks DROP COLUMN timeout_ms;
+ALTER TABLE hooks DROP COLUMN timeout_ms;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- a rename rewrites the value of a secret for its new key, the revision of
+-- the new key is already recorded by kv_history_rename
+DROP TRIGGER kv_history_update;
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE OF val ON kv
+WHEN OLD.namespace = NEW.namespace AND OLD."key" = NEW."key"
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP TRIGGER kv_history_update;
+
+-- +goose StatementBegin
+CREATE TRIGGER kv_history_update AFTER UPDATE OF val ON kv
+BEGIN
+    INSERT INTO kv_history (namespace, "key", val, changed_at)
+    VALUES (NEW.namespace, NEW."key", NEW.val, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+END;
+-- +goose StatementEnd
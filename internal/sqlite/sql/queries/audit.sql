@@ -0,0 +1,14 @@
+-- name: appendAudit :exec
+INSERT INTO audit_log (at, namespace, action, target, old_val, new_val, os_user, host, pid, command)
+VALUES (CAST(unixepoch('subsec') * 1000 AS INTEGER), ?, ?, ?, ?, ?, ?, ?, ?, ?);
+
+-- name: queryAudit :many
+SELECT id, at, namespace, action, target, old_val, new_val, os_user, host, pid, command
+FROM audit_log
+WHERE namespace GLOB sqlc.arg(namespace)
+  AND target GLOB sqlc.arg(target)
+  AND os_user GLOB sqlc.arg(os_user)
+  AND at >= sqlc.arg(since)
+  AND at < sqlc.arg(until)
+ORDER BY id DESC
+LIMIT sqlc.arg(page_size);
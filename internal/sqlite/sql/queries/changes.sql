@@ -0,0 +1,20 @@
+-- name: lastChange :one
+SELECT CAST(coalesce(max(revision), 0) AS INTEGER) AS revision
+FROM kv_changes;
+
+-- name: listChanges :many
+SELECT revision, namespace, "key", op, old_val, new_val, changed_at
+FROM kv_changes
+WHERE revision > sqlc.arg(after)
+  AND namespace = sqlc.arg(namespace)
+  AND "key" GLOB sqlc.arg(prefix)
+ORDER BY revision
+LIMIT sqlc.arg(page_size);
+
+-- name: pruneChangesBefore :execrows
+DELETE FROM kv_changes
+WHERE changed_at < ?;
+
+-- name: pruneChangesBeyond :execrows
+DELETE FROM kv_changes
+WHERE revision < (SELECT revision FROM kv_changes ORDER BY revision DESC LIMIT 1 OFFSET ?);
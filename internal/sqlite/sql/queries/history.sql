@@ -0,0 +1,67 @@
+-- name: listRevisions :many
+SELECT revision, "key", val, deleted, changed_at, namespace
+FROM kv_history
+WHERE namespace = ? AND "key" = ?
+ORDER BY revision;
+
+-- name: getRevision :one
+SELECT revision, "key", val, deleted, changed_at, namespace
+FROM kv_history
+WHERE namespace = ? AND "key" = ? AND revision = ?;
+
+-- name: getRevisionAt :one
+SELECT revision, "key", val, deleted, changed_at, namespace
+FROM kv_history
+WHERE namespace = ? AND "key" = ? AND changed_at <= ?
+ORDER BY revision DESC
+LIMIT 1;
+
+-- name: listPlainVals :many
+SELECT val FROM kv_history
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)
+  AND val IS NOT NULL AND val NOT GLOB 'kvzenc:*'
+UNION
+SELECT old_val FROM kv_changes
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)
+  AND old_val IS NOT NULL AND old_val NOT GLOB 'kvzenc:*'
+UNION
+SELECT new_val FROM kv_changes
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)
+  AND new_val IS NOT NULL AND new_val NOT GLOB 'kvzenc:*'
+UNION
+SELECT val FROM snapshot_kv
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)
+  AND val NOT GLOB 'kvzenc:*';
+
+-- name: sealHistoryVal :exec
+UPDATE kv_history
+SET val = sqlc.arg(encrypted)
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key) AND val = sqlc.arg(val);
+
+-- name: sealChangesOldVal :exec
+UPDATE kv_changes
+SET old_val = sqlc.arg(encrypted)
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key) AND old_val = sqlc.arg(val);
+
+-- name: sealChangesNewVal :exec
+UPDATE kv_changes
+SET new_val = sqlc.arg(encrypted)
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key) AND new_val = sqlc.arg(val);
+
+-- name: sealSnapshotVal :exec
+UPDATE snapshot_kv
+SET val = sqlc.arg(encrypted), secret = TRUE
+WHERE namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key) AND val = sqlc.arg(val);
+
+-- name: pruneHistoryBefore :execrows
+DELETE FROM kv_history
+WHERE changed_at < ?
+  AND revision < (SELECT max(h.revision) FROM kv_history h
+                  WHERE h.namespace = kv_history.namespace AND h."key" = kv_history."key");
+
+-- name: pruneHistoryBeyond :execrows
+DELETE FROM kv_history
+WHERE revision < (SELECT h.revision FROM kv_history h
+                  WHERE h.namespace = kv_history.namespace AND h."key" = kv_history."key"
+                  ORDER BY h.revision DESC
+                  LIMIT 1 OFFSET ?);
@@ -1,58 +1,137 @@
 -- name: getVal :one
 SELECT val
 FROM kv
-WHERE "key" = ?;
+WHERE namespace = ? AND "key" = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER));
 
 -- name: setVal :exec
-INSERT OR REPLACE INTO kv ("key", val)
-VALUES (?, ?);
+INSERT INTO kv (namespace, "key", val, expires_at, secret)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (namespace, "key") DO UPDATE
+SET val = excluded.val,
+    expires_at = excluded.expires_at,
+    secret = excluded.secret,
+    version = CASE
+        WHEN kv.expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER) THEN 1
+        ELSE kv.version + 1
+    END;
 
 -- name: deleteKey :exec
 DELETE FROM kv
-WHERE "key" = ?;
+WHERE namespace = ? AND "key" = ?;
 
 -- name: listKeys :many
-SELECT "key" FROM kv;
+SELECT "key" FROM kv
+WHERE namespace = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY "key";
 
 -- name: setScriptHook :exec
-INSERT OR REPLACE INTO hooks (name, script, is_file)
-VALUES (?, ?, FALSE);
+INSERT INTO hooks (namespace, name, script, is_file)
+VALUES (?, ?, ?, FALSE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file;
 
 -- name: setFilePathHook :exec 
-INSERT OR REPLACE INTO hooks (name, filepath, is_file)
-VALUES (?, ?, TRUE);
+INSERT INTO hooks (namespace, name, filepath, is_file)
+VALUES (?, ?, ?, TRUE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file;
 
 -- name: setFileHook :exec
-INSERT OR REPLACE INTO hooks (name, script, is_file)
-VALUES (?, ?, TRUE);
+INSERT INTO hooks (namespace, name, script, is_file)
+VALUES (?, ?, ?, TRUE)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    filepath = excluded.filepath,
+    is_file = excluded.is_file;
 
 -- name: attachHook :exec
-INSERT INTO key_hooks ("key", hook)
-VALUES (?, ?);
+INSERT INTO key_hooks (namespace, "key", hook, events)
+VALUES (?, ?, ?, ?);
+
+-- name: setHookTimeout :execrows
+UPDATE hooks
+SET timeout_ms = ?
+WHERE namespace = ? AND name = ?;
 
 -- name: deleteHook :exec
 DELETE FROM hooks
-where name = ?;
+where namespace = ? AND name = ?;
 
 -- name: listHooks :many
-SELECT name FROM hooks;
+SELECT name FROM hooks
+WHERE namespace = ?
+ORDER BY name;
 
 -- name: keyExists :one
 SELECT EXISTS(
     SELECT 1 
     FROM kv 
-    WHERE "key"=?
+    WHERE namespace = ? AND "key"=?
+      AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
 );
 
 -- name: hookExists :one
 SELECT EXISTS(
     SELECT 1
     FROM hooks
-    WHERE name=?
+    WHERE namespace = ? AND name=?
 );
 
 -- name: getAttachedHooks :many
-SELECT h.name, h.script, h.is_file, h.filepath
+SELECT h.name, h.script, h.is_file, h.filepath, h.timeout_ms
+FROM key_hooks kh
+JOIN hooks h ON kh.namespace = h.namespace AND kh.hook = h.name
+WHERE kh.namespace = ? AND kh.key = ?;
+
+-- name: getHooksForEvent :many
+SELECT h.name, h.script, h.is_file, h.filepath, h.timeout_ms
 FROM key_hooks kh
-JOIN hooks h ON kh.hook = h.name
-WHERE kh.key = ?;
+JOIN hooks h ON kh.namespace = h.namespace AND kh.hook = h.name
+WHERE kh.namespace = ? AND kh.key = ?
+  AND (',' || kh.events || ',') LIKE ('%,' || sqlc.arg(event) || ',%');
+
+-- name: listKeysPage :many
+SELECT "key" FROM kv
+WHERE namespace = sqlc.arg(namespace)
+  AND "key" > sqlc.arg(cursor)
+  AND "key" GLOB sqlc.arg(prefix)
+  AND "key" GLOB sqlc.arg(pattern)
+  AND "key" REGEXP sqlc.arg(regex)
+  -- min_tag_matches is 0 when the listing is not filtered by tag
+  AND (
+    SELECT count(*)
+    FROM key_tags t
+    WHERE t.namespace = kv.namespace AND t."key" = kv."key" AND t.tag = sqlc.arg(tag)
+  ) >= sqlc.arg(min_tag_matches)
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY "key"
+LIMIT sqlc.arg(page_size);
+
+-- name: listHooksPage :many
+SELECT name FROM hooks
+WHERE namespace = sqlc.arg(namespace)
+  AND name > sqlc.arg(cursor)
+  AND name GLOB sqlc.arg(prefix)
+  AND name GLOB sqlc.arg(pattern)
+  AND name REGEXP sqlc.arg(regex)
+ORDER BY name
+LIMIT sqlc.arg(page_size);
+
+-- name: getHookKeys :many
+SELECT "key" FROM key_hooks
+WHERE namespace = ? AND hook = ?
+ORDER BY "key";
+
+-- name: detachHook :execrows
+DELETE FROM key_hooks
+WHERE namespace = ? AND "key" = ? AND hook = ?;
+
+-- name: detachAllHooks :execrows
+DELETE FROM key_hooks
+WHERE namespace = ? AND "key" = ?;
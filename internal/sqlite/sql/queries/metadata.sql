@@ -0,0 +1,34 @@
+-- name: getKeyInfo :one
+SELECT namespace, "key", val, expires_at, version, description, owner, created_at, updated_at, secret
+FROM kv
+WHERE namespace = ? AND "key" = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER));
+
+-- name: setDescription :exec
+UPDATE kv
+SET description = ?
+WHERE namespace = ? AND "key" = ?;
+
+-- name: setOwner :exec
+UPDATE kv
+SET owner = ?
+WHERE namespace = ? AND "key" = ?;
+
+-- name: addTag :exec
+INSERT OR IGNORE INTO key_tags (namespace, "key", tag)
+VALUES (?, ?, ?);
+
+-- name: removeTag :exec
+DELETE FROM key_tags
+WHERE namespace = ? AND "key" = ? AND tag = ?;
+
+-- name: listTags :many
+SELECT tag
+FROM key_tags
+WHERE namespace = ? AND "key" = ?
+ORDER BY tag;
+
+-- name: isSecret :one
+SELECT secret
+FROM kv
+WHERE namespace = ? AND "key" = ?;
@@ -0,0 +1,44 @@
+-- name: listNamespaces :many
+SELECT namespace FROM kv
+UNION
+SELECT namespace FROM hooks
+ORDER BY namespace;
+
+-- name: exportNamespace :many
+SELECT namespace, "key", val, secret
+FROM kv
+WHERE (namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children))
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY namespace, "key";
+
+-- name: deleteNamespaceKeyHooks :exec
+DELETE FROM key_hooks
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteNamespaceKeys :exec
+DELETE FROM kv
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteNamespaceHooks :exec
+DELETE FROM hooks
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteNamespaceTypes :exec
+DELETE FROM key_types
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteNamespaceSchemas :exec
+DELETE FROM schemas
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteNamespaceLayers :exec
+DELETE FROM profile_layers
+WHERE namespace = sqlc.arg(namespace) OR namespace GLOB sqlc.arg(children);
+
+-- name: deleteEmptyProfiles :exec
+DELETE FROM profiles
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM profile_layers l
+    WHERE l.profile = profiles.name
+);
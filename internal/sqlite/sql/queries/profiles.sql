@@ -0,0 +1,52 @@
+-- name: createProfile :exec
+INSERT INTO profiles (name) VALUES (?)
+ON CONFLICT (name) DO NOTHING;
+
+-- name: deleteProfileLayers :exec
+DELETE FROM profile_layers WHERE profile = ?;
+
+-- name: addProfileLayer :exec
+INSERT INTO profile_layers (profile, position, namespace)
+VALUES (?, ?, ?);
+
+-- name: getProfileLayers :many
+SELECT namespace FROM profile_layers
+WHERE profile = ?
+ORDER BY position;
+
+-- name: listProfileLayers :many
+SELECT p.name, l.namespace
+FROM profiles p
+JOIN profile_layers l ON l.profile = p.name
+ORDER BY p.name, l.position;
+
+-- name: listProfileLayersWith :many
+SELECT l.profile, l.namespace
+FROM profile_layers l
+WHERE l.profile IN (
+    SELECT profile FROM profile_layers WHERE namespace = sqlc.arg(layer)
+)
+ORDER BY l.profile, l.position;
+
+-- name: deleteProfile :execrows
+DELETE FROM profiles WHERE name = ?;
+
+-- name: attachProfileHook :exec
+INSERT INTO profile_hooks (profile, "key", namespace, hook, events)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: detachProfileHook :execrows
+DELETE FROM profile_hooks
+WHERE profile = ? AND "key" = ? AND hook = ?;
+
+-- name: getProfileHooksForEvent :many
+SELECT h.name, h.script, h.is_file, h.filepath, h.timeout_ms
+FROM profile_hooks ph
+JOIN hooks h ON ph.namespace = h.namespace AND ph.hook = h.name
+WHERE ph.profile = ? AND ph."key" = ?
+  AND (',' || ph.events || ',') LIKE ('%,' || sqlc.arg(event) || ',%');
+
+-- name: getHookProfileKeys :many
+SELECT profile, "key" FROM profile_hooks
+WHERE namespace = ? AND hook = ?
+ORDER BY profile, "key";
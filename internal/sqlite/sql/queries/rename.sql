@@ -0,0 +1,38 @@
+-- name: renameKey :exec
+UPDATE kv
+SET "key" = sqlc.arg(new_key), val = sqlc.arg(val)
+WHERE namespace = ? AND "key" = ?;
+
+-- name: renameKeyTags :exec
+UPDATE key_tags
+SET "key" = sqlc.arg(new_key)
+WHERE namespace = ? AND "key" = ?;
+
+-- name: deleteKeyType :exec
+DELETE FROM key_types
+WHERE namespace = ? AND "key" = ?;
+
+-- name: copyKey :exec
+INSERT INTO kv (namespace, "key", val, expires_at, secret, description, owner)
+SELECT namespace, sqlc.arg(new_key), sqlc.arg(val), expires_at, secret, description, owner
+FROM kv
+WHERE namespace = ? AND "key" = ?;
+
+-- name: copyKeyTags :exec
+INSERT INTO key_tags (namespace, "key", tag)
+SELECT namespace, sqlc.arg(new_key), tag
+FROM key_tags
+WHERE namespace = ? AND "key" = ?;
+
+-- name: copyKeyType :exec
+INSERT INTO key_types (namespace, "key", type)
+SELECT namespace, sqlc.arg(new_key), type
+FROM key_types
+WHERE namespace = ? AND "key" = ?
+ON CONFLICT (namespace, "key") DO NOTHING;
+
+-- name: copyKeyHooks :exec
+INSERT INTO key_hooks (namespace, "key", hook, events)
+SELECT namespace, sqlc.arg(new_key), hook, events
+FROM key_hooks
+WHERE namespace = ? AND "key" = ?;
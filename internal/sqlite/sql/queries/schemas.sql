@@ -0,0 +1,16 @@
+-- name: getSchema :one
+SELECT document FROM schemas
+WHERE namespace = ?;
+
+-- name: setSchema :exec
+INSERT INTO schemas (namespace, document)
+VALUES (?, ?)
+ON CONFLICT (namespace) DO UPDATE SET document = excluded.document;
+
+-- name: deleteSchema :execrows
+DELETE FROM schemas
+WHERE namespace = ?;
+
+-- name: listSchemas :many
+SELECT namespace, document FROM schemas
+ORDER BY namespace;
@@ -0,0 +1,11 @@
+-- name: searchKeys :many
+SELECT kv_search."key",
+       snippet(kv_search, -1, '[', ']', '...', 12) AS snippet,
+       bm25(kv_search, 0.0, 4.0, 2.0, 1.0, 1.0, 1.0) AS rank
+FROM kv_search
+JOIN kv ON kv.rowid = kv_search.rowid
+WHERE kv_search MATCH sqlc.arg(query)
+  AND kv_search.namespace = sqlc.arg(namespace)
+  AND (kv.expires_at IS NULL OR kv.expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY rank, kv_search."key"
+LIMIT sqlc.arg(page_size);
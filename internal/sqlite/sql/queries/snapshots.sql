@@ -0,0 +1,217 @@
+-- name: createSnapshot :exec
+INSERT INTO snapshots (name, created_at)
+VALUES (?, CAST(unixepoch('subsec') * 1000 AS INTEGER));
+
+-- name: snapshotKeys :exec
+INSERT INTO snapshot_kv (snapshot, namespace, "key", val, expires_at, description, owner, secret)
+SELECT sqlc.arg(snapshot), namespace, "key", val, expires_at, description, owner, secret
+FROM kv;
+
+-- name: snapshotHooks :exec
+INSERT INTO snapshot_hooks (snapshot, namespace, name, script, is_file, filepath, timeout_ms)
+SELECT sqlc.arg(snapshot), namespace, name, script, is_file, filepath, timeout_ms
+FROM hooks;
+
+-- name: snapshotAttachments :exec
+INSERT INTO snapshot_key_hooks (snapshot, namespace, "key", hook, events)
+SELECT sqlc.arg(snapshot), namespace, "key", hook, events
+FROM key_hooks;
+
+-- name: snapshotTags :exec
+INSERT INTO snapshot_key_tags (snapshot, namespace, "key", tag)
+SELECT sqlc.arg(snapshot), namespace, "key", tag
+FROM key_tags;
+
+-- name: snapshotTypes :exec
+INSERT INTO snapshot_key_types (snapshot, namespace, "key", type)
+SELECT sqlc.arg(snapshot), namespace, "key", type
+FROM key_types;
+
+-- name: listSnapshots :many
+SELECT s.name, s.created_at, count(k."key") AS keys
+FROM snapshots s
+LEFT JOIN snapshot_kv k ON k.snapshot = s.name
+GROUP BY s.name
+ORDER BY s.created_at, s.name;
+
+-- name: snapshotExists :one
+SELECT EXISTS(
+    SELECT 1
+    FROM snapshots
+    WHERE name = ?
+);
+
+-- name: snapshotKeyExists :one
+SELECT EXISTS(
+    SELECT 1
+    FROM snapshot_kv
+    WHERE snapshot = ? AND namespace = ? AND "key" = ?
+);
+
+-- name: deleteSnapshot :execrows
+DELETE FROM snapshots
+WHERE name = ?;
+
+-- name: restoreDeleteKeys :exec
+DELETE FROM kv
+WHERE (sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)))
+  AND NOT EXISTS (
+    SELECT 1
+    FROM snapshot_kv s
+    WHERE s.snapshot = sqlc.arg(snapshot) AND s.namespace = kv.namespace AND s."key" = kv."key"
+);
+
+-- name: restoreKeys :exec
+INSERT INTO kv (namespace, "key", val, expires_at, description, owner, secret)
+SELECT namespace, "key", val, expires_at, description, owner, secret
+FROM snapshot_kv
+WHERE snapshot = sqlc.arg(snapshot)
+  AND (sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)))
+ON CONFLICT (namespace, "key") DO UPDATE
+SET val = excluded.val,
+    expires_at = excluded.expires_at,
+    description = excluded.description,
+    owner = excluded.owner,
+    secret = excluded.secret,
+    version = CASE
+        WHEN kv.expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER) THEN 1
+        ELSE kv.version + 1
+    END
+WHERE kv.val IS NOT excluded.val
+   OR kv.expires_at IS NOT excluded.expires_at
+   OR kv.description IS NOT excluded.description
+   OR kv.owner IS NOT excluded.owner
+   OR kv.secret IS NOT excluded.secret;
+
+-- name: restoreDeleteTags :exec
+DELETE FROM key_tags
+WHERE sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key));
+
+-- name: restoreTags :exec
+INSERT INTO key_tags (namespace, "key", tag)
+SELECT namespace, "key", tag
+FROM snapshot_key_tags
+WHERE snapshot = sqlc.arg(snapshot)
+  AND (sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)));
+
+-- name: restoreDeleteTypes :exec
+DELETE FROM key_types
+WHERE sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key));
+
+-- name: restoreTypes :exec
+INSERT INTO key_types (namespace, "key", type)
+SELECT namespace, "key", type
+FROM snapshot_key_types
+WHERE snapshot = sqlc.arg(snapshot)
+  AND (sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)));
+
+-- name: restoreDeleteHooks :exec
+DELETE FROM hooks
+WHERE NOT EXISTS (
+    SELECT 1
+    FROM snapshot_hooks s
+    WHERE s.snapshot = sqlc.arg(snapshot) AND s.namespace = hooks.namespace AND s.name = hooks.name
+);
+
+-- name: restoreHooks :exec
+INSERT INTO hooks (namespace, name, script, is_file, filepath, timeout_ms)
+SELECT namespace, name, script, is_file, filepath, timeout_ms
+FROM snapshot_hooks
+WHERE snapshot = sqlc.arg(snapshot)
+ON CONFLICT (namespace, name) DO UPDATE
+SET script = excluded.script,
+    is_file = excluded.is_file,
+    filepath = excluded.filepath,
+    timeout_ms = excluded.timeout_ms;
+
+-- name: restoreKeyHooks :exec
+INSERT INTO hooks (namespace, name, script, is_file, filepath, timeout_ms)
+SELECT h.namespace, h.name, h.script, h.is_file, h.filepath, h.timeout_ms
+FROM snapshot_hooks h
+JOIN snapshot_key_hooks kh ON kh.snapshot = h.snapshot AND kh.namespace = h.namespace AND kh.hook = h.name
+WHERE h.snapshot = sqlc.arg(snapshot) AND kh.namespace = sqlc.arg(namespace) AND kh."key" = sqlc.arg(key)
+ON CONFLICT (namespace, name) DO NOTHING;
+
+-- name: restoreDeleteAttachments :exec
+DELETE FROM key_hooks
+WHERE sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key));
+
+-- name: restoreAttachments :exec
+INSERT INTO key_hooks (namespace, "key", hook, events)
+SELECT namespace, "key", hook, events
+FROM snapshot_key_hooks
+WHERE snapshot = sqlc.arg(snapshot)
+  AND (sqlc.arg(whole_store) OR (namespace = sqlc.arg(namespace) AND "key" = sqlc.arg(key)));
+
+-- name: diffSnapshotKeys :many
+WITH
+snapshot_state AS (
+    SELECT k.namespace, k."key", json_array(
+        CASE WHEN k.secret THEN NULL ELSE k.val END, k.secret, k.expires_at, k.description, k.owner,
+        coalesce((SELECT t.type FROM snapshot_key_types t
+                  WHERE t.snapshot = k.snapshot AND t.namespace = k.namespace AND t."key" = k."key"), 'string'),
+        (SELECT json_group_array(t.tag ORDER BY t.tag) FROM snapshot_key_tags t
+         WHERE t.snapshot = k.snapshot AND t.namespace = k.namespace AND t."key" = k."key"),
+        (SELECT json_group_array(json_array(kh.hook, kh.events) ORDER BY kh.hook) FROM snapshot_key_hooks kh
+         WHERE kh.snapshot = k.snapshot AND kh.namespace = k.namespace AND kh."key" = k."key")
+    ) AS state
+    FROM snapshot_kv k
+    WHERE k.snapshot = sqlc.arg(snapshot)
+      AND (k.expires_at IS NULL OR k.expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+),
+current_state AS (
+    SELECT k.namespace, k."key", json_array(
+        CASE WHEN k.secret THEN NULL ELSE k.val END, k.secret, k.expires_at, k.description, k.owner,
+        coalesce((SELECT t.type FROM key_types t
+                  WHERE t.namespace = k.namespace AND t."key" = k."key"), 'string'),
+        (SELECT json_group_array(t.tag ORDER BY t.tag) FROM key_tags t
+         WHERE t.namespace = k.namespace AND t."key" = k."key"),
+        (SELECT json_group_array(json_array(kh.hook, kh.events) ORDER BY kh.hook) FROM key_hooks kh
+         WHERE kh.namespace = k.namespace AND kh."key" = k."key")
+    ) AS state
+    FROM kv k
+    WHERE k.expires_at IS NULL OR k.expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER)
+)
+SELECT CAST(coalesce(s.namespace, c.namespace) AS TEXT) AS namespace,
+       CAST(coalesce(s."key", c."key") AS TEXT) AS "key",
+       CAST(CASE
+           WHEN s."key" IS NULL THEN 'added'
+           WHEN c."key" IS NULL THEN 'removed'
+           ELSE 'changed'
+       END AS TEXT) AS kind
+FROM snapshot_state s
+FULL OUTER JOIN current_state c ON c.namespace = s.namespace AND c."key" = s."key"
+WHERE s.state IS NOT c.state
+ORDER BY 1, 2;
+
+-- name: diffSnapshotSecrets :many
+SELECT s.namespace, s."key", s.val AS snapshot_val, k.val
+FROM snapshot_kv s
+JOIN kv k ON k.namespace = s.namespace AND k."key" = s."key"
+WHERE s.snapshot = sqlc.arg(snapshot) AND s.secret AND k.secret AND s.val IS NOT k.val
+  AND (s.expires_at IS NULL OR s.expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+  AND (k.expires_at IS NULL OR k.expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER))
+ORDER BY s.namespace, s."key";
+
+-- name: diffSnapshotHooks :many
+WITH
+snapshot_state AS (
+    SELECT namespace, name, json_array(script, is_file, filepath, timeout_ms) AS state
+    FROM snapshot_hooks
+    WHERE snapshot = sqlc.arg(snapshot)
+),
+current_state AS (
+    SELECT namespace, name, json_array(script, is_file, filepath, timeout_ms) AS state
+    FROM hooks
+)
+SELECT CAST(coalesce(s.namespace, c.namespace) AS TEXT) AS namespace,
+       CAST(coalesce(s.name, c.name) AS TEXT) AS name,
+       CAST(CASE
+           WHEN s.name IS NULL THEN 'added'
+           WHEN c.name IS NULL THEN 'removed'
+           ELSE 'changed'
+       END AS TEXT) AS kind
+FROM snapshot_state s
+FULL OUTER JOIN current_state c ON c.namespace = s.namespace AND c.name = s.name
+WHERE s.state IS NOT c.state
+ORDER BY 1, 2;
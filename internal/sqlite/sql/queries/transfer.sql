@@ -0,0 +1,11 @@
+-- name: exportHooks :many
+SELECT name, script, is_file, filepath, timeout_ms
+FROM hooks
+WHERE namespace = ?
+ORDER BY name;
+
+-- name: exportAttachments :many
+SELECT "key", hook, events
+FROM key_hooks
+WHERE namespace = ?
+ORDER BY "key", hook;
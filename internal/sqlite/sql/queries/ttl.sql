@@ -0,0 +1,10 @@
+-- name: listExpired :many
+SELECT namespace, "key", val, secret
+FROM kv
+WHERE expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER)
+ORDER BY namespace, "key";
+
+-- name: deleteExpiredKey :execrows
+DELETE FROM kv
+WHERE namespace = ? AND "key" = ?
+  AND expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER);
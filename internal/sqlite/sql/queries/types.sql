@@ -0,0 +1,9 @@
+-- name: getKeyType :one
+SELECT type
+FROM key_types
+WHERE namespace = ? AND "key" = ?;
+
+-- name: setKeyType :exec
+INSERT INTO key_types (namespace, "key", type)
+VALUES (?, ?, ?)
+ON CONFLICT (namespace, "key") DO UPDATE SET type = excluded.type;
@@ -0,0 +1,18 @@
+-- name: getValWithVersion :one
+SELECT val, version
+FROM kv
+WHERE namespace = ? AND "key" = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER));
+
+-- name: setValIfVersion :execrows
+UPDATE kv
+SET val = ?, expires_at = ?, secret = ?, version = version + 1
+WHERE namespace = ? AND "key" = ? AND version = ?
+  AND (expires_at IS NULL OR expires_at > CAST(unixepoch('subsec') * 1000 AS INTEGER));
+
+-- name: setValIfAbsent :execrows
+INSERT INTO kv (namespace, "key", val, expires_at, secret)
+VALUES (?, ?, ?, ?, ?)
+ON CONFLICT (namespace, "key") DO UPDATE
+SET val = excluded.val, expires_at = excluded.expires_at, secret = excluded.secret, version = 1
+WHERE kv.expires_at <= CAST(unixepoch('subsec') * 1000 AS INTEGER);
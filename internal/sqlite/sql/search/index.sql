@@ -0,0 +1,83 @@
+-- The full-text index of keys, values and metadata. It is only built when
+-- sqlite was compiled with FTS5, the triggers keep it in sync with kv and
+-- key_tags. Secret values are never indexed.
+--
+-- The rows of the index share the rowid of their key in kv so the triggers
+-- find them by rowid instead of scanning the index. It can not be an
+-- external content table: the values of secrets are masked and the tags
+-- come from key_tags. kv has no INTEGER PRIMARY KEY, a VACUUM may renumber
+-- its rows and leave the index stale until it is rebuilt.
+DROP TABLE IF EXISTS kv_search;
+DROP TRIGGER IF EXISTS kv_search_insert;
+DROP TRIGGER IF EXISTS kv_search_update;
+DROP TRIGGER IF EXISTS kv_search_delete;
+DROP TRIGGER IF EXISTS kv_search_tags_insert;
+DROP TRIGGER IF EXISTS kv_search_tags_update;
+DROP TRIGGER IF EXISTS kv_search_tags_delete;
+
+CREATE VIRTUAL TABLE kv_search USING fts5
+(
+    namespace UNINDEXED,
+    "key",
+    val,
+    description,
+    owner,
+    tags
+);
+
+CREATE TRIGGER kv_search_insert AFTER INSERT ON kv
+BEGIN
+    INSERT INTO kv_search (rowid, namespace, "key", val, description, owner, tags)
+    VALUES (NEW.rowid, NEW.namespace, NEW."key", CASE WHEN NEW.secret THEN '' ELSE NEW.val END,
+            NEW.description, NEW.owner, '');
+END;
+
+CREATE TRIGGER kv_search_update AFTER UPDATE OF namespace, "key", val, secret, description, owner ON kv
+BEGIN
+    DELETE FROM kv_search WHERE rowid = OLD.rowid;
+    INSERT INTO kv_search (rowid, namespace, "key", val, description, owner, tags)
+    SELECT NEW.rowid, NEW.namespace, NEW."key", CASE WHEN NEW.secret THEN '' ELSE NEW.val END,
+           NEW.description, NEW.owner, coalesce(group_concat(tag, ' '), '')
+    FROM key_tags
+    WHERE namespace = NEW.namespace AND "key" = NEW."key";
+END;
+
+CREATE TRIGGER kv_search_delete AFTER DELETE ON kv
+BEGIN
+    DELETE FROM kv_search WHERE rowid = OLD.rowid;
+END;
+
+CREATE TRIGGER kv_search_tags_insert AFTER INSERT ON key_tags
+BEGIN
+    UPDATE kv_search
+    SET tags = (SELECT group_concat(tag, ' ') FROM key_tags
+                WHERE namespace = NEW.namespace AND "key" = NEW."key")
+    WHERE rowid = (SELECT rowid FROM kv WHERE namespace = NEW.namespace AND "key" = NEW."key");
+END;
+
+CREATE TRIGGER kv_search_tags_update AFTER UPDATE ON key_tags
+BEGIN
+    UPDATE kv_search
+    SET tags = coalesce((SELECT group_concat(tag, ' ') FROM key_tags
+                         WHERE namespace = OLD.namespace AND "key" = OLD."key"), '')
+    WHERE rowid = (SELECT rowid FROM kv WHERE namespace = OLD.namespace AND "key" = OLD."key");
+    UPDATE kv_search
+    SET tags = (SELECT group_concat(tag, ' ') FROM key_tags
+                WHERE namespace = NEW.namespace AND "key" = NEW."key")
+    WHERE rowid = (SELECT rowid FROM kv WHERE namespace = NEW.namespace AND "key" = NEW."key");
+END;
+
+CREATE TRIGGER kv_search_tags_delete AFTER DELETE ON key_tags
+BEGIN
+    UPDATE kv_search
+    SET tags = coalesce((SELECT group_concat(tag, ' ') FROM key_tags
+                         WHERE namespace = OLD.namespace AND "key" = OLD."key"), '')
+    WHERE rowid = (SELECT rowid FROM kv WHERE namespace = OLD.namespace AND "key" = OLD."key");
+END;
+
+INSERT INTO kv_search (rowid, namespace, "key", val, description, owner, tags)
+SELECT kv.rowid, kv.namespace, kv."key", CASE WHEN kv.secret THEN '' ELSE kv.val END,
+       kv.description, kv.owner,
+       coalesce((SELECT group_concat(tag, ' ') FROM key_tags t
+                 WHERE t.namespace = kv.namespace AND t."key" = kv."key"), '')
+FROM kv;
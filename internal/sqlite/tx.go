@@ -0,0 +1,33 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// transact runs fn inside a transaction and commits it if fn succeeds.
+// Queries already bound to a transaction run fn directly, so transactions
+// can be nested.
+func (q *Queries) transact(ctx context.Context, fn func(*Queries) error) error {
+	switch db := q.db.(type) {
+	case *sql.Tx:
+		return fn(q)
+	case *sql.DB:
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to begin the transaction: %w", err)
+		}
+		if err := fn(q.WithTx(tx)); err != nil {
+			if rbErr := tx.Rollback(); rbErr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+			}
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to commit the transaction: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("transactions are not supported by %T", q.db)
+}
@@ -2,7 +2,9 @@ package templating
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"text/template"
 	"text/template/parse"
@@ -12,7 +14,21 @@ import (
 )
 
 type TemplatingService interface {
-	Render(templateContent string) (Template, error)
+	Render(ctx context.Context, templateContent string, opts ...RenderOption) (Template, error)
+}
+
+type renderOptions struct {
+	profile string
+}
+
+type RenderOption func(*renderOptions)
+
+// WithProfile renders the template with the effective values of the keys in
+// the profile.
+func WithProfile(name string) RenderOption {
+	return func(o *renderOptions) {
+		o.profile = name
+	}
 }
 
 func walkParseTree(node parse.Node, visit func(parse.Node)) {
@@ -47,23 +63,37 @@ func getTemplateVars(templateContent string) ([]string, error) {
 	}
 
 	var templateVars []string
+	// identifiers are function names such as eq or gt, only fields refer to keys
+	var visitPipe func(pipe *parse.PipeNode)
+	visitPipe = func(pipe *parse.PipeNode) {
+		if pipe == nil {
+			return
+		}
+		for _, cmd := range pipe.Cmds {
+			for _, arg := range cmd.Args {
+				switch arg := arg.(type) {
+				case *parse.FieldNode:
+					templateVars = append(templateVars, arg.Ident[0])
+
+				case *parse.PipeNode:
+					visitPipe(arg)
+				}
+			}
+		}
+	}
 	visitNode := func(node parse.Node) {
 		if node == nil {
 			return
 		}
 		switch n := node.(type) {
 		case *parse.ActionNode:
-			for _, cmd := range n.Pipe.Cmds {
-				for _, arg := range cmd.Args {
-					switch arg := arg.(type) {
-					case *parse.FieldNode:
-						templateVars = append(templateVars, arg.Ident...)
-
-					case *parse.IdentifierNode:
-						templateVars = append(templateVars, arg.Ident)
-					}
-				}
-			}
+			visitPipe(n.Pipe)
+		case *parse.IfNode:
+			visitPipe(n.Pipe)
+		case *parse.RangeNode:
+			visitPipe(n.Pipe)
+		case *parse.WithNode:
+			visitPipe(n.Pipe)
 		}
 	}
 
@@ -84,7 +114,19 @@ type templatingService struct {
 	s kv.KvService
 }
 
-func (s *templatingService) Render(templateContent string) (Template, error) {
+func (s *templatingService) Render(ctx context.Context, templateContent string, opts ...RenderOption) (Template, error) {
+	var options renderOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	values := s.s
+	if options.profile != "" {
+		var err error
+		values, err = s.s.WithProfile(ctx, options.profile)
+		if err != nil {
+			return Template{}, err
+		}
+	}
 	parts := strings.SplitN(templateContent, "\n---\n", 2)
 	if len(parts) < 2 {
 		return Template{}, fmt.Errorf("template does not contain metadata")
@@ -101,7 +143,7 @@ func (s *templatingService) Render(templateContent string) (Template, error) {
 
 	data := make(map[string]interface{})
 	for _, varName := range templateVars {
-		value, err := s.s.Get(varName)
+		value, err := values.GetTyped(ctx, varName)
 		if err != nil {
 			return Template{}, fmt.Errorf("failed to get value for variable %s: %w", varName, err)
 		}
@@ -118,12 +160,71 @@ func (s *templatingService) Render(templateContent string) (Template, error) {
 		return Template{}, fmt.Errorf("failed to execute template: %w", err)
 	}
 
+	var keys []string
+	seen := make(map[string]bool)
+	for _, varName := range templateVars {
+		if !seen[varName] {
+			seen[varName] = true
+			keys = append(keys, varName)
+		}
+	}
+	s.s.PublishTemplateRendered(ctx, kv.TemplateRendered{
+		Namespace:      values.Namespace(),
+		Profile:        options.profile,
+		RenderLocation: metadata.RenderLocation,
+		Keys:           keys,
+	})
+
 	return Template{
 		Content:  buf.String(),
 		Metadata: metadata,
 	}, nil
 }
 
+// TemplateReference lists the keys a template reads.
+type TemplateReference struct {
+	Name string
+	Keys []string
+}
+
+// FindReferences returns the templates, given by name, that read any of the
+// keys, e.g. to find the templates to update after a rename. Templates are
+// returned in name order.
+func FindReferences(templates map[string]string, keys []string) ([]TemplateReference, error) {
+	wanted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		wanted[key] = true
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var references []TemplateReference
+	for _, name := range names {
+		content := templates[name]
+		if parts := strings.SplitN(content, "\n---\n", 2); len(parts) == 2 {
+			content = parts[1]
+		}
+		templateVars, err := getTemplateVars(content)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template %s: %w", name, err)
+		}
+		var found []string
+		seen := make(map[string]bool)
+		for _, varName := range templateVars {
+			if wanted[varName] && !seen[varName] {
+				seen[varName] = true
+				found = append(found, varName)
+			}
+		}
+		if len(found) > 0 {
+			references = append(references, TemplateReference{Name: name, Keys: found})
+		}
+	}
+	return references, nil
+}
+
 func NewService(s kv.KvService) TemplatingService {
 	return &templatingService{s}
 }
@@ -0,0 +1,169 @@
+package templating_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/inner-daydream/kvz/internal/kv"
+	"github.com/inner-daydream/kvz/internal/sqlite"
+	"github.com/inner-daydream/kvz/internal/templating"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func Test_templatingService_Render(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.OpenDB(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrator := sqlite.NewSqliteMigrator(db)
+	err = migrator.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	queries := sqlite.New(db)
+	repo := sqlite.NewRepository(queries)
+	service := kv.NewServcice(repo)
+	values := []struct {
+		key       string
+		valueType kv.ValueType
+		val       string
+	}{
+		{key: "feature_enabled", valueType: kv.TypeBool, val: "true"},
+		{key: "replicas", valueType: kv.TypeInt, val: "12"},
+		{key: "hosts", valueType: kv.TypeList, val: `["a","b"]`},
+		{key: "name", valueType: kv.TypeString, val: "kvz"},
+	}
+	for _, v := range values {
+		if err := service.DeclareType(ctx, v.key, v.valueType); err != nil {
+			t.Fatal(err)
+		}
+		if err := service.Set(ctx, v.key, v.val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	templatingService := templating.NewService(service)
+
+	tests := []struct {
+		name     string
+		template string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "Boolean condition",
+			template: "render_location: out\n---\n{{ if .feature_enabled }}on{{ else }}off{{ end }}",
+			want:     "on",
+			wantErr:  false,
+		},
+		{
+			name:     "Numeric comparison",
+			template: "render_location: out\n---\n{{ if gt .replicas 9 }}many{{ else }}few{{ end }}",
+			want:     "many",
+			wantErr:  false,
+		},
+		{
+			name:     "Range over a list",
+			template: "render_location: out\n---\n{{ range .hosts }}{{ . }};{{ end }}{{ .name }}",
+			want:     "a;b;kvz",
+			wantErr:  false,
+		},
+		{
+			name:     "Missing metadata",
+			template: "{{ .name }}",
+			want:     "",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := templatingService.Render(ctx, tt.template)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("templatingService.Render() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got.Content != tt.want {
+				t.Errorf("templatingService.Render() = %v, want %v", got.Content, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindReferences(t *testing.T) {
+	templates := map[string]string{
+		"app.conf": "render_location: /etc/app.conf\n---\nhost={{ .db_host_dev }}\n{{ if .debug }}port={{ .db_port_dev }}{{ end }}",
+		"web.conf": "render_location: /etc/web.conf\n---\nhost={{ .web_host }}",
+		"old.conf": "{{ .db_host_dev }}{{ .db_host_dev }}",
+	}
+	got, err := templating.FindReferences(templates, []string{"db_host_dev", "db_port_dev"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []templating.TemplateReference{
+		{Name: "app.conf", Keys: []string{"db_host_dev", "db_port_dev"}},
+		{Name: "old.conf", Keys: []string{"db_host_dev"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("FindReferences() = %v, want %v", got, want)
+	}
+	if _, err := templating.FindReferences(map[string]string{"bad": "{{ .x "}, nil); err == nil {
+		t.Errorf("FindReferences() should fail on an invalid template")
+	}
+}
+
+func Test_templatingService_RenderProfile(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.OpenDB(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	defer db.Close()
+	if err := sqlite.NewSqliteMigrator(db).Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	service := kv.NewServcice(sqlite.NewRepository(sqlite.New(db)))
+	prod, err := service.WithNamespace("prod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "host", "db.local"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Set(ctx, "port", "5432"); err != nil {
+		t.Fatal(err)
+	}
+	if err := prod.Set(ctx, "host", "db.prod"); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.SetProfile(ctx, "prod", kv.DefaultNamespace, "prod"); err != nil {
+		t.Fatal(err)
+	}
+	templatingService := templating.NewService(service)
+	template := "render_location: out\n---\n{{ .host }}:{{ .port }}{{ if .port }}!{{ end }}"
+	sub, err := service.Subscribe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	got, err := templatingService.Render(ctx, template, templating.WithProfile("prod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := kv.TemplateRendered{Namespace: "prod", Profile: "prod", RenderLocation: "out", Keys: []string{"host", "port"}}
+	if event := <-sub.Events(); !reflect.DeepEqual(event, want) {
+		t.Errorf("templatingService.Render() published %+v, want %+v", event, want)
+	}
+	if got.Content != "db.prod:5432!" {
+		t.Errorf("templatingService.Render() with a profile = %v, want db.prod:5432!", got.Content)
+	}
+	if got, _ := templatingService.Render(ctx, template); got.Content != "db.local:5432!" {
+		t.Errorf("templatingService.Render() = %v, want db.local:5432!", got.Content)
+	}
+	if _, err := templatingService.Render(ctx, template, templating.WithProfile("missing")); err == nil {
+		t.Error("templatingService.Render() with a missing profile should fail")
+	}
+}